@@ -0,0 +1,62 @@
+// webhookstub stands in for the card gateway locally, it signs a sample
+// payment event with the HERMES secret and posts it to the webhook route.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/payment"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+func main() {
+	utils.LoadEnv()
+	url := flag.String("url", "http://localhost:8000/payments/webhook?provider=card", "webhook endpoint")
+	secret := flag.String("secret", os.Getenv("HERMES"), "shared webhook secret")
+	auth := flag.String("auth", "", "authorization id returned at checkout (payment reference)")
+	eventType := flag.String("type", payment.EventPaymentSucceeded, "payment.succeeded or payment.failed")
+	eventID := flag.String("id", "", "event id, reuse one to replay an event")
+	amount := flag.Int64("amount", 0, "amount in the event, in minor units")
+	currency := flag.String("currency", models.DefaultCurrency, "currency of the amount")
+	flag.Parse()
+
+	if *auth == "" {
+		utils.ReplaceLogger.Fatal("-auth is required")
+	}
+	if *eventID == "" {
+		*eventID = "evt_" + uuid.NewString()
+	}
+
+	payload, err := json.Marshal(&payment.Event{
+		ID:              *eventID,
+		Type:            *eventType,
+		AuthorizationID: *auth,
+		Amount:          models.NewMoney(*amount, *currency),
+	})
+	if err != nil {
+		utils.ReplaceLogger.Fatal("failed to encode event", zap.Error(err))
+	}
+
+	request, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(payload))
+	if err != nil {
+		utils.ReplaceLogger.Fatal("failed to create request", zap.Error(err))
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-Signature", payment.NewFakeGateway(*secret).Sign(payload))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		utils.ReplaceLogger.Fatal("failed to post event", zap.Error(err))
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(response.Body)
+	utils.ReplaceLogger.Info("webhook answered", zap.String("event_id", *eventID), zap.String("status", response.Status), zap.ByteString("body", body))
+}
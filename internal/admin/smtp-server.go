@@ -1,7 +1,11 @@
 package admin
 
 import (
+	"fmt"
+	"html"
+	"io"
 	"os"
+	"time"
 
 	"github.com/h3th-IV/mysticMerch/internal/models"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
@@ -31,20 +35,88 @@ func NewSMTP() *SMTPServer {
 	}
 }
 
+// file sent along with an email
+type Attachment struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
 // trabsactional email sent to each user concerning the state of their transaction
-func TransactionalEmail(user *models.ResponseUser, subject, body string) error {
+func TransactionalEmail(user *models.ResponseUser, subject, body string, attachments ...Attachment) error {
 	smtp := NewSMTP()
 	dialer := gomail.NewDialer(smtp.Host, smtp.Port, smtp.Username, smtp.Password)
 	mailer := gomail.NewMessage()
 	mailer.SetHeader("From", smtp.Username)
 	mailer.SetHeader("To", user.Email)
+	mailer.SetHeader("Subject", subject)
 	mailer.SetBody("text/html", body)
+	for _, attachment := range attachments {
+		data := attachment.Data
+		mailer.Attach(attachment.Name,
+			gomail.SetHeader(map[string][]string{"Content-Type": {attachment.ContentType}}),
+			gomail.SetCopyFunc(func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			}))
+	}
 	if err := dialer.DialAndSend(mailer); err != nil {
 		return err
 	}
 	return nil
 }
 
+// let the buyer know their order moved to a new status
+func OrderStatusEmail(user *models.ResponseUser, change *models.OrderStatusChange) error {
+	subject := fmt.Sprintf("Your order #%d is now %s", change.OrderID, change.To)
+	body := fmt.Sprintf("<p>Hi %s,</p><p>Your order <b>#%d</b> has moved from <b>%s</b> to <b>%s</b>.</p><p>Thank you for shopping with mysticMerch.</p>",
+		html.EscapeString(user.FirstName), change.OrderID, change.From, change.To)
+	return TransactionalEmail(user, subject, body)
+}
+
+// let the buyer know their payment went through, invoice goes along as an attachment
+func OrderPaidEmail(user *models.ResponseUser, orderID int, invoiceNumber string, invoice Attachment) error {
+	subject := fmt.Sprintf("Payment received for order #%d", orderID)
+	body := fmt.Sprintf("<p>Hi %s,</p><p>We have received payment for your order <b>#%d</b> and will start packing it shortly.</p><p>Your invoice <b>%s</b> is attached.</p><p>Thank you for shopping with mysticMerch.</p>",
+		html.EscapeString(user.FirstName), orderID, html.EscapeString(invoiceNumber))
+	return TransactionalEmail(user, subject, body, invoice)
+}
+
+// how long a link stays valid, e.g 24 hours or 30 minutes
+func validFor(expiry time.Duration) string {
+	if expiry >= time.Hour {
+		if hours := int(expiry.Hours()); hours > 1 {
+			return fmt.Sprintf("%d hours", hours)
+		}
+		return "1 hour"
+	}
+	return fmt.Sprintf("%d minutes", int(expiry.Minutes()))
+}
+
+// link a new user follows to confirm their email address
+func VerificationEmail(user *models.ResponseUser, link string, expiry time.Duration) error {
+	subject := "Confirm your mysticMerch email address"
+	body := fmt.Sprintf("<p>Hi %s,</p><p>Please confirm your email address by following <a href=\"%s\">this link</a>.</p><p>The link can be used once and expires in %s. If you did not sign up, you can ignore this email.</p>",
+		html.EscapeString(user.FirstName), html.EscapeString(link), validFor(expiry))
+	return TransactionalEmail(user, subject, body)
+}
+
+// link a user follows to choose a new password
+func PasswordResetEmail(user *models.ResponseUser, link string, expiry time.Duration) error {
+	subject := "Reset your mysticMerch password"
+	body := fmt.Sprintf("<p>Hi %s,</p><p>We received a request to reset your password. You can choose a new one by following <a href=\"%s\">this link</a>.</p><p>The link can be used once and expires in %s. If you did not ask for this, you can ignore this email and your password will stay the same.</p>",
+		html.EscapeString(user.FirstName), html.EscapeString(link), validFor(expiry))
+	return TransactionalEmail(user, subject, body)
+}
+
+// let a user know their account and its data were deleted
+func AccountDeletedEmail(user *models.ResponseUser) error {
+	subject := "Your mysticMerch account has been deleted"
+	body := fmt.Sprintf("<p>Hi %s,</p><p>Your mysticMerch account, along with its cart, addresses and order history, has been deleted as you requested.</p><p>If you did not do this, please contact us right away.</p>",
+		html.EscapeString(user.FirstName))
+	return TransactionalEmail(user, subject, body)
+}
+
 // some form of Broadcast email
 func MarketingEmail(users []*models.ResponseUser, subject, body string) error {
 	smtp := NewSMTP()
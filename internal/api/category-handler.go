@@ -0,0 +1,174 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// write category failures to user
+func categoryError(w http.ResponseWriter, err error, action string) {
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, utils.ErrNoRecord):
+		status, message = http.StatusNotFound, "category or product not found"
+	case errors.Is(err, utils.ErrExistingCategory):
+		status, message = http.StatusConflict, "category slug already exists"
+	case errors.Is(err, utils.ErrInvalidCategory):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		utils.ReplaceLogger.Error("failed to "+action, zap.Error(err))
+		status, message = http.StatusInternalServerError, "failed to "+action
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+}
+
+// category tree for browsing the catalog
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	categories, err := dataBase.GetCategoryTree()
+	if err != nil {
+		categoryError(w, err, "fetch categories")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":    "categories retrieved succesfully",
+		"categories": categories,
+	}
+	apiResponse(response, w)
+}
+
+// products in a category and all of its subcategories
+func GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	category, products, page, err := dataBase.GetCategoryProducts(mux.Vars(r)["slug"], params)
+	if err != nil {
+		if pageError(w, err) {
+			return
+		}
+		categoryError(w, err, "fetch category products")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "category products retrieved succesfully",
+		"category": category,
+		"items":    products,
+		"page":     page,
+	}
+	apiResponse(response, w)
+}
+
+// create category --admin stuff
+func AdminCreateCategory(w http.ResponseWriter, r *http.Request) {
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := dataBase.CreateCategory(&category)
+	if err != nil {
+		categoryError(w, err, "create category")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "category created succesfully",
+		"category": created,
+	}
+	apiCreated(response, w)
+}
+
+// rename, move or feature category --admin stuff
+func AdminUpdateCategory(w http.ResponseWriter, r *http.Request) {
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	var category models.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	category.CategoryID = categoryID
+	category.Children = nil
+	if err := dataBase.UpdateCategory(&category); err != nil {
+		categoryError(w, err, "update category")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":  "category updated succesfully",
+		"category": category,
+	}
+	apiResponse(response, w)
+}
+
+// delete category, its subcategories move up a level --admin stuff
+func AdminDeleteCategory(w http.ResponseWriter, r *http.Request) {
+
+	categoryID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid category id", http.StatusBadRequest)
+		return
+	}
+
+	if err := dataBase.DeleteCategory(categoryID); err != nil {
+		categoryError(w, err, "delete category")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "category deleted succesfully",
+	}
+	apiResponse(response, w)
+}
+
+// replace the categories a product is listed under --admin stuff
+func AdminSetProductCategories(w http.ResponseWriter, r *http.Request) {
+
+	var request models.RequestProductCategories
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := dataBase.SetProductCategories(request.ProductUUID, request.Categories); err != nil {
+		categoryError(w, err, "set product categories")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":    "product categories updated succesfully",
+		"product_id": request.ProductUUID,
+		"categories": request.Categories,
+	}
+	apiResponse(response, w)
+}
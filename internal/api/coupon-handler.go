@@ -0,0 +1,179 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// write coupon failures to user
+func couponError(w http.ResponseWriter, err error, action string) {
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, utils.ErrNoRecord):
+		status, message = http.StatusNotFound, "coupon, product or category not found"
+	case errors.Is(err, utils.ErrEmptyCart):
+		status, message = http.StatusBadRequest, "user cart is empty"
+	case errors.Is(err, utils.ErrExistingCoupon):
+		status, message = http.StatusConflict, "coupon code already exists"
+	case errors.Is(err, utils.ErrInvalidCoupon), errors.Is(err, utils.ErrCouponLimitReached), errors.Is(err, utils.ErrCouponMinSpend), errors.Is(err, utils.ErrCouponNotApplicable):
+		status, message = http.StatusUnprocessableEntity, err.Error()
+	case errors.Is(err, utils.ErrInvalidCouponRule), errors.Is(err, models.ErrCurrencyMismatch), errors.Is(err, models.ErrInvalidCurrency), errors.Is(err, models.ErrNegativeAmount):
+		status, message = http.StatusBadRequest, err.Error()
+	default:
+		utils.ReplaceLogger.Error("failed to "+action, zap.Error(err))
+		status, message = http.StatusInternalServerError, "failed to "+action
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+}
+
+// put coupon on user cart ##
+func ApplyCoupon(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request models.RequestCoupon
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	applied, err := dataBase.ApplyCoupon(user.ID, request.Code)
+	if err != nil {
+		couponError(w, err, "apply coupon")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupon applied succesfully",
+		"coupon":  applied,
+	}
+	apiResponse(response, w)
+}
+
+// take coupon off user cart ##
+func RemoveCoupon(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	if err := dataBase.RemoveCartCoupon(user.ID); err != nil {
+		couponError(w, err, "remove coupon")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupon removed succesfully",
+	}
+	apiResponse(response, w)
+}
+
+// list every coupon --admin stuff
+func AdminGetCoupons(w http.ResponseWriter, r *http.Request) {
+
+	coupons, err := dataBase.GetCoupons()
+	if err != nil {
+		couponError(w, err, "fetch coupons")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupons retrieved succesfully",
+		"coupons": coupons,
+	}
+	apiResponse(response, w)
+}
+
+// create coupon --admin stuff
+func AdminCreateCoupon(w http.ResponseWriter, r *http.Request) {
+
+	var coupon models.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	created, err := dataBase.CreateCoupon(&coupon)
+	if err != nil {
+		couponError(w, err, "create coupon")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupon created succesfully",
+		"coupon":  created,
+	}
+	apiCreated(response, w)
+}
+
+// replace coupon rules --admin stuff
+func AdminUpdateCoupon(w http.ResponseWriter, r *http.Request) {
+
+	couponID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid coupon id", http.StatusBadRequest)
+		return
+	}
+
+	var coupon models.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	coupon.CouponID = couponID
+	if err := dataBase.UpdateCoupon(&coupon); err != nil {
+		couponError(w, err, "update coupon")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupon updated succesfully",
+		"coupon":  coupon,
+	}
+	apiResponse(response, w)
+}
+
+// delete coupon --admin stuff
+func AdminDeleteCoupon(w http.ResponseWriter, r *http.Request) {
+
+	couponID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid coupon id", http.StatusBadRequest)
+		return
+	}
+
+	if err := dataBase.DeleteCoupon(couponID); err != nil {
+		couponError(w, err, "delete coupon")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "coupon deleted succesfully",
+	}
+	apiResponse(response, w)
+}
@@ -6,14 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strconv"
-	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/h3th-IV/mysticMerch/internal/admin"
 	"github.com/h3th-IV/mysticMerch/internal/database"
 	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/payment"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
@@ -37,11 +37,27 @@ func apiResponse(response map[string]interface{}, w http.ResponseWriter) {
 	}
 }
 
+// write response with 201 Created, the content type has to be set before the status goes out
+func apiCreated(response map[string]interface{}, w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		utils.ReplaceLogger.Error("failed to encode json object", zap.Error(err))
+	}
+}
+
 // home Handler display a list products
 func Home(w http.ResponseWriter, r *http.Request) {
-	//get some list of prduct to display on the home page
-	products, err := dataBase.ViewHomeProducts()
+	//get some list of prduct to display on the home page, ?category= features one category
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	products, page, err := dataBase.ViewHomeProducts(r.URL.Query().Get("category"), params)
 	if err != nil {
+		if pageError(w, err) {
+			return
+		}
 		utils.ReplaceLogger.Error("failed to get product", zap.Error(err))
 		response := map[string]interface{}{
 			"message": "failed to get products",
@@ -53,6 +69,7 @@ func Home(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"message": "items retreived succesfully",
 		"items":   products,
+		"page":    page,
 	}
 	apiResponse(response, w)
 }
@@ -66,10 +83,6 @@ func AddItemtoStore(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "user not authenticated", http.StatusNetworkAuthenticationRequired)
 		return
 	}
-	if user.ID != 1 {
-		http.Error(w, "user not authorised", http.StatusUnauthorized)
-		return
-	}
 	//decode new item
 	var Product *models.NewProduct
 	if err := json.NewDecoder(r.Body).Decode(&Product); err != nil {
@@ -79,8 +92,20 @@ func AddItemtoStore(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 	//add product to database
-	_, err = dataBase.AddProduct(user.ID, Product.ProductName, Product.Description, Product.Image, Product.Price)
+	_, err = dataBase.AddProduct(user.ID, Product.ProductName, Product.Description, Product.Image, Product.Price, Product.Stock, Product.Weight, Product.TaxClass)
 	if err != nil {
+		if errors.Is(err, utils.ErrForbidden) {
+			http.Error(w, "user not authorised", http.StatusForbidden)
+			return
+		}
+		if errors.Is(err, models.ErrInvalidCurrency) || errors.Is(err, models.ErrNegativeAmount) || errors.Is(err, utils.ErrInvalidQuantity) {
+			response := map[string]interface{}{
+				"message": err.Error(),
+			}
+			http.Error(w, "", http.StatusBadRequest)
+			apiResponse(response, w)
+			return
+		}
 		utils.ReplaceLogger.Error("failed to add product", zap.Error(err))
 		response := map[string]interface{}{
 			"message": "failed to add product to store",
@@ -99,18 +124,6 @@ func AddItemtoStore(w http.ResponseWriter, r *http.Request) {
 
 // admin stuff
 func RemoveItemfromStore(w http.ResponseWriter, r *http.Request) {
-	//get usr id to cofirm if admin
-	uuid := r.Context().Value(utils.UserIDkey).(string)
-	user, err := dataBase.GetUserbyUUID(uuid)
-	if err != nil {
-		http.Error(w, "user not authenticated", http.StatusNetworkAuthenticationRequired)
-		return
-	}
-
-	if user.ID != 1 {
-		http.Error(w, "user not authorized", http.StatusUnauthorized)
-		return
-	}
 	//decode item -- out of stock item
 	var Product *models.RemoveProduct
 	if err := json.NewDecoder(r.Body).Decode(&Product); err != nil {
@@ -131,42 +144,121 @@ func RemoveItemfromStore(w http.ResponseWriter, r *http.Request) {
 	}
 
 	response := make(map[string]interface{})
-	response["message"] = "item Removed Succesfully"
+	response["message"] = "item marked out of stock succesfully"
 	apiResponse(response, w)
 }
 
-// admin send mail ##
-func AdminBroadcast(w http.ResponseWriter, r *http.Request) {
-	//get admin id
-	uuid := r.Context().Value(utils.UserIDkey).(string)
-	user, err := dataBase.GetUserbyUUID(uuid)
-	if err != nil {
-		http.Error(w, "user not authenticated", http.StatusNetworkAuthenticationRequired)
+// set units in stock for a product variant --admin stuff
+func UpdateStock(w http.ResponseWriter, r *http.Request) {
+	var stock models.RequestStock
+	if err := json.NewDecoder(r.Body).Decode(&stock); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
 		return
 	}
-	if user.ID != 1 {
-		http.Error(w, "user not authorised", http.StatusUnauthorized)
+	defer r.Body.Close()
+
+	if err := dataBase.SetStock(stock.ProductUUID, stock.Color, stock.Size, stock.Stock); err != nil {
+		if errors.Is(err, utils.ErrInvalidQuantity) {
+			http.Error(w, "stock cannot be negative", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, utils.ErrInvalidVariant) {
+			http.Error(w, "product does not come in that color/size", http.StatusNotFound)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to update stock", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to update stock",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
 		return
 	}
-	//decode json object
-	var notification *models.BroadcastNotification
-	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+	variants, err := dataBase.GetProductStock(stock.ProductUUID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to fetch product stock", zap.Error(err))
+	}
+	response := map[string]interface{}{
+		"message": "stock updated succesfully",
+		"stock":   variants,
+	}
+	apiResponse(response, w)
+}
+
+// add a color/size option to a product --admin stuff
+func AddProductVariant(w http.ResponseWriter, r *http.Request) {
+	var request models.RequestVariant
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
 		http.Error(w, "failed to decode json object", http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
-	users, err := dataBase.GetAllUsers()
+
+	variant, err := dataBase.AddVariant(request.ProductUUID, request.SKU, request.Color, request.Size, request.Price, request.Stock)
 	if err != nil {
-		utils.ReplaceLogger.Error("failed to retrive users for broadcast message", zap.Error(err))
-		http.Error(w, "failed to retrive users for brodcast message"+err.Error(), http.StatusInternalServerError)
+		var status int
+		var message string
+		switch {
+		case errors.Is(err, utils.ErrNoRecord):
+			status, message = http.StatusNotFound, "product not found in store"
+		case errors.Is(err, utils.ErrExistingSKU):
+			status, message = http.StatusConflict, "sku or color/size already exists"
+		case errors.Is(err, utils.ErrInvalidQuantity):
+			status, message = http.StatusBadRequest, "stock cannot be negative"
+		case errors.Is(err, models.ErrInvalidCurrency), errors.Is(err, models.ErrNegativeAmount), errors.Is(err, models.ErrCurrencyMismatch):
+			status, message = http.StatusBadRequest, "variant price must be a positive amount in the product's currency"
+		default:
+			utils.ReplaceLogger.Error("failed to add product variant", zap.Error(err))
+			status, message = http.StatusInternalServerError, "failed to add product variant"
+		}
+		response := map[string]interface{}{
+			"message": message,
+		}
+		http.Error(w, "", status)
+		apiResponse(response, w)
 		return
 	}
-	if err := admin.MarketingEmail(users, notification.Subject, notification.Body); err != nil {
-		utils.ReplaceLogger.Error("failed to send broadcast", zap.Error(err))
-		http.Error(w, "failed to send broadcast message"+err.Error(), http.StatusInternalServerError)
+	response := map[string]interface{}{
+		"message": "variant added succesfully",
+		"variant": variant,
+	}
+	apiResponse(response, w)
+}
+
+// admin send mail ##
+func AdminBroadcast(w http.ResponseWriter, r *http.Request) {
+	//decode json object
+	var notification *models.BroadcastNotification
+	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
 		return
 	}
+	defer r.Body.Close()
+	//users are mailed a page at a time so the whole user table is never held in memory
+	params := pagination.Params{Limit: pagination.MaxLimit, Sort: "oldest"}
+	for {
+		users, page, err := dataBase.GetUsers(params)
+		if err != nil {
+			utils.ReplaceLogger.Error("failed to retrive users for broadcast message", zap.Error(err))
+			http.Error(w, "failed to retrive users for brodcast message"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := admin.MarketingEmail(users, notification.Subject, notification.Body); err != nil {
+			utils.ReplaceLogger.Error("failed to send broadcast", zap.Error(err))
+			http.Error(w, "failed to send broadcast message"+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if page.Next == "" {
+			break
+		}
+		if params.Cursor, err = pagination.Decode(page.Next); err != nil {
+			utils.ServerError(w, "failed to page through users", err)
+			return
+		}
+	}
 	response := map[string]interface{}{
 		"message": "broadcast email sent succesfully",
 	}
@@ -175,17 +267,6 @@ func AdminBroadcast(w http.ResponseWriter, r *http.Request) {
 
 // send Transactional email to aparticular Customer
 func Transactional(w http.ResponseWriter, r *http.Request) {
-	//auth admin
-	uuid := r.Context().Value(utils.UserIDkey).(string)
-	user, err := dataBase.GetUserbyUUID(uuid)
-	if err != nil {
-		http.Error(w, "user not authenticated", http.StatusNetworkAuthenticationRequired)
-		return
-	}
-	if user.ID != 1 {
-		http.Error(w, "user not authorized", http.StatusUnauthorized)
-		return
-	}
 	var notification *models.TransactionNotification
 	if err := json.NewDecoder(r.Body).Decode(&notification); err != nil {
 		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
@@ -235,7 +316,7 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := dataBase.InsertUser(user.FirstName, user.LastName, user.Email, user.PhoneNumber, user.Password)
+	userID, err := dataBase.InsertUser(user.FirstName, user.LastName, user.Email, user.PhoneNumber, user.Password)
 	if err != nil {
 		utils.ReplaceLogger.Error("failed to create user account", zap.Error(err))
 		response := map[string]interface{}{
@@ -245,8 +326,15 @@ func SignUp(w http.ResponseWriter, r *http.Request) {
 		apiResponse(response, w)
 		return
 	}
+	//account exists either way, a failed email can be sent again through the resend endpoint
+	verificationSent := true
+	if err := sendVerification(&models.ResponseUser{ID: userID, FirstName: user.FirstName, Email: user.Email}); err != nil {
+		utils.ReplaceLogger.Error("failed to send verification email", zap.Error(err))
+		verificationSent = false
+	}
 	response := map[string]interface{}{
-		"message": "user account created succesffuly",
+		"message":           "user account created succesffuly, check your email to verify your address",
+		"verification_sent": verificationSent,
 	}
 	apiResponse(response, w)
 	//http.Redirect(w, r, "/login", http.StatusSeeOther)
@@ -280,52 +368,90 @@ func LogIn(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "password is incorrect", http.StatusUnauthorized)
 		return
 	}
-	var JWToken string
-	var tokenErr error
-	//create  admin token
-	if Login.Email == os.Getenv("NIMDALIAME") {
-		JWToken, tokenErr = utils.AdminToken(user, 10*time.Hour, os.Getenv("JWTISSUER"), os.Getenv("MYTH"))
-	} else {
-		//create user token
-		JWToken, tokenErr = utils.GenerateToken(user, 2*time.Hour, os.Getenv("JWTISSUER"), os.Getenv("MYSTIC"))
-	}
+	JWToken, refreshToken, tokenErr := issueTokens(user)
 	if tokenErr != nil {
 		utils.ReplaceLogger.Error("err generating token", zap.Error(tokenErr))
 		http.Error(w, "error generating token", http.StatusInternalServerError)
 		return
 	}
 	resopnse := map[string]interface{}{
-		"message": "login Succesfully",
-		"jwToken": JWToken,
+		"message":       "login Succesfully",
+		"jwToken":       JWToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
 	}
 	apiResponse(resopnse, w)
 }
 
-// Serch product by query name
+// search catalog, ?q= is matched against name and description. filters are
+// min_price/max_price (minor units), min_rating, category (slug), in_stock=true;
+// sort is relevance, newest, price_asc, price_desc or rating
 func SearchProduct(w http.ResponseWriter, r *http.Request) {
-	//get name from search query
 	query := r.URL.Query()
-	ProductName := query.Get("product_name")
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	search := &models.ProductQuery{
+		Text:     query.Get("q"),
+		Category: query.Get("category"),
+		InStock:  query.Get("in_stock") == "true",
+	}
+	//older clients search by product_name
+	if search.Text == "" {
+		search.Text = query.Get("product_name")
+	}
+	for param, value := range map[string]*int64{"min_price": &search.MinPrice, "max_price": &search.MaxPrice} {
+		if raw := query.Get(param); raw != "" {
+			if *value, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				http.Error(w, "invalid "+param, http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if raw := query.Get("min_rating"); raw != "" {
+		if search.MinRating, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "invalid min_rating", http.StatusBadRequest)
+			return
+		}
+	}
 
-	Products, err := dataBase.GetProductByName(ProductName)
+	result, err := dataBase.SearchProducts(search, params)
 	if err != nil {
-		utils.ReplaceLogger.Error("product not found in user search", zap.Error(err))
+		var status int
+		var message string
+		switch {
+		case errors.Is(err, utils.ErrInvalidSearch), errors.Is(err, utils.ErrInvalidCursor):
+			status, message = http.StatusBadRequest, err.Error()
+		case errors.Is(err, utils.ErrNoRecord):
+			status, message = http.StatusNotFound, "category not found"
+		default:
+			utils.ReplaceLogger.Error("failed to search products", zap.Error(err))
+			status, message = http.StatusInternalServerError, "failed to search products"
+		}
 		response := map[string]interface{}{
-			"message": "product not available",
+			"message": message,
 		}
-		http.Error(w, "", http.StatusNotFound)
+		http.Error(w, "", status)
 		apiResponse(response, w)
 		return
 	}
 	response := map[string]interface{}{
-		"message": "product found",
-		"item":    Products,
+		"message": "search results",
+		"items":   result.Products,
+		"total":   result.Total,
+		"facets":  result.Facets,
+		"page":    result.Page,
 	}
 	apiResponse(response, w)
 }
 
-// veiw product ##
+// veiw product with a page of its reviews, ?limit=&cursor=&sort= page through the reviews ##
 func ViewProduct(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
 	var Product *models.RequestProductView
 	if err := json.NewDecoder(r.Body).Decode(&Product); err != nil {
 		utils.ReplaceLogger.Error("failed to decode object", zap.Error(err))
@@ -335,13 +461,6 @@ func ViewProduct(w http.ResponseWriter, r *http.Request) {
 
 	//get by the uuid of product
 	ViewProduct, err := dataBase.GetProduct(Product.ProductUUID)
-	Produce := &models.ResponseProduct{
-		ProductName: ViewProduct.ProductName,
-		Description: ViewProduct.Description,
-		Price:       ViewProduct.Price,
-		Rating:      ViewProduct.Rating,
-		Image:       ViewProduct.Image,
-	}
 	if err != nil {
 		utils.ReplaceLogger.Error("failed to fetch product from DB", zap.Error(err))
 		response := map[string]interface{}{
@@ -351,6 +470,53 @@ func ViewProduct(w http.ResponseWriter, r *http.Request) {
 		apiResponse(response, w)
 		return
 	}
+	variants, err := dataBase.GetAvailableVariants(Product.ProductUUID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to fetch product variants", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fecth product from store",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+	images, err := dataBase.GetProductImages(Product.ProductUUID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to fetch product images", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fecth product from store",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+	reviews, reviewsPage, err := dataBase.GetReviews(Product.ProductUUID, false, params)
+	if err != nil {
+		if pageError(w, err) {
+			return
+		}
+		utils.ReplaceLogger.Error("failed to fetch product reviews", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fecth product from store",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+	Produce := &models.ResponseProductDetails{
+		ResponseProduct: models.ResponseProduct{
+			ProductName: ViewProduct.ProductName,
+			Description: ViewProduct.Description,
+			Price:       ViewProduct.Price,
+			Rating:      ViewProduct.Rating,
+			Image:       ViewProduct.Image,
+		},
+		ReviewCount: ViewProduct.ReviewCount,
+		Images:      images,
+		Variants:    variants,
+		Reviews:     reviews,
+		ReviewsPage: reviewsPage,
+	}
 	response := map[string]interface{}{
 		"message": "product details found",
 		"item":    Produce,
@@ -370,9 +536,16 @@ func GetUserCart(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	//fecth cart
-	Cart, err := dataBase.GetUserCart(user.ID)
+	//fecth a page of the cart, totals are always for the whole cart
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	Cart, page, err := dataBase.GetUserCartPage(user.ID, params)
 	if err != nil {
+		if pageError(w, err) {
+			return
+		}
 		utils.ReplaceLogger.Error("unable to fetch user's cart", zap.Error(err))
 		response := map[string]interface{}{
 			"mesaage": "unable to fetch user's cart",
@@ -381,14 +554,48 @@ func GetUserCart(w http.ResponseWriter, r *http.Request) {
 		apiResponse(response, w)
 		return
 	}
+	totals, err := dataBase.CartTotals(user.ID)
+	if err != nil {
+		utils.ReplaceLogger.Error("unable to work out cart totals", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "unable to work out cart totals",
+		}
+		utils.ServerError(w, "unable to work out cart totals", err)
+		apiResponse(response, w)
+		return
+	}
 	//write response
 	response := map[string]interface{}{
 		"message": "user cart returned succefully",
 		"item":    Cart,
+		"page":    page,
+		"totals":  totals,
 	}
 	apiResponse(response, w)
 }
 
+// write stock and variant failures to user, reports whether err was one of them
+func stockError(w http.ResponseWriter, err error) bool {
+	var message string
+	var status int
+	switch {
+	case errors.Is(err, utils.ErrOutOfStock):
+		status, message = http.StatusConflict, "product out of stock"
+	case errors.Is(err, utils.ErrInvalidQuantity):
+		status, message = http.StatusBadRequest, "quantity must be at least one"
+	case errors.Is(err, utils.ErrInvalidVariant):
+		status, message = http.StatusBadRequest, "product does not come in that color/size"
+	default:
+		return false
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+	return true
+}
+
 // add product to cart##
 func AddtoCart(w http.ResponseWriter, r *http.Request) {
 	//get user Id from token
@@ -421,10 +628,14 @@ func AddtoCart(w http.ResponseWriter, r *http.Request) {
 		}
 		http.Error(w, "", http.StatusNotFound)
 		apiResponse(response, w)
+		return
 	}
 
 	err = dataBase.AddProductoCart(user.ID, product.Quantity, product.ProductUUID, product.Color, product.Size)
 	if err != nil {
+		if stockError(w, err) {
+			return
+		}
 		utils.ReplaceLogger.Error("failed to add product to cart", zap.Error(err))
 		response := map[string]interface{}{
 			"response": "failed to add product to cart",
@@ -495,7 +706,10 @@ func UpdateProductDetails(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//update Product details
-	if err = dataBase.EditCartItem(user.ID, product.ID, updateDetails.Quantity, updateDetails.Color, updateDetails.Size); err != nil {
+	if err = dataBase.EditCartItem(user.ID, product.ProductID, updateDetails.Quantity, updateDetails.Color, updateDetails.Size); err != nil {
+		if stockError(w, err) {
+			return
+		}
 		utils.ReplaceLogger.Error("failed to update product details", zap.Error(err))
 		response := map[string]interface{}{
 			"message": "failed to update product details",
@@ -635,7 +849,7 @@ func GetItemFromCart(w http.ResponseWriter, r *http.Request) {
 	apiResponse(response, w)
 }
 
-// add new address for user
+// add new address for user ##
 func AddNewAddr(w http.ResponseWriter, r *http.Request) {
 	uuid := r.Context().Value(utils.UserIDkey).(string)
 
@@ -651,9 +865,20 @@ func AddNewAddr(w http.ResponseWriter, r *http.Request) {
 	house_no := r.FormValue("house_no")
 	street := r.FormValue("street")
 	city := r.FormValue("city")
+	region := r.FormValue("region")
 	postal_code := r.FormValue("postal_code")
+	country := r.FormValue("country")
+
+	addr := database.NewAddress(user, house_no, street, city, region, postal_code, country)
+	addr.DefaultShipping = r.FormValue("default_shipping") == "true"
+	addr.DefaultBilling = r.FormValue("default_billing") == "true"
 
-	if err = dataBase.AddUserAddress(user, house_no, street, city, postal_code); err != nil {
+	addr, err = dataBase.AddUserAddress(user, addr)
+	if err != nil {
+		if errors.Is(err, utils.ErrInvalidAddress) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		utils.ReplaceLogger.Error("failed to add new address for user", zap.Error(err))
 		response := map[string]interface{}{
 			"message": "failed to add new address",
@@ -664,15 +889,97 @@ func AddNewAddr(w http.ResponseWriter, r *http.Request) {
 	}
 	response := map[string]interface{}{
 		"message": "address succesfully added",
+		"address": addr,
+	}
+	apiResponse(response, w)
+}
+
+// list saved addresses of user ##
+func GetUserAddresses(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	addresses, err := dataBase.ReturnUserAddress(user.ID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to retrieve user addresses", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to retrieve user addresses",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "user addresses retrieved succesfully",
+		"addresses": addresses,
+	}
+	apiResponse(response, w)
+}
+
+// edit a saved address of user ##
+func UpdateAddress(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid address id", http.StatusBadRequest)
+		return
+	}
+
+	var addr models.Address
+	if err := json.NewDecoder(r.Body).Decode(&addr); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	addr.AddressID = addressID
+
+	if err := dataBase.UpdateUserAddress(user.ID, &addr); err != nil {
+		switch {
+		case errors.Is(err, utils.ErrInvalidAddress):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, utils.ErrNoRecord):
+			response := map[string]interface{}{
+				"message": "address not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+		default:
+			utils.ReplaceLogger.Error("failed to update address", zap.Error(err))
+			response := map[string]interface{}{
+				"message": "failed to update address",
+			}
+			http.Error(w, "", http.StatusInternalServerError)
+			apiResponse(response, w)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "address updated succesfully",
+		"address": addr,
 	}
 	apiResponse(response, w)
 }
 
-// Remove address
-// RemoveAddress handler removes the address for a user
+// RemoveAddress handler removes the address for a user ##
 func RemoveAddress(w http.ResponseWriter, r *http.Request) {
-	// Extract user ID from context
-	userID := r.Context().Value(utils.UserIDkey).(int)
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
 
 	// Extract address ID from URL parameters
 	vars := mux.Vars(r)
@@ -683,7 +990,15 @@ func RemoveAddress(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Remove the address from the database
-	if err := dataBase.RemoveAddress(userID, addressID); err != nil {
+	if err := dataBase.RemoveAddress(user.ID, addressID); err != nil {
+		if errors.Is(err, utils.ErrNoRecord) {
+			response := map[string]interface{}{
+				"message": "address not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+			return
+		}
 		utils.ReplaceLogger.Error("failed to remove address", zap.Error(err))
 		response := map[string]interface{}{
 			"message": "failed to remove address",
@@ -703,17 +1018,80 @@ func RemoveAddress(w http.ResponseWriter, r *http.Request) {
 
 // buy from cart ##
 func BuyFromCart(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if requireVerified(w, user) {
+		return
+	}
+
+	var checkout models.CheckoutRequest
+	if err := json.NewDecoder(r.Body).Decode(&checkout); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	provider, err := payment.Lookup(checkout.PaymentMethod)
+	if err != nil {
+		checkoutError(w, err)
+		return
+	}
+	pay := &checkoutPayment{provider: provider}
+	order, err := dataBase.CheckoutCart(user.ID, checkout.ShippingAddressID, checkout.BillingAddressID, quoteShipping(&checkout), pay.authorize(&checkout, uuid))
+	if err != nil {
+		pay.void()
+		checkoutError(w, err)
+		return
+	}
 
+	response := map[string]interface{}{
+		"message": "order placed succesfully",
+		"order":   order,
+	}
+	apiResponse(response, w)
 }
 
 // instant buy ##
 func InstantBuy(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if requireVerified(w, user) {
+		return
+	}
 
-}
+	var product models.RequestInstantBuy
+	if err := json.NewDecoder(r.Body).Decode(&product); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
 
-// func LogOut(w http.ResponseWriter, r *http.Request) {
-// 	defer dataBase.CloseDB()
+	provider, err := payment.Lookup(product.PaymentMethod)
+	if err != nil {
+		checkoutError(w, err)
+		return
+	}
+	pay := &checkoutPayment{provider: provider}
+	order, err := dataBase.InstantBuy(user.ID, product.ProductUUID, product.Quantity, product.Color, product.Size, product.ShippingAddressID, product.BillingAddressID, quoteShipping(&product.CheckoutRequest), pay.authorize(&product.CheckoutRequest, uuid))
+	if err != nil {
+		pay.void()
+		checkoutError(w, err)
+		return
+	}
 
-// 	r.Context().Value(utils.UserIDkey)
-// 	c := http.Cookie{}
-// }
+	response := map[string]interface{}{
+		"message": "order placed succesfully",
+		"order":   order,
+	}
+	apiResponse(response, w)
+}
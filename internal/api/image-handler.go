@@ -0,0 +1,193 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/storage"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	maxImageSize       = 5 << 20 //bytes per image
+	maxImagesPerUpload = 10
+	//multipart overhead on top of the images themselves
+	maxUploadSize = maxImagesPerUpload*maxImageSize + 1<<20
+)
+
+// file extension of each image type accepted, the type is sniffed from the file not taken from the client
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// write image failures to user
+func imageError(w http.ResponseWriter, err error, action string) {
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, utils.ErrNoRecord):
+		status, message = http.StatusNotFound, "product or image not found"
+	case errors.Is(err, utils.ErrInvalidImage), errors.Is(err, utils.ErrInvalidImageOrder):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, utils.ErrTooManyImages):
+		status, message = http.StatusConflict, err.Error()
+	default:
+		utils.ReplaceLogger.Error("failed to "+action, zap.Error(err))
+		status, message = http.StatusInternalServerError, "failed to "+action
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+}
+
+// check an uploaded file is an image we accept and save it to store under the product
+func storeImage(store storage.BlobStore, productUUID string, header *multipart.FileHeader) (*models.ProductImage, error) {
+	if header.Size > maxImageSize {
+		return nil, utils.ErrInvalidImage
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	//DetectContentType looks at no more than the first 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, utils.ErrInvalidImage
+	}
+	head = head[:n]
+	contentType := http.DetectContentType(head)
+	extension, ok := imageExtensions[contentType]
+	if !ok {
+		return nil, utils.ErrInvalidImage
+	}
+
+	key := "products/" + productUUID + "/" + uuid.NewString() + extension
+	if err := store.Put(key, io.MultiReader(bytes.NewReader(head), file)); err != nil {
+		return nil, err
+	}
+	return &models.ProductImage{Key: key, URL: store.URL(key), ContentType: contentType, Size: header.Size}, nil
+}
+
+// upload images of a product as multipart form field "images", they go after the existing ones --admin stuff
+func AdminUploadProductImages(w http.ResponseWriter, r *http.Request) {
+	productUUID := mux.Vars(r)["id"]
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxImageSize); err != nil {
+		http.Error(w, "upload must be multipart form data of at most "+strconv.Itoa(maxUploadSize>>20)+"MB", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	headers := r.MultipartForm.File["images"]
+	if len(headers) == 0 || len(headers) > maxImagesPerUpload {
+		http.Error(w, "upload 1 to "+strconv.Itoa(maxImagesPerUpload)+" files in the images field", http.StatusBadRequest)
+		return
+	}
+	exists, err := dataBase.CheckProductExist(productUUID)
+	if err != nil {
+		imageError(w, err, "upload images")
+		return
+	}
+	if exists == 0 {
+		imageError(w, utils.ErrNoRecord, "upload images")
+		return
+	}
+
+	store := storage.Default()
+	var uploads []*models.ProductImage
+	//files already stored are removed again when the upload as a whole fails
+	discard := func() {
+		for _, image := range uploads {
+			if err := store.Delete(image.Key); err != nil {
+				utils.ReplaceLogger.Error("failed to remove uploaded image", zap.String("key", image.Key), zap.Error(err))
+			}
+		}
+	}
+	for _, header := range headers {
+		image, err := storeImage(store, productUUID, header)
+		if err != nil {
+			discard()
+			imageError(w, err, "upload images")
+			return
+		}
+		uploads = append(uploads, image)
+	}
+
+	images, err := dataBase.AddProductImages(productUUID, uploads)
+	if err != nil {
+		discard()
+		imageError(w, err, "upload images")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "images uploaded succesfully",
+		"images":  images,
+	}
+	apiCreated(response, w)
+}
+
+// put images of a product in a new order, the first is the main image --admin stuff
+func AdminReorderProductImages(w http.ResponseWriter, r *http.Request) {
+	var request models.RequestImageOrder
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	images, err := dataBase.ReorderProductImages(mux.Vars(r)["id"], request.ImageIDs)
+	if err != nil {
+		imageError(w, err, "reorder images")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "images reordered succesfully",
+		"images":  images,
+	}
+	apiResponse(response, w)
+}
+
+// remove an image of a product along with its file --admin stuff
+func AdminDeleteProductImage(w http.ResponseWriter, r *http.Request) {
+	imageID, err := strconv.Atoi(mux.Vars(r)["image_id"])
+	if err != nil {
+		http.Error(w, "invalid image id", http.StatusBadRequest)
+		return
+	}
+
+	image, err := dataBase.DeleteProductImage(mux.Vars(r)["id"], imageID)
+	if err != nil {
+		imageError(w, err, "delete image")
+		return
+	}
+	//the row is gone so a file left behind is only wasted space, not worth failing over
+	if err := storage.Default().Delete(image.Key); err != nil {
+		utils.ReplaceLogger.Error("failed to remove image file", zap.String("key", image.Key), zap.Error(err))
+	}
+
+	response := map[string]interface{}{
+		"message": "image deleted succesfully",
+	}
+	apiResponse(response, w)
+}
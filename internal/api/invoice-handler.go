@@ -0,0 +1,98 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/invoice"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// rendered invoice of an order as an email attachment
+func invoiceAttachment(orderID int) (*models.Invoice, admin.Attachment, error) {
+	inv, err := dataBase.GetOrderInvoice(orderID, 0)
+	if err != nil {
+		return nil, admin.Attachment{}, err
+	}
+	document, err := invoice.Render(inv)
+	if err != nil {
+		return nil, admin.Attachment{}, err
+	}
+	return inv, admin.Attachment{Name: invoice.FileName(inv), ContentType: invoice.ContentType, Data: document}, nil
+}
+
+// email buyer their invoice once an order is paid
+func sendPaidInvoice(buyer *models.ResponseUser, orderID int) error {
+	inv, attachment, err := invoiceAttachment(orderID)
+	if err != nil {
+		return err
+	}
+	return orderPaidEmail(buyer, orderID, inv.Number, attachment)
+}
+
+// write invoice of order, buyerID 0 lets any order through
+func writeInvoice(w http.ResponseWriter, r *http.Request, buyerID int) {
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	inv, err := dataBase.GetOrderInvoice(orderID, buyerID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoRecord) {
+			response := map[string]interface{}{
+				"message": "order not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to get order invoice", zap.Int("order_id", orderID), zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to get order invoice",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+	document, err := invoice.Render(inv)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to render invoice", zap.String("invoice", inv.Number), zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to render invoice",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	disposition := "inline"
+	if r.URL.Query().Get("download") == "true" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", invoice.ContentType)
+	w.Header().Set("Content-Disposition", disposition+`; filename="`+invoice.FileName(inv)+`"`)
+	w.Write(document)
+}
+
+// invoice of an order placed by user, ?download=true saves it as a file ##
+func GetUserOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+	writeInvoice(w, r, user.ID)
+}
+
+// invoice of any order --admin stuff
+func AdminOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	writeInvoice(w, r, 0)
+}
@@ -0,0 +1,214 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// write bad ?cursor= or ?sort= to user, reports whether err was one of them
+func pageError(w http.ResponseWriter, err error) bool {
+	if !errors.Is(err, utils.ErrInvalidCursor) && !errors.Is(err, utils.ErrInvalidSort) {
+		return false
+	}
+	response := map[string]interface{}{
+		"message": err.Error(),
+	}
+	http.Error(w, "", http.StatusBadRequest)
+	apiResponse(response, w)
+	return true
+}
+
+// order history of user ##
+func GetUserOrders(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	orders, page, err := dataBase.GetUserOrders(user.ID, params)
+	if err != nil {
+		if pageError(w, err) {
+			return
+		}
+		utils.ReplaceLogger.Error("failed to fetch user orders", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fetch user orders",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "user orders retrieved succesfully",
+		"orders":  orders,
+		"page":    page,
+	}
+	apiResponse(response, w)
+}
+
+// single order of user with its line items ##
+func GetUserOrder(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	order, err := dataBase.GetUserOrder(user.ID, orderID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNoRecord) {
+			response := map[string]interface{}{
+				"message": "order not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to fetch user order", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fetch user order",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "order retrieved succesfully",
+		"order":   order,
+	}
+	apiResponse(response, w)
+}
+
+// emails buyers get as their orders move along, tests swap them out so nothing is sent
+var (
+	orderStatusEmail = admin.OrderStatusEmail
+	orderPaidEmail   = admin.OrderPaidEmail
+)
+
+// email buyer about a status change of their order, paid orders get their invoice. reports if the mail went out
+func notifyBuyer(change *models.OrderStatusChange) bool {
+	buyer, err := dataBase.GetOrderBuyer(change.OrderID)
+	if err == nil {
+		if change.To == models.OrderPaid {
+			err = sendPaidInvoice(buyer, change.OrderID)
+		} else {
+			err = orderStatusEmail(buyer, change)
+		}
+	}
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to notify buyer of order status", zap.Int("order_id", change.OrderID), zap.Error(err))
+		return false
+	}
+	return true
+}
+
+// admin moves order along its lifecycle, buyer gets notified by email
+func AdminUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user not authenticated", http.StatusNetworkAuthenticationRequired)
+		return
+	}
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RequestOrderStatus
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	change, err := dataBase.UpdateOrderStatus(orderID, user.ID, request.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrNoRecord):
+			response := map[string]interface{}{
+				"message": "order not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+		case errors.Is(err, utils.ErrInvalidOrderStatus), errors.Is(err, utils.ErrInvalidOrderTransition):
+			response := map[string]interface{}{
+				"message": err.Error(),
+			}
+			http.Error(w, "", http.StatusConflict)
+			apiResponse(response, w)
+		default:
+			utils.ReplaceLogger.Error("failed to update order status", zap.Error(err))
+			response := map[string]interface{}{
+				"message": "failed to update order status",
+			}
+			http.Error(w, "", http.StatusInternalServerError)
+			apiResponse(response, w)
+		}
+		return
+	}
+
+	//status is already committed, failures from here on are logged and should not fail the request
+	settlePayment(change)
+
+	response := map[string]interface{}{
+		"message":    "order status updated succesfully",
+		"change":     change,
+		"email_sent": notifyBuyer(change),
+	}
+	apiResponse(response, w)
+}
+
+// audit trail of an order's status changes
+func AdminOrderStatusHistory(w http.ResponseWriter, r *http.Request) {
+
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+
+	history, err := dataBase.GetOrderStatusHistory(orderID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to fetch order status history", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fetch order status history",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "order status history retrieved succesfully",
+		"history": history,
+	}
+	apiResponse(response, w)
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	passwordResetTTL = 30 * time.Minute
+	//reset emails per user within resendWindow
+	maxResetEmails = 3
+)
+
+// email a password reset link to user, limited like verification resends
+func sendPasswordReset(user *models.ResponseUser) error {
+	sent, since, err := dataBase.RecentUserTokens(user.ID, models.TokenPasswordReset, resendWindow)
+	if err != nil {
+		return err
+	}
+	if sent >= maxResetEmails || since < resendCooldown {
+		return nil
+	}
+	token, err := dataBase.CreateUserToken(user.ID, models.TokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	return admin.PasswordResetEmail(user, appLink("/password/reset", url.Values{"token": {token}}), passwordResetTTL)
+}
+
+// page the emailed reset link opens, it posts the new password to POST /password/reset.
+// errors come back as plain text or with a json line after it, the page shows the message of either
+var resetPasswordPage = template.Must(template.New("reset").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Reset your mysticMerch password</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 40px auto; max-width: 360px; }
+input, button { display: block; width: 100%; box-sizing: border-box; margin-top: 12px; padding: 8px; }
+</style>
+</head>
+<body>
+<h1>mysticMerch</h1>
+<form id="reset">
+<label for="password">New password</label>
+<input id="password" type="password" autocomplete="new-password" minlength="8" maxlength="15" required>
+<button type="submit">Reset password</button>
+</form>
+<p id="message"></p>
+<script>
+const token = {{.}};
+document.getElementById("reset").addEventListener("submit", async function (event) {
+	event.preventDefault();
+	const response = await fetch(window.location.pathname, {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify({token: token, password: document.getElementById("password").value}),
+	});
+	const body = (await response.text()).trim();
+	let message = body;
+	try { message = JSON.parse(body.split("\n").pop()).message; } catch (e) {}
+	document.getElementById("message").textContent = message;
+	if (response.ok) { document.getElementById("reset").hidden = true; }
+});
+</script>
+</body>
+</html>
+`))
+
+// form to choose a new password, where the emailed reset link leads ##
+func ResetPasswordForm(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing reset token", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	//keep the token out of referer headers
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	if err := resetPasswordPage.Execute(w, token); err != nil {
+		utils.ReplaceLogger.Error("failed to render password reset form", zap.Error(err))
+	}
+}
+
+// email a reset link, answers the same whether or not the account exists ##
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request models.RequestEmail
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	email := strings.TrimSpace(request.Email)
+	if !utils.ValidateEmail(email) {
+		http.Error(w, "invalid email address", http.StatusBadRequest)
+		return
+	}
+
+	//lookup and mail happen off the request so response time says nothing about the account
+	go func() {
+		user, err := dataBase.GetUserByEmail(email)
+		if err != nil {
+			if !errors.Is(err, utils.ErrNoRecord) {
+				utils.ReplaceLogger.Error("failed to retrieve user for password reset", zap.Error(err))
+			}
+			return
+		}
+		if err := sendPasswordReset(user); err != nil {
+			utils.ReplaceLogger.Error("failed to send password reset email", zap.Error(err))
+		}
+	}()
+
+	response := map[string]interface{}{
+		"message": "if an account exists for that email, a password reset link has been sent",
+	}
+	apiResponse(response, w)
+}
+
+// set a new password with an emailed reset token ##
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request models.RequestPasswordReset
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if request.Token == "" {
+		http.Error(w, "missing reset token", http.StatusBadRequest)
+		return
+	}
+	if !utils.ValidatePassword(request.Password) {
+		http.Error(w, "failed to validate password", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(request.Password)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to hash password", zap.Error(err))
+		http.Error(w, "failed to reset password", http.StatusInternalServerError)
+		return
+	}
+	if err := dataBase.ResetPassword(request.Token, passwordHash); err != nil {
+		if errors.Is(err, utils.ErrInvalidToken) {
+			response := map[string]interface{}{
+				"message": "reset link is invalid or expired",
+			}
+			http.Error(w, "", http.StatusBadRequest)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to reset password", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to reset password",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "password reset succesfully, log in with your new password",
+	}
+	apiResponse(response, w)
+}
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// the emailed link is a GET, it must open a page rather than the JSON endpoint
+func TestResetPasswordForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		status int
+		want   string
+	}{
+		{"token", "/password/reset?token=abc123", http.StatusOK, `const token = "abc123";`},
+		//token is written into a script, it must stay a string
+		{"token escaped", "/password/reset?token=" + `%22%3B%3C%2Fscript%3E`, http.StatusOK, `const token = "\";\u003c/script\u003e";`},
+		{"missing token", "/password/reset", http.StatusBadRequest, "missing reset token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ResetPasswordForm(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if body := w.Body.String(); !strings.Contains(body, tt.want) {
+				t.Errorf("body does not contain %q:\n%s", tt.want, body)
+			}
+			if tt.status == http.StatusOK && w.Header().Get("Referrer-Policy") != "no-referrer" {
+				t.Errorf("Referrer-Policy = %q, want no-referrer", w.Header().Get("Referrer-Policy"))
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/h3th-IV/mysticMerch/internal/database"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/payment"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// pending payment of an order being placed, kept so it can be voided if the order never lands
+type checkoutPayment struct {
+	provider payment.PaymentProvider
+	payment  *models.Payment
+	amount   models.Money
+}
+
+// authorize order total through provider picked by user
+func (cp *checkoutPayment) authorize(request *models.CheckoutRequest, reference string) database.AuthorizeFunc {
+	return func(total models.Money) (*models.Payment, error) {
+		auth, err := cp.provider.Authorize(&payment.Charge{
+			Amount:    total,
+			Reference: reference,
+			Token:     request.CardToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		cp.amount = total
+		cp.payment = &models.Payment{
+			Method:    cp.provider.Method(),
+			Provider:  cp.provider.Name(),
+			Reference: auth.ID,
+			Status:    auth.Status,
+		}
+		return cp.payment, nil
+	}
+}
+
+// release money held for an order that failed to be written, payment is taken before the order is
+// so every failure after authorize lands here
+func (cp *checkoutPayment) void() {
+	if cp.payment == nil {
+		return
+	}
+	if err := cp.provider.Refund(cp.payment.Reference, cp.amount); err != nil {
+		utils.ReplaceLogger.Error("failed to void payment", zap.String("reference", cp.payment.Reference), zap.Error(err))
+	}
+}
+
+// write checkout failures to user
+func checkoutError(w http.ResponseWriter, err error) {
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, utils.ErrEmptyCart):
+		status, message = http.StatusBadRequest, "user cart is empty"
+	case errors.Is(err, utils.ErrNoRecord):
+		status, message = http.StatusNotFound, "product not found in store"
+	case errors.Is(err, utils.ErrInvalidQuantity):
+		status, message = http.StatusBadRequest, "quantity must be at least one"
+	case errors.Is(err, utils.ErrOutOfStock):
+		status, message = http.StatusConflict, "product out of stock"
+	case errors.Is(err, utils.ErrInvalidVariant):
+		status, message = http.StatusBadRequest, "product does not come in that color/size"
+	case errors.Is(err, utils.ErrUnknownPaymentMethod):
+		status, message = http.StatusBadRequest, "unknown payment method"
+	case errors.Is(err, models.ErrCurrencyMismatch):
+		status, message = http.StatusBadRequest, "items in cart are priced in different currencies"
+	case errors.Is(err, utils.ErrInvalidCoupon), errors.Is(err, utils.ErrCouponLimitReached), errors.Is(err, utils.ErrCouponMinSpend), errors.Is(err, utils.ErrCouponNotApplicable):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, utils.ErrAddressRequired), errors.Is(err, utils.ErrUnknownAddress):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, utils.ErrUnknownCarrier), errors.Is(err, utils.ErrNoShippingRate):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, utils.ErrPaymentDeclined):
+		status, message = http.StatusPaymentRequired, "payment declined"
+	case errors.Is(err, utils.ErrOrderChanged):
+		status, message = http.StatusConflict, "prices or stock changed while placing the order, please try again"
+	default:
+		utils.ReplaceLogger.Error("failed to place order", zap.Error(err))
+		status, message = http.StatusInternalServerError, "failed to place order"
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+}
+
+// capture or give back order money when its status changes
+func settlePayment(change *models.OrderStatusChange) {
+	pay, amount, err := dataBase.GetOrderPayment(change.OrderID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to get order payment", zap.Int("order_id", change.OrderID), zap.Error(err))
+		return
+	}
+	provider, err := payment.Lookup(pay.Provider)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to get payment provider", zap.String("provider", pay.Provider), zap.Error(err))
+		return
+	}
+
+	var status models.PaymentStatus
+	switch change.To {
+	case models.OrderPaid:
+		if pay.Status == models.PaymentCaptured {
+			return
+		}
+		status = models.PaymentCaptured
+		err = provider.Capture(pay.Reference, amount)
+	case models.OrderCancelled, models.OrderRefunded:
+		if pay.Status == models.PaymentRefunded || pay.Status == models.PaymentFailed {
+			return
+		}
+		status = models.PaymentRefunded
+		err = provider.Refund(pay.Reference, amount)
+	default:
+		return
+	}
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to settle order payment", zap.Int("order_id", change.OrderID), zap.Error(err))
+		return
+	}
+	if err := dataBase.SetPaymentStatus(change.OrderID, status); err != nil {
+		utils.ReplaceLogger.Error("failed to record payment status", zap.Int("order_id", change.OrderID), zap.Error(err))
+	}
+}
+
+// largest webhook body accepted from a provider
+const maxWebhookBytes = 1 << 20
+
+// provider notifies us of payment outcome, signed with the shared secret ##
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	providerName := r.URL.Query().Get("provider")
+	if providerName == "" {
+		providerName = payment.ProviderCard
+	}
+	provider, err := payment.Lookup(providerName)
+	if err != nil {
+		http.Error(w, "unknown payment provider", http.StatusBadRequest)
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, "failed to read webhook body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	event, err := provider.VerifyWebhook(payload, r.Header.Get("X-Signature"))
+	if err != nil {
+		utils.ReplaceLogger.Warn("rejected payment webhook", zap.String("provider", providerName), zap.Error(err))
+		http.Error(w, "invalid webhook", http.StatusUnauthorized)
+		return
+	}
+
+	var status models.PaymentStatus
+	switch event.Type {
+	case payment.EventPaymentSucceeded:
+		status = models.PaymentCaptured
+	case payment.EventPaymentFailed:
+		status = models.PaymentFailed
+	default:
+		//acknowledge events we don't act on so the provider stops retrying
+		apiResponse(map[string]interface{}{"message": "event ignored"}, w)
+		return
+	}
+
+	result, err := dataBase.ReconcilePaymentEvent(providerName, event.ID, event.Type, event.AuthorizationID, status, event.Amount)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrNoRecord):
+			http.Error(w, "no order for authorization", http.StatusNotFound)
+			return
+		case errors.Is(err, utils.ErrPaymentMismatch):
+			utils.ReplaceLogger.Warn("rejected payment event", zap.String("event_id", event.ID), zap.String("authorization_id", event.AuthorizationID), zap.Int64("amount", event.Amount.Amount), zap.String("currency", event.Amount.Currency), zap.Error(err))
+			http.Error(w, "payment does not match order total", http.StatusUnprocessableEntity)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to reconcile payment event", zap.String("event_id", event.ID), zap.Error(err))
+		http.Error(w, "failed to reconcile payment event", http.StatusInternalServerError)
+		return
+	}
+	if result.Refund {
+		//money was taken for an order that can't be paid anymore, it goes back to the buyer.
+		//a failed refund answers 500 so the provider redelivers the event and the refund is tried again
+		if err := provider.Refund(event.AuthorizationID, event.Amount); err != nil {
+			utils.ReplaceLogger.Error("failed to refund payment captured for order that cannot be paid", zap.Int("order_id", result.OrderID), zap.String("event_id", event.ID), zap.Error(err))
+			http.Error(w, "failed to refund payment", http.StatusInternalServerError)
+			return
+		}
+		if err := dataBase.SetPaymentStatus(result.OrderID, models.PaymentRefunded); err != nil {
+			utils.ReplaceLogger.Error("failed to record payment status", zap.Int("order_id", result.OrderID), zap.Error(err))
+		}
+		apiResponse(map[string]interface{}{"message": "order can no longer be paid, payment refunded"}, w)
+		return
+	}
+	if result.Duplicate {
+		apiResponse(map[string]interface{}{"message": "event already processed"}, w)
+		return
+	}
+	if result.Change != nil {
+		notifyBuyer(result.Change)
+	}
+
+	response := map[string]interface{}{
+		"message": "event processed",
+	}
+	apiResponse(response, w)
+}
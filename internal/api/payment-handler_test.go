@@ -0,0 +1,442 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/payment"
+)
+
+const webhookSecret = "webhook-secret"
+
+// stored invoice of the webhook order
+type webhookInvoice struct {
+	year, number int
+	issuedAt     time.Time
+}
+
+// order the webhook tests reconcile events against, stands in for the tables the webhook touches
+type webhookStore struct {
+	mu             sync.Mutex
+	reference      string //authorization id the order was paid with
+	orderStatus    string
+	paymentStatus  string
+	due            int64
+	events         map[string]bool
+	paymentUpdates int
+	counter        int
+	invoice        *webhookInvoice
+	statusEmails   []*models.OrderStatusChange
+	paidEmails     []string //invoice numbers
+}
+
+var (
+	webhookStores   sync.Map
+	registerDriver  sync.Once
+	errUnknownQuery = errors.New("webhookdb: unexpected query")
+)
+
+// point dataBase at a fresh pending order due 25.00 USD, paid with authorization reference.
+// buyer emails are kept on the store instead of being sent
+func newWebhookStore(t *testing.T, reference string) *webhookStore {
+	registerDriver.Do(func() { sql.Register("webhookdb", webhookDriver{}) })
+	store := &webhookStore{
+		reference:     reference,
+		orderStatus:   string(models.OrderPending),
+		paymentStatus: string(models.PaymentAuthorized),
+		due:           2500,
+		events:        make(map[string]bool),
+	}
+	webhookStores.Store(t.Name(), store)
+
+	db, err := sql.Open("webhookdb", t.Name())
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	previousDB, previousStatusEmail, previousPaidEmail := dataBase.DB, orderStatusEmail, orderPaidEmail
+	dataBase.DB = db
+	orderStatusEmail = func(user *models.ResponseUser, change *models.OrderStatusChange) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.statusEmails = append(store.statusEmails, change)
+		return nil
+	}
+	orderPaidEmail = func(user *models.ResponseUser, orderID int, invoiceNumber string, invoice admin.Attachment) error {
+		store.mu.Lock()
+		defer store.mu.Unlock()
+		store.paidEmails = append(store.paidEmails, invoiceNumber)
+		return nil
+	}
+	t.Cleanup(func() {
+		dataBase.DB, orderStatusEmail, orderPaidEmail = previousDB, previousStatusEmail, previousPaidEmail
+		db.Close()
+		webhookStores.Delete(t.Name())
+	})
+	return store
+}
+
+type webhookDriver struct{}
+
+func (webhookDriver) Open(name string) (driver.Conn, error) {
+	store, ok := webhookStores.Load(name)
+	if !ok {
+		return nil, errors.New("webhookdb: no store " + name)
+	}
+	return &webhookConn{store: store.(*webhookStore)}, nil
+}
+
+type webhookConn struct {
+	store *webhookStore
+}
+
+func (c *webhookConn) Prepare(query string) (driver.Stmt, error) {
+	return &webhookStmt{store: c.store, query: query}, nil
+}
+
+func (c *webhookConn) Close() error { return nil }
+
+func (c *webhookConn) Begin() (driver.Tx, error) { return webhookTx{}, nil }
+
+type webhookTx struct{}
+
+func (webhookTx) Commit() error   { return nil }
+func (webhookTx) Rollback() error { return nil }
+
+type webhookStmt struct {
+	store *webhookStore
+	query string
+}
+
+func (s *webhookStmt) Close() error  { return nil }
+func (s *webhookStmt) NumInput() int { return -1 }
+
+func (s *webhookStmt) Exec(args []driver.Value) (driver.Result, error) {
+	store := s.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	switch {
+	case strings.Contains(s.query, "insert into payment_events"):
+		eventID := args[0].(string)
+		if store.events[eventID] {
+			return nil, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry '" + eventID + "' for key 'PRIMARY'"}
+		}
+		store.events[eventID] = true
+	case strings.Contains(s.query, "update orders set payment_status"):
+		store.paymentStatus = args[0].(string)
+		store.paymentUpdates++
+	case strings.Contains(s.query, "update orders set status"):
+		store.orderStatus = args[0].(string)
+	case strings.Contains(s.query, "insert into invoice_counters"):
+		store.counter++
+	case strings.Contains(s.query, "insert into invoices"):
+		store.invoice = &webhookInvoice{year: int(args[1].(int64)), number: int(args[2].(int64)), issuedAt: args[3].(time.Time)}
+	}
+	//history rows and restocking only need to succeed
+	return driver.RowsAffected(1), nil
+}
+
+func (s *webhookStmt) Query(args []driver.Value) (driver.Rows, error) {
+	store := s.store
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	row := func(columns []string, values ...driver.Value) *webhookRows {
+		return &webhookRows{columns: columns, values: [][]driver.Value{values}}
+	}
+	switch {
+	case strings.Contains(s.query, "where payment_provider = ? and payment_ref = ?"):
+		if args[0] != payment.ProviderCard || args[1] != store.reference {
+			return &webhookRows{}, nil
+		}
+		return row([]string{"order_id", "status", "payment_status", "due", "currency"}, int64(1), store.orderStatus, store.paymentStatus, store.due, "USD"), nil
+	case strings.Contains(s.query, "select status from orders"):
+		return row([]string{"status"}, store.orderStatus), nil
+	case strings.Contains(s.query, "from invoices where order_id"):
+		if store.invoice == nil {
+			return &webhookRows{}, nil
+		}
+		return row([]string{"year", "number", "issued_at", "first_name", "last_name", "email", "phone"},
+			int64(store.invoice.year), int64(store.invoice.number), store.invoice.issuedAt, "Ada", "Obi", "ada@example.com", "+2348000000000"), nil
+	case strings.Contains(s.query, "join users u on u.id = o.user_id"):
+		return row([]string{"id", "first_name", "last_name", "email", "phone"}, int64(7), "Ada", "Obi", "ada@example.com", "+2348000000000"), nil
+	case strings.Contains(s.query, "select last_number from invoice_counters"):
+		return row([]string{"last_number"}, int64(store.counter)), nil
+	case strings.Contains(s.query, "select user_id from orders"):
+		return row([]string{"user_id"}, int64(7)), nil
+	case strings.Contains(s.query, "left join coupons c"):
+		return row([]string{"order_id", "ordered_at", "price", "discount", "currency", "status", "payment_type", "payment_provider", "payment_ref", "payment_status", "code",
+			"shipping_address", "billing_address", "shipping_carrier", "shipping_method", "shipping_cost", "tax", "included_tax"},
+			int64(1), time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), store.due, int64(0), "USD", store.orderStatus, models.PaymentElectronic, payment.ProviderCard, store.reference, store.paymentStatus, "",
+			nil, nil, "", "", int64(0), int64(0), int64(0)), nil
+	case strings.Contains(s.query, "from order_items"):
+		return row([]string{"product_id", "product_name", "price", "quantity", "color", "size", "tax", "tax_rate", "tax_inclusive"},
+			"prd-1", "Blue Cotton Shirt", store.due, int64(1), "blue", "M", int64(0), int64(0), false), nil
+	}
+	return nil, errUnknownQuery
+}
+
+type webhookRows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *webhookRows) Columns() []string { return r.columns }
+func (r *webhookRows) Close() error      { return nil }
+
+func (r *webhookRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
+
+// card gateway whose next refund fails, like one that is briefly unreachable
+type flakyGateway struct {
+	*payment.FakeGateway
+	failRefund bool
+}
+
+func (g *flakyGateway) Refund(authorizationID string, amount models.Money) error {
+	if g.failRefund {
+		g.failRefund = false
+		return errors.New("gateway unavailable")
+	}
+	return g.FakeGateway.Refund(authorizationID, amount)
+}
+
+// register a card gateway and return an authorization it captured 25.00 USD on
+func capturedPayment(t *testing.T, gateway payment.PaymentProvider) string {
+	auth, err := gateway.Authorize(&payment.Charge{Amount: models.NewMoney(2500, "USD"), Token: "tok_visa"})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if err := gateway.Capture(auth.ID, models.NewMoney(2500, "USD")); err != nil {
+		t.Fatalf("Capture() error = %v", err)
+	}
+	payment.Register(gateway)
+	return auth.ID
+}
+
+// signed webhook request for event
+func webhookRequest(t *testing.T, event *payment.Event) *http.Request {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	r := httptest.NewRequest(http.MethodPost, "/payments/webhook?provider=card", bytes.NewReader(payload))
+	r.Header.Set("X-Signature", payment.NewFakeGateway(webhookSecret).Sign(payload))
+	return r
+}
+
+// post r to the webhook and return status and message
+func serveWebhook(t *testing.T, r *http.Request) (int, string) {
+	w := httptest.NewRecorder()
+	PaymentWebhook(w, r)
+
+	var response struct {
+		Message string `json:"message"`
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return w.Code, response.Message
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	const auth = "auth_1"
+	payment.Register(payment.NewFakeGateway(webhookSecret))
+
+	failed := &payment.Event{ID: "evt_failed", Type: payment.EventPaymentFailed, AuthorizationID: auth, Amount: models.NewMoney(2500, "USD")}
+	tests := []struct {
+		name    string
+		request func(t *testing.T) *http.Request
+		status  int
+		message string
+	}{
+		{"unknown provider", func(t *testing.T) *http.Request {
+			r := webhookRequest(t, failed)
+			r.URL.RawQuery = "provider=paypal"
+			return r
+		}, http.StatusBadRequest, ""},
+		{"missing signature", func(t *testing.T) *http.Request {
+			r := webhookRequest(t, failed)
+			r.Header.Del("X-Signature")
+			return r
+		}, http.StatusUnauthorized, ""},
+		{"signed with another secret", func(t *testing.T) *http.Request {
+			r := webhookRequest(t, failed)
+			r.Header.Set("X-Signature", payment.NewFakeGateway("guessed").Sign([]byte(`{}`)))
+			return r
+		}, http.StatusUnauthorized, ""},
+		{"body over 1MB", func(t *testing.T) *http.Request {
+			payload := bytes.Repeat([]byte(" "), maxWebhookBytes+1)
+			r := httptest.NewRequest(http.MethodPost, "/payments/webhook?provider=card", bytes.NewReader(payload))
+			r.Header.Set("X-Signature", payment.NewFakeGateway(webhookSecret).Sign(payload))
+			return r
+		}, http.StatusBadRequest, ""},
+		{"event ignored", func(t *testing.T) *http.Request {
+			return webhookRequest(t, &payment.Event{ID: "evt_refund", Type: "payment.refunded", AuthorizationID: auth})
+		}, http.StatusOK, "event ignored"},
+		{"unknown authorization", func(t *testing.T) *http.Request {
+			return webhookRequest(t, &payment.Event{ID: "evt_other", Type: payment.EventPaymentFailed, AuthorizationID: "auth_other"})
+		}, http.StatusNotFound, ""},
+		{"captured less than due", func(t *testing.T) *http.Request {
+			return webhookRequest(t, &payment.Event{ID: "evt_short", Type: payment.EventPaymentSucceeded, AuthorizationID: auth, Amount: models.NewMoney(2400, "USD")})
+		}, http.StatusUnprocessableEntity, ""},
+		{"captured in another currency", func(t *testing.T) *http.Request {
+			return webhookRequest(t, &payment.Event{ID: "evt_eur", Type: payment.EventPaymentSucceeded, AuthorizationID: auth, Amount: models.NewMoney(2500, "EUR")})
+		}, http.StatusUnprocessableEntity, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newWebhookStore(t, auth)
+			status, message := serveWebhook(t, tt.request(t))
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d", status, tt.status)
+			}
+			if message != tt.message {
+				t.Errorf("message = %q, want %q", message, tt.message)
+			}
+			if store.paymentUpdates != 0 || store.orderStatus != string(models.OrderPending) || len(store.events) != 0 {
+				t.Errorf("order changed to %s/%s by a rejected event", store.orderStatus, store.paymentStatus)
+			}
+		})
+	}
+}
+
+// the event that moves money: pending order becomes paid, gets invoiced and the buyer is emailed the invoice
+func TestPaymentWebhookCaptured(t *testing.T) {
+	payment.Register(payment.NewFakeGateway(webhookSecret))
+	store := newWebhookStore(t, "auth_1")
+	event := &payment.Event{ID: "evt_paid", Type: payment.EventPaymentSucceeded, AuthorizationID: "auth_1", Amount: models.NewMoney(2500, "USD")}
+
+	status, message := serveWebhook(t, webhookRequest(t, event))
+	if status != http.StatusOK || message != "event processed" {
+		t.Fatalf("webhook = %d %q, want %d %q", status, message, http.StatusOK, "event processed")
+	}
+	if store.orderStatus != string(models.OrderPaid) || store.paymentStatus != string(models.PaymentCaptured) {
+		t.Errorf("order = %s/%s, want %s/%s", store.orderStatus, store.paymentStatus, models.OrderPaid, models.PaymentCaptured)
+	}
+	if store.invoice == nil || store.invoice.number != 1 {
+		t.Fatalf("invoice = %+v, want number 1", store.invoice)
+	}
+	want := invoiceNumberOf(store.invoice)
+	if len(store.paidEmails) != 1 || store.paidEmails[0] != want {
+		t.Errorf("paid emails = %q, want [%q]", store.paidEmails, want)
+	}
+	if len(store.statusEmails) != 0 {
+		t.Errorf("status emails = %d, want 0, paid orders get the invoice email", len(store.statusEmails))
+	}
+}
+
+func invoiceNumberOf(invoice *webhookInvoice) string {
+	return "INV-" + invoice.issuedAt.Format("2006") + "-000001"
+}
+
+// providers retry until they see a 2xx, a replayed event must be acknowledged without being applied again
+func TestPaymentWebhookDuplicateEvent(t *testing.T) {
+	tests := []struct {
+		name          string
+		event         *payment.Event
+		orderStatus   models.OrderStatus
+		paymentStatus models.PaymentStatus
+	}{
+		{"captured", &payment.Event{ID: "evt_retry", Type: payment.EventPaymentSucceeded, AuthorizationID: "auth_1", Amount: models.NewMoney(2500, "USD")}, models.OrderPaid, models.PaymentCaptured},
+		{"failed", &payment.Event{ID: "evt_retry", Type: payment.EventPaymentFailed, AuthorizationID: "auth_1", Amount: models.NewMoney(2500, "USD")}, models.OrderCancelled, models.PaymentFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment.Register(payment.NewFakeGateway(webhookSecret))
+			store := newWebhookStore(t, "auth_1")
+
+			want := []string{"event processed", "event already processed", "event already processed"}
+			for i, message := range want {
+				status, got := serveWebhook(t, webhookRequest(t, tt.event))
+				if status != http.StatusOK || got != message {
+					t.Fatalf("delivery %d = %d %q, want %d %q", i+1, status, got, http.StatusOK, message)
+				}
+			}
+			if store.orderStatus != string(tt.orderStatus) || store.paymentStatus != string(tt.paymentStatus) {
+				t.Errorf("order = %s/%s, want %s/%s", store.orderStatus, store.paymentStatus, tt.orderStatus, tt.paymentStatus)
+			}
+			if store.paymentUpdates != 1 || store.counter > 1 {
+				t.Errorf("payment status written %d times and %d invoices numbered, want 1 and at most 1", store.paymentUpdates, store.counter)
+			}
+			if emails := len(store.statusEmails) + len(store.paidEmails); emails != 1 {
+				t.Errorf("buyer emailed %d times, want 1", emails)
+			}
+		})
+	}
+}
+
+// money captured for a cancelled order goes back to the buyer and the event is acknowledged
+func TestPaymentWebhookCapturedOnCancelledOrder(t *testing.T) {
+	gateway := payment.NewFakeGateway(webhookSecret)
+	auth := capturedPayment(t, gateway)
+	store := newWebhookStore(t, auth)
+	store.orderStatus = string(models.OrderCancelled)
+	event := &payment.Event{ID: "evt_late", Type: payment.EventPaymentSucceeded, AuthorizationID: auth, Amount: models.NewMoney(2500, "USD")}
+
+	want := []string{"order can no longer be paid, payment refunded", "event already processed"}
+	for i, message := range want {
+		status, got := serveWebhook(t, webhookRequest(t, event))
+		if status != http.StatusOK || got != message {
+			t.Fatalf("delivery %d = %d %q, want %d %q", i+1, status, got, http.StatusOK, message)
+		}
+	}
+	if store.orderStatus != string(models.OrderCancelled) || store.paymentStatus != string(models.PaymentRefunded) {
+		t.Errorf("order = %s/%s, want %s/%s", store.orderStatus, store.paymentStatus, models.OrderCancelled, models.PaymentRefunded)
+	}
+	if !store.events[event.ID] {
+		t.Errorf("event %s not recorded", event.ID)
+	}
+	//everything captured was given back, so even a cent more can't be refunded
+	if err := gateway.Refund(auth, models.NewMoney(1, "USD")); !errors.Is(err, payment.ErrInvalidAmount) {
+		t.Errorf("Refund() after webhook error = %v, want %v", err, payment.ErrInvalidAmount)
+	}
+	if store.invoice != nil || len(store.paidEmails)+len(store.statusEmails) != 0 {
+		t.Errorf("cancelled order was invoiced or emailed")
+	}
+}
+
+// a refund that fails answers 500 so the provider redelivers, the redelivery refunds
+func TestPaymentWebhookRefundRetried(t *testing.T) {
+	gateway := &flakyGateway{FakeGateway: payment.NewFakeGateway(webhookSecret), failRefund: true}
+	auth := capturedPayment(t, gateway)
+	store := newWebhookStore(t, auth)
+	store.orderStatus = string(models.OrderCancelled)
+	event := &payment.Event{ID: "evt_late", Type: payment.EventPaymentSucceeded, AuthorizationID: auth, Amount: models.NewMoney(2500, "USD")}
+
+	if status, _ := serveWebhook(t, webhookRequest(t, event)); status != http.StatusInternalServerError {
+		t.Fatalf("first delivery status = %d, want %d", status, http.StatusInternalServerError)
+	}
+	if store.paymentStatus != string(models.PaymentCaptured) {
+		t.Fatalf("payment status after failed refund = %s, want %s", store.paymentStatus, models.PaymentCaptured)
+	}
+
+	status, message := serveWebhook(t, webhookRequest(t, event))
+	if status != http.StatusOK || message != "order can no longer be paid, payment refunded" {
+		t.Fatalf("redelivery = %d %q, want %d refunded", status, message, http.StatusOK)
+	}
+	if store.paymentStatus != string(models.PaymentRefunded) {
+		t.Errorf("payment status = %s, want %s", store.paymentStatus, models.PaymentRefunded)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// write review failures to user
+func reviewError(w http.ResponseWriter, err error, action string) {
+	if pageError(w, err) {
+		return
+	}
+	var status int
+	var message string
+	switch {
+	case errors.Is(err, utils.ErrNoRecord):
+		status, message = http.StatusNotFound, "review or product not found"
+	case errors.Is(err, utils.ErrInvalidReview):
+		status, message = http.StatusBadRequest, err.Error()
+	case errors.Is(err, utils.ErrNotPurchased):
+		status, message = http.StatusForbidden, err.Error()
+	case errors.Is(err, utils.ErrExistingReview):
+		status, message = http.StatusConflict, err.Error()
+	default:
+		utils.ReplaceLogger.Error("failed to "+action, zap.Error(err))
+		status, message = http.StatusInternalServerError, "failed to "+action
+	}
+	response := map[string]interface{}{
+		"message": message,
+	}
+	http.Error(w, "", status)
+	apiResponse(response, w)
+}
+
+// review a product from a delivered order ##
+func PostReview(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request models.RequestReview
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	review, err := dataBase.AddReview(user.ID, request.ProductUUID, request.Rating, request.Body)
+	if err != nil {
+		reviewError(w, err, "post review")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "review posted succesfully",
+		"review":  review,
+	}
+	apiCreated(response, w)
+}
+
+// edit rating and text of user's own review ##
+func UpdateReview(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid review id", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RequestReview
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	review, err := dataBase.UpdateReview(user.ID, reviewID, request.Rating, request.Body)
+	if err != nil {
+		reviewError(w, err, "update review")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "review updated succesfully",
+		"review":  review,
+	}
+	apiResponse(response, w)
+}
+
+// reviews of every product including hidden ones, ?product_id= narrows it to one product --admin stuff
+func AdminGetReviews(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	reviews, page, err := dataBase.GetReviews(r.URL.Query().Get("product_id"), true, params)
+	if err != nil {
+		reviewError(w, err, "fetch reviews")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "reviews retrieved succesfully",
+		"reviews": reviews,
+		"page":    page,
+	}
+	apiResponse(response, w)
+}
+
+// hide or show a review --admin stuff
+func AdminModerateReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid review id", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RequestModerateReview
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	review, err := dataBase.ModerateReview(reviewID, request.Hidden)
+	if err != nil {
+		reviewError(w, err, "moderate review")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "review moderated succesfully",
+		"review":  review,
+	}
+	apiResponse(response, w)
+}
+
+// remove a review --admin stuff
+func AdminDeleteReview(w http.ResponseWriter, r *http.Request) {
+	reviewID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid review id", http.StatusBadRequest)
+		return
+	}
+
+	if err := dataBase.DeleteReview(reviewID); err != nil {
+		reviewError(w, err, "delete review")
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "review deleted succesfully",
+	}
+	apiResponse(response, w)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+// Middleware to require a permission on admin routes, roles are read from the token and resolved against the database
+func RequirePermission(permission string) func(http.Handler) http.Handler {
+	return utils.RequirePermission(permission, dataBase.RolesHavePermission)
+}
+
+// list roles and what they grant --admin stuff
+func AdminGetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := dataBase.GetRoles()
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to fetch roles", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fetch roles",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "roles retrieved succesfully",
+		"roles":   roles,
+	}
+	apiResponse(response, w)
+}
+
+// list users a page at a time, ?sort= is newest, oldest or email --admin stuff
+func AdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	params, err := pagination.FromRequest(r)
+	if pageError(w, err) {
+		return
+	}
+	users, page, err := dataBase.GetUsers(params)
+	if err != nil {
+		if pageError(w, err) {
+			return
+		}
+		utils.ReplaceLogger.Error("failed to fetch users", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to fetch users",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "users retrieved succesfully",
+		"users":   users,
+		"page":    page,
+	}
+	apiResponse(response, w)
+}
+
+// replace the roles of a user, takes effect on their next login --admin stuff
+func AdminSetUserRoles(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid user id", http.StatusBadRequest)
+		return
+	}
+
+	var request models.RequestUserRoles
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	roles, err := dataBase.SetUserRoles(userID, request.Roles)
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrNoRecord):
+			response := map[string]interface{}{
+				"message": "user not found",
+			}
+			http.Error(w, "", http.StatusNotFound)
+			apiResponse(response, w)
+		case errors.Is(err, utils.ErrUnknownRole):
+			response := map[string]interface{}{
+				"message": err.Error(),
+			}
+			http.Error(w, "", http.StatusBadRequest)
+			apiResponse(response, w)
+		default:
+			utils.ReplaceLogger.Error("failed to set user roles", zap.Error(err))
+			response := map[string]interface{}{
+				"message": "failed to set user roles",
+			}
+			http.Error(w, "", http.StatusInternalServerError)
+			apiResponse(response, w)
+		}
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "user roles updated succesfully",
+		"roles":   roles,
+	}
+	apiResponse(response, w)
+}
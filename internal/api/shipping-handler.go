@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/h3th-IV/mysticMerch/internal/database"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/shipping"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+func init() {
+	//local carrier reads its rate tables from the database on every quote
+	shipping.Register(shipping.NewLocalCarrier(func() ([]*models.ShippingZone, error) {
+		return dataBase.GetShippingZones()
+	}))
+}
+
+// prices shipping with the carrier and method picked at checkout
+func quoteShipping(checkout *models.CheckoutRequest) database.QuoteFunc {
+	return func(parcel *models.Parcel) (*models.ShippingQuote, error) {
+		return shipping.Quote(checkout.ShippingCarrier, checkout.ShippingMethod, parcel)
+	}
+}
+
+// shipping rates for user cart, address_id and carrier query params are optional ##
+func ShippingQuote(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	addressID := 0
+	if raw := r.URL.Query().Get("address_id"); raw != "" {
+		if addressID, err = strconv.Atoi(raw); err != nil {
+			http.Error(w, "invalid address id", http.StatusBadRequest)
+			return
+		}
+	}
+	carriers := shipping.Carriers()
+	if name := r.URL.Query().Get("carrier"); name != "" {
+		carrier, err := shipping.Lookup(name)
+		if err != nil {
+			checkoutError(w, err)
+			return
+		}
+		carriers = []shipping.ShippingCarrier{carrier}
+	}
+
+	parcel, coupon, err := dataBase.CartParcel(user.ID, addressID)
+	if err != nil {
+		checkoutError(w, err)
+		return
+	}
+
+	quotes := []*models.ShippingQuote{}
+	for _, carrier := range carriers {
+		rates, err := carrier.Rates(parcel)
+		if err != nil {
+			//one carrier failing or not covering the address leaves the others
+			if !errors.Is(err, utils.ErrNoShippingRate) {
+				utils.ReplaceLogger.Error("failed to get shipping rates", zap.String("carrier", carrier.Name()), zap.Error(err))
+			}
+			continue
+		}
+		for _, rate := range rates {
+			quote := *rate
+			if coupon != nil && coupon.FreeShipping {
+				quote.Cost = models.NewMoney(0, quote.Cost.Currency)
+			}
+			quotes = append(quotes, &quote)
+		}
+	}
+	if len(quotes) == 0 {
+		checkoutError(w, utils.ErrNoShippingRate)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":      "shipping rates retrieved succesfully",
+		"weight_grams": parcel.Weight,
+		"rates":        quotes,
+	}
+	apiResponse(response, w)
+}
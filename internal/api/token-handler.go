@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+func init() {
+	//JWTAuthRoutes checks every token id against the revocation list
+	utils.TokenRevoked = dataBase.IsTokenRevoked
+}
+
+// access token and a fresh refresh token family for user, users holding a role get an admin token
+func issueTokens(user *models.User) (string, string, error) {
+	refreshToken, err := dataBase.CreateRefreshToken(user.ID, utils.RefreshTokenTTL)
+	if err != nil {
+		return "", "", err
+	}
+	JWToken, err := accessToken(user)
+	if err != nil {
+		return "", "", err
+	}
+	return JWToken, refreshToken, nil
+}
+
+func accessToken(user *models.User) (string, error) {
+	tokens := utils.UserTokens()
+	if len(user.Roles) > 0 {
+		tokens = utils.AdminTokens()
+	}
+	JWToken, _, err := tokens.Issue(user)
+	return JWToken, err
+}
+
+// swap refresh token for a new access and refresh token ##
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if err := utils.LoadEnv(); err != nil {
+		utils.ReplaceLogger.Error("failed to load env variables", zap.Error(err))
+		http.Error(w, "operation Failed", http.StatusInternalServerError)
+		return
+	}
+
+	var request models.RequestRefreshToken
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.RefreshToken == "" {
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	userID, refreshToken, err := dataBase.RotateRefreshToken(request.RefreshToken, utils.RefreshTokenTTL)
+	if err != nil {
+		if errors.Is(err, utils.ErrTokenReused) {
+			utils.ReplaceLogger.Warn("refresh token reused, token family revoked")
+		}
+		if errors.Is(err, utils.ErrInvalidToken) || errors.Is(err, utils.ErrTokenReused) {
+			response := map[string]interface{}{
+				"message": "refresh token is invalid or expired",
+			}
+			http.Error(w, "", http.StatusUnauthorized)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to rotate refresh token", zap.Error(err))
+		http.Error(w, "error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	//roles are read again so changes show up on the next refresh
+	user, err := dataBase.GetTokenUser(userID)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to retrieve token user", zap.Error(err))
+		http.Error(w, "error generating token", http.StatusInternalServerError)
+		return
+	}
+	JWToken, err := accessToken(user)
+	if err != nil {
+		utils.ReplaceLogger.Error("err generating token", zap.Error(err))
+		http.Error(w, "error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "token refreshed succesfully",
+		"jwToken":       JWToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	}
+	apiResponse(response, w)
+}
+
+// revoke the access token used for the request and the refresh token sent with it ##
+func LogOut(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	//refresh token is optional, without it only the access token is revoked
+	var request models.RequestRefreshToken
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "failed to decode json object", http.StatusBadRequest)
+			return
+		}
+	}
+	defer r.Body.Close()
+
+	//revoked until the token would have expired anyway
+	claims := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if err := dataBase.RevokeAccessToken(claims.Id, time.Until(time.Unix(claims.ExpiresAt, 0))+time.Minute); err != nil {
+		utils.ReplaceLogger.Error("failed to revoke access token", zap.Error(err))
+		http.Error(w, "failed to log out", http.StatusInternalServerError)
+		return
+	}
+	if request.RefreshToken != "" {
+		if err := dataBase.RevokeRefreshToken(user.ID, request.RefreshToken); err != nil {
+			utils.ReplaceLogger.Error("failed to revoke refresh token", zap.Error(err))
+			http.Error(w, "failed to log out", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]interface{}{
+		"message": "logged out succesfully",
+	}
+	apiResponse(response, w)
+}
@@ -1,5 +1,218 @@
 package api
 
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
 func Test() {
 
 }
+
+// check password of the account with email, reports if it matched
+func passwordMatches(email, password string) (*models.User, bool) {
+	user, err := dataBase.AuthenticateUser(email)
+	if err != nil {
+		utils.ReplaceLogger.Error("unable to retrieve user details", zap.Error(err))
+		return nil, false
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return nil, false
+	}
+	return user, true
+}
+
+// profile of logged in user ##
+func GetProfile(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "user profile retrieved succesfully",
+		"user":    user,
+	}
+	apiResponse(response, w)
+}
+
+// change name or phone number of logged in user ##
+func UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request models.RequestUpdateProfile
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if (request.FirstName != nil && !utils.ValidateFirstName(*request.FirstName)) ||
+		(request.LastName != nil && !utils.ValidateLastName(*request.LastName)) ||
+		(request.PhoneNumber != nil && strings.TrimSpace(*request.PhoneNumber) == "") {
+		http.Error(w, "failed to validate user details", http.StatusBadRequest)
+		return
+	}
+
+	if err := dataBase.UpdateUserProfile(user.ID, request.FirstName, request.LastName, request.PhoneNumber); err != nil {
+		utils.ReplaceLogger.Error("failed to update user profile", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to update user profile",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+	if request.FirstName != nil {
+		user.FirstName = *request.FirstName
+	}
+	if request.LastName != nil {
+		user.LastName = *request.LastName
+	}
+	if request.PhoneNumber != nil {
+		user.PhoneNumber = *request.PhoneNumber
+	}
+
+	response := map[string]interface{}{
+		"message": "user profile updated succesfully",
+		"user":    user,
+	}
+	apiResponse(response, w)
+}
+
+// change password of logged in user, other sessions are signed out ##
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request models.RequestChangePassword
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	account, ok := passwordMatches(user.Email, request.CurrentPassword)
+	if !ok {
+		http.Error(w, "password is incorrect", http.StatusUnauthorized)
+		return
+	}
+	if !utils.ValidatePassword(request.NewPassword) {
+		http.Error(w, "failed to validate password", http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(request.NewPassword)
+	if err == nil {
+		err = dataBase.ChangePassword(user.ID, passwordHash)
+	}
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to change password", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to change password",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	//refresh tokens were all revoked, this session gets a new pair
+	JWToken, refreshToken, err := issueTokens(account)
+	if err != nil {
+		utils.ReplaceLogger.Error("err generating token", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "password changed succesfully, log in again",
+		}
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "password changed succesfully",
+		"jwToken":       JWToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+	}
+	apiResponse(response, w)
+}
+
+// delete logged in user along with everything tied to the account ##
+func DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	var request models.RequestDeleteAccount
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		utils.ReplaceLogger.Error("failed to decode json", zap.Error(err))
+		http.Error(w, "failed to decode json object", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//password is asked again, a stolen access token should not be enough to wipe an account
+	if _, ok := passwordMatches(user.Email, request.Password); !ok {
+		http.Error(w, "password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	//cart, addresses, finished orders and tokens go with the user through on delete cascade, invoices stay
+	if err := dataBase.RemoveUser(user.ID); err != nil {
+		if errors.Is(err, utils.ErrOpenOrders) {
+			response := map[string]interface{}{
+				"message": "account has orders that are not yet delivered or cancelled",
+			}
+			http.Error(w, "", http.StatusConflict)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to delete user account", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to delete user account",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	claims := r.Context().Value(utils.ClaimsKey).(*utils.Claims)
+	if err := dataBase.RevokeAccessToken(claims.Id, time.Until(time.Unix(claims.ExpiresAt, 0))+time.Minute); err != nil {
+		utils.ReplaceLogger.Error("failed to revoke access token", zap.Error(err))
+	}
+	emailSent := true
+	if err := admin.AccountDeletedEmail(user); err != nil {
+		utils.ReplaceLogger.Error("failed to send account deletion email", zap.Error(err))
+		emailSent = false
+	}
+
+	response := map[string]interface{}{
+		"message":    "user account deleted succesfully",
+		"email_sent": emailSent,
+	}
+	apiResponse(response, w)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/admin"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"go.uber.org/zap"
+)
+
+const (
+	verifyEmailTTL = 24 * time.Hour
+	//at most maxResends verification emails per resendWindow, and one per resendCooldown
+	maxResends     = 3
+	resendWindow   = time.Hour
+	resendCooldown = time.Minute
+)
+
+// absolute link to path on this api, APP_URL is the public url it is served from
+func appLink(path string, query url.Values) string {
+	base := strings.TrimRight(os.Getenv("APP_URL"), "/")
+	if base == "" {
+		base = "http://localhost:8000"
+	}
+	return base + path + "?" + query.Encode()
+}
+
+// issue a verification token and email the link to user
+func sendVerification(user *models.ResponseUser) error {
+	token, err := dataBase.CreateUserToken(user.ID, models.TokenVerifyEmail, verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return admin.VerificationEmail(user, appLink("/verify-email", url.Values{"token": {token}}), verifyEmailTTL)
+}
+
+// write 403 for users who have not verified their email yet, reports if user was blocked
+func requireVerified(w http.ResponseWriter, user *models.ResponseUser) bool {
+	if user.EmailVerified {
+		return false
+	}
+	response := map[string]interface{}{
+		"message": "verify your email address before checking out",
+	}
+	http.Error(w, "", http.StatusForbidden)
+	apiResponse(response, w)
+	return true
+}
+
+// confirm email address from the emailed link ##
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing verification token", http.StatusBadRequest)
+		return
+	}
+
+	if err := dataBase.VerifyEmail(token); err != nil {
+		if errors.Is(err, utils.ErrInvalidToken) {
+			response := map[string]interface{}{
+				"message": "verification link is invalid or expired",
+			}
+			http.Error(w, "", http.StatusBadRequest)
+			apiResponse(response, w)
+			return
+		}
+		utils.ReplaceLogger.Error("failed to verify email", zap.Error(err))
+		response := map[string]interface{}{
+			"message": "failed to verify email",
+		}
+		http.Error(w, "", http.StatusInternalServerError)
+		apiResponse(response, w)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "email verified succesfully",
+	}
+	apiResponse(response, w)
+}
+
+// send a new verification link to the logged in user ##
+func ResendVerification(w http.ResponseWriter, r *http.Request) {
+	uuid := r.Context().Value(utils.UserIDkey).(string)
+	user, err := dataBase.GetUserbyUUID(uuid)
+	if err != nil {
+		http.Error(w, "user possibly not authenticated", http.StatusUnauthorized)
+		return
+	}
+	if user.EmailVerified {
+		response := map[string]interface{}{
+			"message": "email address is already verified",
+		}
+		http.Error(w, "", http.StatusConflict)
+		apiResponse(response, w)
+		return
+	}
+
+	sent, since, err := dataBase.RecentUserTokens(user.ID, models.TokenVerifyEmail, resendWindow)
+	if err != nil {
+		utils.ReplaceLogger.Error("failed to check verification emails", zap.Error(err))
+		http.Error(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+	var wait time.Duration
+	switch {
+	case sent >= maxResends:
+		wait = resendWindow - since
+	case since < resendCooldown:
+		wait = resendCooldown - since
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+		response := map[string]interface{}{
+			"message": "too many verification emails, try again later",
+		}
+		http.Error(w, "", http.StatusTooManyRequests)
+		apiResponse(response, w)
+		return
+	}
+
+	if err := sendVerification(user); err != nil {
+		utils.ReplaceLogger.Error("failed to send verification email", zap.Error(err))
+		http.Error(w, "failed to send verification email", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "verification email sent",
+	}
+	apiResponse(response, w)
+}
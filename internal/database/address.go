@@ -0,0 +1,293 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* address operations */
+
+// columns scanAddress expects
+const addressColumns = `address_id, coalesce(house_no, ''), coalesce(street, ''), coalesce(city, ''), region, coalesce(postal_code, ''), country, default_shipping, default_billing`
+
+func scanAddress(row rowScanner) (*models.Address, error) {
+	addr := &models.Address{}
+	err := row.Scan(&addr.AddressID, &addr.HouseNo, &addr.Street, &addr.City, &addr.Region, &addr.PostalCode, &addr.Country, &addr.DefaultShipping, &addr.DefaultBilling)
+	if err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// create new address
+func NewAddress(user *models.ResponseUser, houseNo, str, city, region, postalCode, country string) *models.Address {
+	return &models.Address{
+		HouseNo:     houseNo,
+		Street:      str,
+		City:        city,
+		Region:      region,
+		PostalCode:  postalCode,
+		Country:     country,
+		UserPhoneNo: user.PhoneNumber,
+	}
+}
+
+// tidy up address fields and check postal code against the country
+func validateAddress(addr *models.Address) error {
+	addr.HouseNo = strings.TrimSpace(addr.HouseNo)
+	addr.Street = strings.TrimSpace(addr.Street)
+	addr.City = strings.TrimSpace(addr.City)
+	addr.Region = strings.TrimSpace(addr.Region)
+	addr.PostalCode = strings.ToUpper(strings.TrimSpace(addr.PostalCode))
+	addr.Country = strings.ToUpper(strings.TrimSpace(addr.Country))
+	if addr.Street == "" || addr.City == "" {
+		return utils.ErrInvalidAddress
+	}
+	if !utils.ValidatePostalCode(addr.Country, addr.PostalCode) {
+		return utils.ErrInvalidAddress
+	}
+	return nil
+}
+
+// make addressID the only default shipping and/or billing address of user, caller owns the transaction
+func setDefaultAddress(tx *sql.Tx, userID, addressID int, shipping, billing bool) error {
+	if shipping {
+		if _, err := tx.Exec(`update address set default_shipping = (address_id = ?) where user_id = ?`, addressID, userID); err != nil {
+			return err
+		}
+	}
+	if billing {
+		if _, err := tx.Exec(`update address set default_billing = (address_id = ?) where user_id = ?`, addressID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// register new address, a user's first address becomes their default shipping and billing address
+func (dm *DBModel) AddUserAddress(user *models.ResponseUser, addr *models.Address) (*models.Address, error) {
+	if err := validateAddress(addr); err != nil {
+		return nil, err
+	}
+	query := `insert into address(user_id, house_no, street, city, region, postal_code, country) values(?, ?, ?, ?, ?, ?, ?)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	//lock user's addresses so two first addresses can't both become default
+	var hasDefaultShipping, hasDefaultBilling bool
+	err = tx.QueryRow(`select coalesce(max(default_shipping), false), coalesce(max(default_billing), false) from address where user_id = ? for update`, user.ID).Scan(&hasDefaultShipping, &hasDefaultBilling)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	result, err := stmt.Exec(user.ID, addr.HouseNo, addr.Street, addr.City, addr.Region, addr.PostalCode, addr.Country)
+	if err != nil {
+		return nil, err
+	}
+	addressID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	addr.AddressID = int(addressID)
+	addr.DefaultShipping = addr.DefaultShipping || !hasDefaultShipping
+	addr.DefaultBilling = addr.DefaultBilling || !hasDefaultBilling
+	if err := setDefaultAddress(tx, user.ID, addr.AddressID, addr.DefaultShipping, addr.DefaultBilling); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// change a saved address of user, defaults can be moved to it but not cleared from it
+func (dm *DBModel) UpdateUserAddress(userID int, addr *models.Address) error {
+	if err := validateAddress(addr); err != nil {
+		return err
+	}
+	query := `update address set house_no = ?, street = ?, city = ?, region = ?, postal_code = ?, country = ? where address_id = ? and user_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`select count(*) > 0 from address where address_id = ? and user_id = ? for update`, addr.AddressID, userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return utils.ErrNoRecord
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(addr.HouseNo, addr.Street, addr.City, addr.Region, addr.PostalCode, addr.Country, addr.AddressID, userID); err != nil {
+		return err
+	}
+	if err := setDefaultAddress(tx, userID, addr.AddressID, addr.DefaultShipping, addr.DefaultBilling); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// return user addresses
+func (dm *DBModel) ReturnUserAddress(userID int) ([]*models.Address, error) {
+	query := `select ` + addressColumns + ` from address where user_id = ? order by address_id`
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var UserAddrs []*models.Address
+	for rows.Next() {
+		useraddr, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		UserAddrs = append(UserAddrs, useraddr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return UserAddrs, nil
+}
+
+// reomve address
+func (dm *DBModel) RemoveAddress(userID, address_id int) error {
+	query := `delete from address where address_id = ? and user_id = ? `
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	result, err := stmt.Exec(address_id, userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return utils.ErrNoRecord
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// saved address of user by id, or their default when addressID is 0.
+// column picks the default, default_shipping or default_billing. caller owns the transaction
+func userAddress(tx *sql.Tx, userID, addressID int, column string) (*models.Address, error) {
+	query := `select ` + addressColumns + ` from address where user_id = ? and address_id = ?`
+	args := []interface{}{userID, addressID}
+	if addressID == 0 {
+		query = `select ` + addressColumns + ` from address where user_id = ? and ` + column + ` = true`
+		args = args[:1]
+	}
+	addr, err := scanAddress(tx.QueryRow(query, args...))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return addr, nil
+}
+
+// shipping and billing address for an order, billing falls back to the shipping address
+func orderAddresses(tx *sql.Tx, userID, shippingID, billingID int) (*models.Address, *models.Address, error) {
+	shipping, err := userAddress(tx, userID, shippingID, "default_shipping")
+	if err != nil {
+		return nil, nil, err
+	}
+	if shipping == nil {
+		if shippingID != 0 {
+			return nil, nil, utils.ErrUnknownAddress
+		}
+		return nil, nil, utils.ErrAddressRequired
+	}
+	billing, err := userAddress(tx, userID, billingID, "default_billing")
+	if err != nil {
+		return nil, nil, err
+	}
+	if billing == nil {
+		if billingID != 0 {
+			return nil, nil, utils.ErrUnknownAddress
+		}
+		billing = shipping
+	}
+	return shipping, billing, nil
+}
+
+// address as stored on an order, nil stays null
+func addressJSON(addr *models.Address) (interface{}, error) {
+	if addr == nil {
+		return nil, nil
+	}
+	return json.Marshal(addr)
+}
+
+// address stored on an order
+func parseAddressJSON(raw []byte) (*models.Address, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	addr := &models.Address{}
+	if err := json.Unmarshal(raw, addr); err != nil {
+		return nil, err
+	}
+	return addr, nil
+}
+
+// fill in the addresses copied onto an order
+func orderAddressesFromJSON(order *models.Order, shipping, billing []byte) error {
+	var err error
+	if order.ShippingAddress, err = parseAddressJSON(shipping); err != nil {
+		return err
+	}
+	if order.BillingAddress, err = parseAddressJSON(billing); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,13 +4,15 @@ import (
 	"fmt"
 
 	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
 )
 
 /* cart operations */
 
 // view user cart
 func (dm *DBModel) GetUserCart(userID int) ([]*models.ResponseCartProducts, error) {
-	query := `select product_name, price, rating, image, quantity, color, size from carts where user_id = ?`
+	query := `select product_id, product_name, price, currency, rating, image, quantity, color, size from carts where user_id = ?`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -34,7 +36,7 @@ func (dm *DBModel) GetUserCart(userID int) ([]*models.ResponseCartProducts, erro
 	for rows.Next() {
 		//initialize pointer first
 		userProducts := &models.ResponseCartProducts{}
-		err := rows.Scan(&userProducts.ProductName, &userProducts.Price, &userProducts.Rating, &userProducts.Image, &userProducts.Quantity, &userProducts.Color, &userProducts.Size)
+		err := rows.Scan(&userProducts.ProductID, &userProducts.ProductName, &userProducts.Price.Amount, &userProducts.Price.Currency, &userProducts.Rating, &userProducts.Image, &userProducts.Quantity, &userProducts.Color, &userProducts.Size)
 		if err != nil {
 			return nil, err
 		}
@@ -47,9 +49,76 @@ func (dm *DBModel) GetUserCart(userID int) ([]*models.ResponseCartProducts, erro
 	return userCart, nil
 }
 
+// sorts of a user's cart, most recently added first unless asked otherwise
+var cartKeyset = &pagination.Keyset{
+	ID: "cart_id",
+	Sorts: map[string]pagination.Sort{
+		"newest": {Desc: true},
+		"oldest": {},
+	},
+	Default: "newest",
+}
+
+// cart item along with the row id it is paged by
+type cartRow struct {
+	id   int64
+	item *models.ResponseCartProducts
+}
+
+// view a page of user cart, GetUserCart is the whole cart for totals and checkout
+func (dm *DBModel) GetUserCartPage(userID int, params pagination.Params) ([]*models.ResponseCartProducts, *models.Page, error) {
+	q, err := cartKeyset.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	where, args := q.Where()
+	query := `select cart_id, product_id, product_name, price, currency, rating, image, quantity, color, size from carts
+	where user_id = ? and ` + where + ` order by ` + q.OrderBy() + ` limit ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query, append(append([]interface{}{userID}, args...), q.Limit())...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var Rows []cartRow
+	for rows.Next() {
+		row := cartRow{item: &models.ResponseCartProducts{}}
+		item := row.item
+		if err := rows.Scan(&row.id, &item.ProductID, &item.ProductName, &item.Price.Amount, &item.Price.Currency, &item.Rating, &item.Image, &item.Quantity, &item.Color, &item.Size); err != nil {
+			return nil, nil, err
+		}
+		Rows = append(Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	Rows, page := pagination.Trim(q, Rows, func(row cartRow) (interface{}, int64) {
+		return nil, row.id
+	})
+	userCart := make([]*models.ResponseCartProducts, len(Rows))
+	for i, row := range Rows {
+		userCart[i] = row.item
+	}
+	return userCart, page, nil
+}
+
 // add product to user cart
 func (dm *DBModel) AddProductoCart(userID, quantity int, productUUID string, color, size string) error {
-	query := `insert into carts(user_id, product_id, product_name, description, price, rating, image, quantity, color, size) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	query := `insert into carts(user_id, product_id, product_name, description, price, currency, rating, image, quantity, color, size) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	if quantity < 1 {
+		return utils.ErrInvalidQuantity
+	}
 	//retrive product info
 	product, err := dm.GetProduct(productUUID)
 	if err != nil {
@@ -58,6 +127,11 @@ func (dm *DBModel) AddProductoCart(userID, quantity int, productUUID string, col
 	if product == nil {
 		return fmt.Errorf("product with uuid, %v not found", productUUID)
 	}
+	//color/size must be one the product comes in
+	variant, err := dm.GetVariant(productUUID, color, size)
+	if err != nil {
+		return err
+	}
 	tx, err := dm.DB.Begin()
 	if err != nil {
 		return err
@@ -69,10 +143,15 @@ func (dm *DBModel) AddProductoCart(userID, quantity int, productUUID string, col
 	}
 	defer stmt.Close()
 	fmt.Println(product.ProductID)
-	_, err = stmt.Exec(userID, product.ProductID, product.ProductName, product.Description, product.Price, product.Rating, product.Image, quantity, color, size)
+	price := variantPrice(variant, product)
+	_, err = stmt.Exec(userID, product.ProductID, product.ProductName, product.Description, price.Amount, price.Currency, product.Rating, product.Image, quantity, color, size)
 	if err != nil {
 		return err
 	}
+	//hold stock for the item, fails when there isn't enough left
+	if err := reserveCartStock(tx, userID, product.ProductID, color, size); err != nil {
+		return err
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -104,8 +183,17 @@ func (dm *DBModel) CheckProductExistInUserCart(userid int, productUUID string) (
 }
 
 // Edit cart item; quantity, size, color e.t.c
-func (dm *DBModel) EditCartItem(userId, productID, quantity int, color, size string) error {
-	query := `update carts set quantity = quantity + ?, color = ?, size = ? where user_id = ? and product_id = ?`
+func (dm *DBModel) EditCartItem(userId int, productUUID string, quantity int, color, size string) error {
+	query := `update carts set quantity = quantity + ?, color = ?, size = ?, price = ?, currency = ? where user_id = ? and product_id = ?`
+
+	product, err := dm.GetProduct(productUUID)
+	if err != nil {
+		return err
+	}
+	variant, err := dm.GetVariant(productUUID, color, size)
+	if err != nil {
+		return err
+	}
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -118,10 +206,22 @@ func (dm *DBModel) EditCartItem(userId, productID, quantity int, color, size str
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(quantity, color, size, userId, productID)
+	//price and currency go together, the product may have been repriced in another currency
+	price := variantPrice(variant, product)
+	_, err = stmt.Exec(quantity, color, size, price.Amount, price.Currency, userId, productUUID)
 	if err != nil {
 		return err
 	}
+	//move the hold over to the new color/size and quantity
+	if err := releaseProductStock(tx, userId, productUUID); err != nil {
+		return err
+	}
+	if err := reserveCartStock(tx, userId, productUUID, color, size); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -149,6 +249,9 @@ func (dm *DBModel) RemoveItemfromCart(userid int, productID string) error {
 	if err != nil {
 		return err
 	}
+	if err := releaseProductStock(tx, userid, productID); err != nil {
+		return err
+	}
 	if err = tx.Commit(); err != nil {
 		return err
 	}
@@ -157,7 +260,7 @@ func (dm *DBModel) RemoveItemfromCart(userid int, productID string) error {
 
 // retrive item from cart
 func (dm *DBModel) GetItemFromCart(userId, productID int) (*models.ResponseProduct, error) {
-	query := `select product_name, description, price, rating, image from carts where user_id = ? and product_id = ?`
+	query := `select product_name, description, price, currency, rating, image from carts where user_id = ? and product_id = ?`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -174,7 +277,7 @@ func (dm *DBModel) GetItemFromCart(userId, productID int) (*models.ResponseProdu
 	row := stmt.QueryRow(userId, productID)
 	item := &models.ResponseProduct{}
 
-	err = row.Scan(&item.ProductName, &item.Description, &item.Price, &item.Rating, &item.Image)
+	err = row.Scan(&item.ProductName, &item.Description, &item.Price.Amount, &item.Price.Currency, &item.Rating, &item.Image)
 	if err != nil {
 		return nil, err
 	}
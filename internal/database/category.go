@@ -0,0 +1,397 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* category operations */
+
+// every category as a flat list, caller owns the transaction
+func allCategories(tx *sql.Tx) ([]*models.Category, error) {
+	rows, err := tx.Query(`select category_id, parent_id, name, slug, featured from categories order by name, category_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Categories []*models.Category
+	for rows.Next() {
+		category := &models.Category{}
+		var parentID sql.NullInt64
+		if err := rows.Scan(&category.CategoryID, &parentID, &category.Name, &category.Slug, &category.Featured); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			parent := int(parentID.Int64)
+			category.ParentID = &parent
+		}
+		Categories = append(Categories, category)
+	}
+	return Categories, rows.Err()
+}
+
+// ids of category rootID and everything below it
+func categorySubtree(categories []*models.Category, rootID int) []int {
+	children := make(map[int][]int)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.CategoryID)
+		}
+	}
+	ids := []int{rootID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	return ids
+}
+
+// ids of categories by slug along with all their subcategories, unknown slugs are ErrNoRecord.
+// caller owns the transaction
+func categoryIDsWithSubtree(tx *sql.Tx, slugs []string) ([]int, error) {
+	categories, err := allCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+	bySlug := make(map[string]int, len(categories))
+	for _, category := range categories {
+		bySlug[category.Slug] = category.CategoryID
+	}
+	seen := make(map[int]bool)
+	var ids []int
+	for _, slug := range slugs {
+		rootID, ok := bySlug[slug]
+		if !ok {
+			return nil, utils.ErrNoRecord
+		}
+		for _, id := range categorySubtree(categories, rootID) {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// "?, ?, ?" with args for an in clause
+func inClause(ids []int) (string, []interface{}) {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", "), args
+}
+
+// page of the products linked to any of the categories, caller owns the transaction
+func categoriesProducts(tx *sql.Tx, categoryIDs []int, q *pagination.Query) ([]*models.ResponseProduct, *models.Page, error) {
+	if len(categoryIDs) == 0 {
+		return productPage(tx, "false", nil, q)
+	}
+	placeholders, args := inClause(categoryIDs)
+	return productPage(tx, `p.product_id in (select product_id from product_categories where category_id in (`+placeholders+`))`, args, q)
+}
+
+// uuids of products in categories, subcategories included. caller owns the transaction
+func categoryProductIDs(tx *sql.Tx, slugs []string) ([]string, error) {
+	ids, err := categoryIDsWithSubtree(tx, slugs)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	placeholders, args := inClause(ids)
+	rows, err := tx.Query(`select distinct product_id from product_categories where category_id in (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Products []string
+	for rows.Next() {
+		var productID string
+		if err := rows.Scan(&productID); err != nil {
+			return nil, err
+		}
+		Products = append(Products, productID)
+	}
+	return Products, rows.Err()
+}
+
+// categories as a tree of top level categories
+func (dm *DBModel) GetCategoryTree() ([]*models.Category, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	categories, err := allCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int]*models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.CategoryID] = category
+	}
+	Tree := []*models.Category{}
+	for _, category := range categories {
+		if category.ParentID == nil {
+			Tree = append(Tree, category)
+			continue
+		}
+		if parent, ok := byID[*category.ParentID]; ok {
+			parent.Children = append(parent.Children, category)
+		}
+	}
+	return Tree, nil
+}
+
+// tidy up name and slug of a category, slug comes from the name when left out
+func validateCategory(category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	category.Slug = strings.TrimSpace(category.Slug)
+	if category.Slug == "" {
+		category.Slug = utils.Slugify(category.Name)
+	}
+	if category.Name == "" || !utils.ValidateSlug(category.Slug) {
+		return utils.ErrInvalidCategory
+	}
+	return nil
+}
+
+// check parent of a category exists and is not the category or one of its subcategories, caller owns the transaction
+func checkCategoryParent(tx *sql.Tx, categoryID int, parentID *int) error {
+	if parentID == nil {
+		return nil
+	}
+	categories, err := allCategories(tx)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, category := range categories {
+		if category.CategoryID == *parentID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return utils.ErrNoRecord
+	}
+	//a new category has no subtree yet
+	if categoryID == 0 {
+		return nil
+	}
+	for _, id := range categorySubtree(categories, categoryID) {
+		if id == *parentID {
+			return utils.ErrInvalidCategory
+		}
+	}
+	return nil
+}
+
+// add a category to the tree --admin stuff
+func (dm *DBModel) CreateCategory(category *models.Category) (*models.Category, error) {
+	if err := validateCategory(category); err != nil {
+		return nil, err
+	}
+	query := `insert into categories(parent_id, name, slug, featured) values(?, ?, ?, ?)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := checkCategoryParent(tx, 0, category.ParentID); err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(category.ParentID, category.Name, category.Slug, category.Featured)
+	if err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return nil, utils.ErrExistingCategory
+		}
+		return nil, err
+	}
+	categoryID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	category.CategoryID = int(categoryID)
+	category.Children = nil
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// rename, move or (un)feature a category --admin stuff
+func (dm *DBModel) UpdateCategory(category *models.Category) error {
+	if err := validateCategory(category); err != nil {
+		return err
+	}
+	query := `update categories set parent_id = ?, name = ?, slug = ?, featured = ? where category_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//whole tree is locked so two moves can't make a loop together
+	var exists bool
+	if err := tx.QueryRow(`select coalesce(max(category_id = ?), false) from categories for update`, category.CategoryID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return utils.ErrNoRecord
+	}
+	if err := checkCategoryParent(tx, category.CategoryID, category.ParentID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(category.ParentID, category.Name, category.Slug, category.Featured, category.CategoryID); err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return utils.ErrExistingCategory
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete a category, its subcategories move up to its parent --admin stuff
+func (dm *DBModel) DeleteCategory(categoryID int) error {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var parentID sql.NullInt64
+	err = tx.QueryRow(`select parent_id from categories where category_id = ? for update`, categoryID).Scan(&parentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.ErrNoRecord
+		}
+		return err
+	}
+	if _, err := tx.Exec(`update categories set parent_id = ? where parent_id = ?`, parentID, categoryID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`delete from categories where category_id = ?`, categoryID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// replace the categories a product is listed under --admin stuff
+func (dm *DBModel) SetProductCategories(productUUID string, slugs []string) error {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`select count(*) > 0 from products where product_id = ?`, productUUID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return utils.ErrNoRecord
+	}
+	if _, err := tx.Exec(`delete from product_categories where product_id = ?`, productUUID); err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(`insert into product_categories(product_id, category_id) select ?, category_id from categories where slug = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	seen := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result, err := stmt.Exec(productUUID, slug)
+		if err != nil {
+			return err
+		}
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			return utils.ErrNoRecord
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// category by slug and a page of the products in it or any of its subcategories
+func (dm *DBModel) GetCategoryProducts(slug string, params pagination.Params) (*models.Category, []*models.ResponseProduct, *models.Page, error) {
+	q, err := productKeyset.Query(params)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer tx.Rollback()
+
+	categories, err := allCategories(tx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var category *models.Category
+	for _, c := range categories {
+		if c.Slug == slug {
+			category = c
+			break
+		}
+	}
+	if category == nil {
+		return nil, nil, nil, utils.ErrNoRecord
+	}
+	for _, c := range categories {
+		if c.ParentID != nil && *c.ParentID == category.CategoryID {
+			category.Children = append(category.Children, c)
+		}
+	}
+
+	Products, page, err := categoriesProducts(tx, categorySubtree(categories, category.CategoryID), q)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, nil, err
+	}
+	return category, Products, page, nil
+}
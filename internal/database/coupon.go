@@ -0,0 +1,567 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* coupon operations */
+
+// columns scanCoupon expects, c is coupons
+const couponColumns = `c.coupon_id, c.code, c.kind, c.percent, c.amount, c.min_spend, c.currency, c.per_user_limit, c.starts_at, c.ends_at, c.active`
+
+func scanCoupon(row rowScanner) (*models.Coupon, error) {
+	coupon := &models.Coupon{}
+	var currency string
+	var startsAt, endsAt sql.NullTime
+	var active bool
+	err := row.Scan(&coupon.CouponID, &coupon.Code, &coupon.Kind, &coupon.Percent, &coupon.Amount.Amount, &coupon.MinSpend.Amount, &currency, &coupon.PerUserLimit, &startsAt, &endsAt, &active)
+	if err != nil {
+		return nil, err
+	}
+	coupon.Active = &active
+	coupon.Amount.Currency = currency
+	coupon.MinSpend.Currency = currency
+	if startsAt.Valid {
+		coupon.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		coupon.EndsAt = &endsAt.Time
+	}
+	return coupon, nil
+}
+
+// check the rules of a coupon an admin wants to save
+func validateCoupon(coupon *models.Coupon) error {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if coupon.Code == "" || coupon.PerUserLimit < 0 {
+		return utils.ErrInvalidCouponRule
+	}
+	//amount and min spend are stored with a single currency
+	if coupon.Amount.Currency == "" {
+		coupon.Amount.Currency = coupon.MinSpend.Currency
+	}
+	if coupon.Amount.Currency == "" {
+		coupon.Amount.Currency = models.DefaultCurrency
+	}
+	if coupon.MinSpend.Currency == "" {
+		coupon.MinSpend.Currency = coupon.Amount.Currency
+	}
+	if coupon.MinSpend.Currency != coupon.Amount.Currency {
+		return models.ErrCurrencyMismatch
+	}
+	if err := coupon.Amount.Validate(); err != nil {
+		return err
+	}
+	if err := coupon.MinSpend.Validate(); err != nil {
+		return err
+	}
+	switch coupon.Kind {
+	case models.CouponPercentage:
+		if coupon.Percent < 1 || coupon.Percent > 100 {
+			return utils.ErrInvalidCouponRule
+		}
+	case models.CouponFixed:
+		if coupon.Amount.Amount <= 0 {
+			return utils.ErrInvalidCouponRule
+		}
+	case models.CouponFreeShipping:
+	default:
+		return utils.ErrInvalidCouponRule
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return utils.ErrInvalidCouponRule
+	}
+	return nil
+}
+
+// work out what a coupon takes off order items, redeemed is how many times user has used it already
+func evaluateCoupon(coupon *models.Coupon, items []*models.OrderItem, redeemed int, now time.Time) (*models.AppliedCoupon, error) {
+	if coupon.Active == nil || !*coupon.Active || (coupon.StartsAt != nil && now.Before(*coupon.StartsAt)) || (coupon.EndsAt != nil && !now.Before(*coupon.EndsAt)) {
+		return nil, utils.ErrInvalidCoupon
+	}
+	if coupon.PerUserLimit > 0 && redeemed >= coupon.PerUserLimit {
+		return nil, utils.ErrCouponLimitReached
+	}
+
+	subtotal, err := orderTotal(items)
+	if err != nil {
+		return nil, err
+	}
+	if !coupon.MinSpend.IsZero() {
+		if subtotal.Currency != coupon.MinSpend.Currency {
+			return nil, utils.ErrCouponNotApplicable
+		}
+		if subtotal.Amount < coupon.MinSpend.Amount {
+			return nil, utils.ErrCouponMinSpend
+		}
+	}
+
+	//only items the coupon is limited to count towards the discount
+	eligible := items
+	if len(coupon.Products) > 0 || len(coupon.Categories) > 0 {
+		allowed := make(map[string]bool, len(coupon.Products)+len(coupon.CategoryProducts))
+		for _, productID := range coupon.Products {
+			allowed[productID] = true
+		}
+		for _, productID := range coupon.CategoryProducts {
+			allowed[productID] = true
+		}
+		eligible = nil
+		for _, item := range items {
+			if allowed[item.ProductID] {
+				eligible = append(eligible, item)
+			}
+		}
+		if len(eligible) == 0 {
+			return nil, utils.ErrCouponNotApplicable
+		}
+	}
+	base, err := orderTotal(eligible)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := &models.AppliedCoupon{
+		CouponID: coupon.CouponID,
+		Code:     coupon.Code,
+		Discount: models.NewMoney(0, subtotal.Currency),
+	}
+	switch coupon.Kind {
+	case models.CouponPercentage:
+		//round down, the shop never gives away more than the percentage
+		applied.Discount.Amount = base.Amount * int64(coupon.Percent) / 100
+	case models.CouponFixed:
+		if base.Currency != coupon.Amount.Currency {
+			return nil, utils.ErrCouponNotApplicable
+		}
+		applied.Discount.Amount = coupon.Amount.Amount
+		if applied.Discount.Amount > base.Amount {
+			applied.Discount.Amount = base.Amount
+		}
+	case models.CouponFreeShipping:
+		applied.FreeShipping = true
+	}
+	return applied, nil
+}
+
+// product uuids a coupon is limited to
+func getCouponProducts(tx *sql.Tx, couponID int) ([]string, error) {
+	rows, err := tx.Query(`select product_id from coupon_products where coupon_id = ? order by product_id`, couponID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Products []string
+	for rows.Next() {
+		var productID string
+		if err := rows.Scan(&productID); err != nil {
+			return nil, err
+		}
+		Products = append(Products, productID)
+	}
+	return Products, rows.Err()
+}
+
+// replace the products a coupon is limited to, caller owns the transaction
+func setCouponProducts(tx *sql.Tx, couponID int, products []string) error {
+	if _, err := tx.Exec(`delete from coupon_products where coupon_id = ?`, couponID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`insert into coupon_products(coupon_id, product_id) values(?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	seen := make(map[string]bool, len(products))
+	for _, productID := range products {
+		if seen[productID] {
+			continue
+		}
+		seen[productID] = true
+		if _, err := stmt.Exec(couponID, productID); err != nil {
+			//1452, product does not exist
+			if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1452 {
+				return utils.ErrNoRecord
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func getCouponCategories(tx *sql.Tx, couponID int) ([]string, error) {
+	rows, err := tx.Query(`select c.slug from coupon_categories cc join categories c on c.category_id = cc.category_id where cc.coupon_id = ? order by c.slug`, couponID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Categories []string
+	for rows.Next() {
+		var slug string
+		if err := rows.Scan(&slug); err != nil {
+			return nil, err
+		}
+		Categories = append(Categories, slug)
+	}
+	return Categories, rows.Err()
+}
+
+// replace the categories a coupon is limited to, caller owns the transaction
+func setCouponCategories(tx *sql.Tx, couponID int, slugs []string) error {
+	if _, err := tx.Exec(`delete from coupon_categories where coupon_id = ?`, couponID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`insert into coupon_categories(coupon_id, category_id) select ?, category_id from categories where slug = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	seen := make(map[string]bool, len(slugs))
+	for _, slug := range slugs {
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result, err := stmt.Exec(couponID, slug)
+		if err != nil {
+			return err
+		}
+		//category does not exist
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			return utils.ErrNoRecord
+		}
+	}
+	return nil
+}
+
+// times user has used a coupon on an order
+func couponRedemptions(tx *sql.Tx, couponID, userID int) (int, error) {
+	var count int
+	err := tx.QueryRow(`select count(*) from coupon_redemptions where coupon_id = ? and user_id = ?`, couponID, userID).Scan(&count)
+	return count, err
+}
+
+// get coupon by code with its product and category restrictions, forUpdate locks the row until the transaction ends
+func couponByCode(tx *sql.Tx, code string, forUpdate bool) (*models.Coupon, error) {
+	query := `select ` + couponColumns + ` from coupons c where c.code = ?`
+	if forUpdate {
+		query += ` for update`
+	}
+	coupon, err := scanCoupon(tx.QueryRow(query, strings.ToUpper(strings.TrimSpace(code))))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrInvalidCoupon
+		}
+		return nil, err
+	}
+	coupon.Products, err = getCouponProducts(tx, coupon.CouponID)
+	if err != nil {
+		return nil, err
+	}
+	if coupon.Categories, err = getCouponCategories(tx, coupon.CouponID); err != nil {
+		return nil, err
+	}
+	if coupon.CategoryProducts, err = categoryProductIDs(tx, coupon.Categories); err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// re-check coupon in user's cart against the items being ordered, nil when the cart has none.
+// coupon row stays locked so concurrent checkouts can't go over the per-user limit
+func cartCoupon(tx *sql.Tx, userID int, items []*models.OrderItem) (*models.AppliedCoupon, error) {
+	var code string
+	err := tx.QueryRow(`select c.code from cart_coupons cc join coupons c on c.coupon_id = cc.coupon_id where cc.user_id = ?`, userID).Scan(&code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	coupon, err := couponByCode(tx, code, true)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := couponRedemptions(tx, coupon.CouponID, userID)
+	if err != nil {
+		return nil, err
+	}
+	return evaluateCoupon(coupon, items, redeemed, time.Now())
+}
+
+// cart coupon for showing totals and quotes, a coupon that no longer applies is left out
+// here rather than failing, checkout reports it. caller owns the transaction
+func previewCartCoupon(tx *sql.Tx, userID int, items []*models.OrderItem) (*models.AppliedCoupon, error) {
+	coupon, err := cartCoupon(tx, userID, items)
+	switch {
+	case errors.Is(err, utils.ErrInvalidCoupon), errors.Is(err, utils.ErrCouponLimitReached), errors.Is(err, utils.ErrCouponMinSpend), errors.Is(err, utils.ErrCouponNotApplicable):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// record use of a coupon on an order and take it out of the cart, caller owns the transaction
+func redeemCoupon(tx *sql.Tx, couponID, userID, orderID int) error {
+	if _, err := tx.Exec(`insert into coupon_redemptions(coupon_id, user_id, order_id) values(?, ?, ?)`, couponID, userID, orderID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`delete from cart_coupons where user_id = ?`, userID)
+	return err
+}
+
+// put coupon on user's cart, the discount it gives the cart right now is returned
+func (dm *DBModel) ApplyCoupon(userID int, code string) (*models.AppliedCoupon, error) {
+	cart, err := dm.GetUserCart(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(cart) == 0 {
+		return nil, utils.ErrEmptyCart
+	}
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	coupon, err := couponByCode(tx, code, false)
+	if err != nil {
+		return nil, err
+	}
+	redeemed, err := couponRedemptions(tx, coupon.CouponID, userID)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := evaluateCoupon(coupon, cartItems(cart), redeemed, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	query := `insert into cart_coupons(user_id, coupon_id) values(?, ?) on duplicate key update coupon_id = values(coupon_id)`
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(userID, coupon.CouponID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// take coupon off user's cart
+func (dm *DBModel) RemoveCartCoupon(userID int) error {
+	query := `delete from cart_coupons where user_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(userID)
+	if err != nil {
+		return err
+	}
+	if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+		return utils.ErrNoRecord
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// create a coupon --admin stuff
+func (dm *DBModel) CreateCoupon(coupon *models.Coupon) (*models.Coupon, error) {
+	if err := validateCoupon(coupon); err != nil {
+		return nil, err
+	}
+	//new coupons are live unless the admin says otherwise
+	if coupon.Active == nil {
+		active := true
+		coupon.Active = &active
+	}
+	query := `insert into coupons(code, kind, percent, amount, min_spend, currency, per_user_limit, starts_at, ends_at, active) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(coupon.Code, coupon.Kind, coupon.Percent, coupon.Amount.Amount, coupon.MinSpend.Amount, coupon.Amount.Currency, coupon.PerUserLimit, coupon.StartsAt, coupon.EndsAt, coupon.Active)
+	if err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return nil, utils.ErrExistingCoupon
+		}
+		return nil, err
+	}
+	couponID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	coupon.CouponID = int(couponID)
+	if err := setCouponProducts(tx, coupon.CouponID, coupon.Products); err != nil {
+		return nil, err
+	}
+	if err := setCouponCategories(tx, coupon.CouponID, coupon.Categories); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return coupon, nil
+}
+
+// replace the rules of a coupon --admin stuff
+func (dm *DBModel) UpdateCoupon(coupon *models.Coupon) error {
+	if err := validateCoupon(coupon); err != nil {
+		return err
+	}
+	query := `update coupons set code = ?, kind = ?, percent = ?, amount = ?, min_spend = ?, currency = ?, per_user_limit = ?, starts_at = ?, ends_at = ?, active = ? where coupon_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var active bool
+	if err := tx.QueryRow(`select active from coupons where coupon_id = ? for update`, coupon.CouponID).Scan(&active); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return utils.ErrNoRecord
+		}
+		return err
+	}
+	//leaving active out keeps the coupon on or off as it was
+	if coupon.Active == nil {
+		coupon.Active = &active
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(coupon.Code, coupon.Kind, coupon.Percent, coupon.Amount.Amount, coupon.MinSpend.Amount, coupon.Amount.Currency, coupon.PerUserLimit, coupon.StartsAt, coupon.EndsAt, coupon.Active, coupon.CouponID)
+	if err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return utils.ErrExistingCoupon
+		}
+		return err
+	}
+	if err := setCouponProducts(tx, coupon.CouponID, coupon.Products); err != nil {
+		return err
+	}
+	if err := setCouponCategories(tx, coupon.CouponID, coupon.Categories); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// delete a coupon, orders that used it keep their discount --admin stuff
+func (dm *DBModel) DeleteCoupon(couponID int) error {
+	query := `delete from coupons where coupon_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(couponID)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return utils.ErrNoRecord
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// every coupon with its product and category restrictions --admin stuff
+func (dm *DBModel) GetCoupons() ([]*models.Coupon, error) {
+	query := `select ` + couponColumns + ` from coupons c order by c.coupon_id`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	var Coupons []*models.Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		Coupons = append(Coupons, coupon)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, coupon := range Coupons {
+		coupon.Products, err = getCouponProducts(tx, coupon.CouponID)
+		if err != nil {
+			return nil, err
+		}
+		if coupon.Categories, err = getCouponCategories(tx, coupon.CouponID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Coupons, nil
+}
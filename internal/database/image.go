@@ -0,0 +1,198 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* product image operations */
+
+// most images a product can have
+const MaxProductImages = 20
+
+// images of a product in display order, caller owns the transaction
+func productImages(tx *sql.Tx, productUUID string) ([]*models.ProductImage, error) {
+	rows, err := tx.Query(`select image_id, product_id, blob_key, url, content_type, size, position from product_images where product_id = ? order by position, image_id`, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	Images := []*models.ProductImage{}
+	for rows.Next() {
+		image := &models.ProductImage{}
+		if err := rows.Scan(&image.ImageID, &image.ProductID, &image.Key, &image.URL, &image.ContentType, &image.Size, &image.Position); err != nil {
+			return nil, err
+		}
+		Images = append(Images, image)
+	}
+	return Images, rows.Err()
+}
+
+// number images 0, 1, 2... in the order given and make the first one the product image.
+// caller owns the transaction
+func setImagePositions(tx *sql.Tx, productUUID string, images []*models.ProductImage) error {
+	for position, image := range images {
+		if image.Position == position {
+			continue
+		}
+		if _, err := tx.Exec(`update product_images set position = ? where image_id = ?`, position, image.ImageID); err != nil {
+			return err
+		}
+		image.Position = position
+	}
+	mainImage := ""
+	if len(images) > 0 {
+		mainImage = images[0].URL
+	}
+	_, err := tx.Exec(`update products set image = ? where product_id = ?`, mainImage, productUUID)
+	return err
+}
+
+// images of a product, main image first
+func (dm *DBModel) GetProductImages(productUUID string) ([]*models.ProductImage, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	Images, err := productImages(tx, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Images, nil
+}
+
+// record stored images after the ones product already has --admin stuff
+func (dm *DBModel) AddProductImages(productUUID string, uploads []*models.ProductImage) ([]*models.ProductImage, error) {
+	query := `insert into product_images(product_id, blob_key, url, content_type, size, position) values(?, ?, ?, ?, ?, ?)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(tx, productUUID); err != nil {
+		return nil, err
+	}
+	Images, err := productImages(tx, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(Images)+len(uploads) > MaxProductImages {
+		return nil, utils.ErrTooManyImages
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	for _, image := range uploads {
+		image.ProductID, image.Position = productUUID, len(Images)
+		result, err := stmt.Exec(productUUID, image.Key, image.URL, image.ContentType, image.Size, image.Position)
+		if err != nil {
+			return nil, err
+		}
+		imageID, err := result.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		image.ImageID = int(imageID)
+		Images = append(Images, image)
+	}
+	if err := setImagePositions(tx, productUUID, Images); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Images, nil
+}
+
+// put images of a product in the given order, imageIDs must hold each of them once --admin stuff
+func (dm *DBModel) ReorderProductImages(productUUID string, imageIDs []int) ([]*models.ProductImage, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(tx, productUUID); err != nil {
+		return nil, err
+	}
+	current, err := productImages(tx, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	if len(imageIDs) != len(current) {
+		return nil, utils.ErrInvalidImageOrder
+	}
+	byID := make(map[int]*models.ProductImage, len(current))
+	for _, image := range current {
+		byID[image.ImageID] = image
+	}
+	Images := make([]*models.ProductImage, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		image, ok := byID[id]
+		if !ok {
+			return nil, utils.ErrInvalidImageOrder
+		}
+		delete(byID, id) //a repeated id is not found the second time
+		Images = append(Images, image)
+	}
+	if err := setImagePositions(tx, productUUID, Images); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Images, nil
+}
+
+// remove an image of a product, the deleted image is returned so its file can be removed --admin stuff
+func (dm *DBModel) DeleteProductImage(productUUID string, imageID int) (*models.ProductImage, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(tx, productUUID); err != nil {
+		return nil, err
+	}
+	current, err := productImages(tx, productUUID)
+	if err != nil {
+		return nil, err
+	}
+	var deleted *models.ProductImage
+	Images := make([]*models.ProductImage, 0, len(current))
+	for _, image := range current {
+		if image.ImageID == imageID {
+			deleted = image
+			continue
+		}
+		Images = append(Images, image)
+	}
+	if deleted == nil {
+		return nil, utils.ErrNoRecord
+	}
+	if _, err := tx.Exec(`delete from product_images where image_id = ?`, imageID); err != nil {
+		return nil, err
+	}
+	if err := setImagePositions(tx, productUUID, Images); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,217 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* inventory operations */
+
+// how long cart items hold stock before others can buy it
+const reservationTTL = 15 * time.Minute
+
+// lock stock row of a product variant and return units free for userID,
+// i.e stock less what other users currently hold in their carts. userID 0 counts every hold
+func lockVariant(tx *sql.Tx, userID int, productUUID, color, size string) (int, int, error) {
+	var variantID, stock int
+	err := tx.QueryRow(`select variant_id, stock from product_variants where product_id = ? and color = ? and size = ? for update`, productUUID, color, size).Scan(&variantID, &stock)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, utils.ErrInvalidVariant
+		}
+		return 0, 0, err
+	}
+
+	//expired holds are dead weight, drop them while the row is locked
+	if _, err := tx.Exec(`delete from stock_reservations where variant_id = ? and expires_at <= now()`, variantID); err != nil {
+		return 0, 0, err
+	}
+
+	var reserved int
+	err = tx.QueryRow(`select coalesce(sum(quantity), 0) from stock_reservations where variant_id = ? and user_id <> ?`, variantID, userID).Scan(&reserved)
+	if err != nil {
+		return 0, 0, err
+	}
+	return variantID, stock - reserved, nil
+}
+
+// hold stock for what user has of a variant in cart, caller owns the transaction
+func reserveCartStock(tx *sql.Tx, userID int, productUUID, color, size string) error {
+	variantID, available, err := lockVariant(tx, userID, productUUID, color, size)
+	if err != nil {
+		return err
+	}
+
+	var want int
+	err = tx.QueryRow(`select coalesce(sum(quantity), 0) from carts where user_id = ? and product_id = ? and color = ? and size = ?`, userID, productUUID, color, size).Scan(&want)
+	if err != nil {
+		return err
+	}
+	if want > available {
+		return utils.ErrOutOfStock
+	}
+	if want == 0 {
+		_, err = tx.Exec(`delete from stock_reservations where user_id = ? and variant_id = ?`, userID, variantID)
+		return err
+	}
+
+	query := `insert into stock_reservations(user_id, variant_id, quantity, expires_at) values(?, ?, ?, date_add(now(), interval ? second))
+	on duplicate key update quantity = values(quantity), expires_at = values(expires_at)`
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(userID, variantID, want, int(reservationTTL.Seconds()))
+	return err
+}
+
+// drop every hold user has on a product, caller owns the transaction
+func releaseProductStock(tx *sql.Tx, userID int, productUUID string) error {
+	query := `delete from stock_reservations where user_id = ? and variant_id in (select variant_id from product_variants where product_id = ?)`
+	_, err := tx.Exec(query, userID, productUUID)
+	return err
+}
+
+// take stock for order items, rows are locked in a fixed order so concurrent checkouts can't deadlock.
+// holds of holderID are turned into the sale, every other hold is respected.
+// holderID 0 converts none, e.g buying outside the cart leaves the buyer's cart holds in place
+func takeStock(tx *sql.Tx, holderID int, items []*models.OrderItem) error {
+	sorted := make([]*models.OrderItem, len(items))
+	copy(sorted, items)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].ProductID != sorted[j].ProductID {
+			return sorted[i].ProductID < sorted[j].ProductID
+		}
+		if sorted[i].Color != sorted[j].Color {
+			return sorted[i].Color < sorted[j].Color
+		}
+		return sorted[i].Size < sorted[j].Size
+	})
+
+	//same variant may show up on more than one cart row
+	wanted := make(map[int]int)
+	var locked []int
+	for _, item := range sorted {
+		variantID, available, err := lockVariant(tx, holderID, item.ProductID, item.Color, item.Size)
+		if err != nil {
+			return err
+		}
+		if _, seen := wanted[variantID]; !seen {
+			locked = append(locked, variantID)
+		}
+		wanted[variantID] += item.Quantity
+		if wanted[variantID] > available {
+			return utils.ErrOutOfStock
+		}
+	}
+
+	stockStmt, err := tx.Prepare(`update product_variants set stock = stock - ? where variant_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stockStmt.Close()
+	holdStmt, err := tx.Prepare(`delete from stock_reservations where user_id = ? and variant_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer holdStmt.Close()
+
+	for _, variantID := range locked {
+		if _, err := stockStmt.Exec(wanted[variantID], variantID); err != nil {
+			return err
+		}
+		if holderID == 0 {
+			continue
+		}
+		if _, err := holdStmt.Exec(holderID, variantID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// put stock of an order's items back, caller owns the transaction
+func restoreStock(tx *sql.Tx, orderID int) error {
+	query := `update product_variants v join order_items i on i.product_id = v.product_id and i.color = v.color and i.size = v.size
+	set v.stock = v.stock + i.quantity where i.order_id = ?`
+	_, err := tx.Exec(query, orderID)
+	return err
+}
+
+// set units available for an existing product variant --admin stuff
+func (dm *DBModel) SetStock(productUUID, color, size string, stock int) error {
+	if stock < 0 {
+		return utils.ErrInvalidQuantity
+	}
+	variant, err := dm.GetVariant(productUUID, color, size)
+	if err != nil {
+		return err
+	}
+	query := `update product_variants set stock = ? where variant_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(stock, variant.VariantID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// variants of a product and their stock
+func (dm *DBModel) GetProductStock(productUUID string) ([]*models.ProductVariant, error) {
+	query := `select ` + variantColumns + `, v.stock from product_variants v join products p on p.product_id = v.product_id
+	where v.product_id = ? order by v.variant_id`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(productUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Variants []*models.ProductVariant
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		Variants = append(Variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Variants, nil
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* invoice operations */
+
+// printed form of an invoice number
+func invoiceNumber(year, number int) string {
+	return fmt.Sprintf("INV-%d-%06d", year, number)
+}
+
+// give order an invoice number if it has none yet, the existing invoice is returned otherwise.
+// buyer details are copied onto the invoice so it outlives the order and account. caller owns the transaction
+func issueInvoice(tx *sql.Tx, orderID int) (*models.Invoice, error) {
+	invoice := &models.Invoice{Buyer: &models.ResponseUser{}}
+	buyer := invoice.Buyer
+	var year, number int
+	err := tx.QueryRow(`select year, number, issued_at, buyer_first_name, buyer_last_name, buyer_email, buyer_phone from invoices where order_id = ?`, orderID).
+		Scan(&year, &number, &invoice.IssuedAt, &buyer.FirstName, &buyer.LastName, &buyer.Email, &buyer.PhoneNumber)
+	if err == nil {
+		invoice.Number = invoiceNumber(year, number)
+		return invoice, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	err = tx.QueryRow(`select u.id, u.first_name, u.last_name, u.email, u.phone_number from orders o join users u on u.id = o.user_id where o.order_id = ?`, orderID).
+		Scan(&buyer.ID, &buyer.FirstName, &buyer.LastName, &buyer.Email, &buyer.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	invoice.IssuedAt = time.Now().UTC().Truncate(time.Second)
+	year = invoice.IssuedAt.Year()
+	//upsert takes the counter row lock, it is held until the transaction ends
+	if _, err := tx.Exec(`insert into invoice_counters(year, last_number) values(?, 1) on duplicate key update last_number = last_number + 1`, year); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(`select last_number from invoice_counters where year = ?`, year).Scan(&number); err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(`insert into invoices(order_id, year, number, issued_at, buyer_first_name, buyer_last_name, buyer_email, buyer_phone) values(?, ?, ?, ?, ?, ?, ?, ?)`,
+		orderID, year, number, invoice.IssuedAt, buyer.FirstName, buyer.LastName, buyer.Email, buyer.PhoneNumber)
+	if err != nil {
+		return nil, err
+	}
+	invoice.Number = invoiceNumber(year, number)
+	return invoice, nil
+}
+
+// invoice of an order, issued on first request. buyerID limits it to that buyer's orders, 0 is any order
+func (dm *DBModel) GetOrderInvoice(orderID, buyerID int) (*models.Invoice, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	//order row is locked so two first requests can't both issue a number
+	var ownerID int
+	err = tx.QueryRow(`select user_id from orders where order_id = ? for update`, orderID).Scan(&ownerID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	if buyerID != 0 && ownerID != buyerID {
+		return nil, utils.ErrNoRecord
+	}
+	invoice, err := issueInvoice(tx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if invoice.Order, err = dm.GetUserOrder(ownerID, orderID); err != nil {
+		return nil, err
+	}
+	return invoice, nil
+}
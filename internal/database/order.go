@@ -0,0 +1,567 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* order operations */
+
+// total price of the line items of an order, items must share a currency
+func orderTotal(items []*models.OrderItem) (models.Money, error) {
+	var total models.Money
+	for _, item := range items {
+		var err error
+		total, err = total.Add(item.Price.Mul(item.Quantity))
+		if err != nil {
+			return models.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// cart rows as order line items
+func cartItems(cart []*models.ResponseCartProducts) []*models.OrderItem {
+	items := make([]*models.OrderItem, 0, len(cart))
+	for _, product := range cart {
+		items = append(items, &models.OrderItem{
+			ProductID:   product.ProductID,
+			ProductName: product.ProductName,
+			Price:       product.Price,
+			Quantity:    product.Quantity,
+			Color:       product.Color,
+			Size:        product.Size,
+		})
+	}
+	return items
+}
+
+// lock user's cart rows and return their ids with the rows as order line items,
+// rows added after this are left for a later checkout. caller owns the transaction
+func lockCart(tx *sql.Tx, userID int) ([]int, []*models.OrderItem, error) {
+	rows, err := tx.Query(`select cart_id, product_id, product_name, price, currency, quantity, color, size from carts where user_id = ? order by cart_id for update`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var cartIDs []int
+	var items []*models.OrderItem
+	for rows.Next() {
+		var cartID int
+		item := &models.OrderItem{}
+		if err := rows.Scan(&cartID, &item.ProductID, &item.ProductName, &item.Price.Amount, &item.Price.Currency, &item.Quantity, &item.Color, &item.Size); err != nil {
+			return nil, nil, err
+		}
+		cartIDs = append(cartIDs, cartID)
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return cartIDs, items, nil
+}
+
+// takes payment for an order total, called with no rows locked
+type AuthorizeFunc func(total models.Money) (*models.Payment, error)
+
+// prices shipping of an order's parcel with the method the user picked
+type QuoteFunc func(parcel *models.Parcel) (*models.ShippingQuote, error)
+
+// what is added to or taken off an order besides its line items
+type orderDetails struct {
+	coupon   *models.AppliedCoupon //nil when no coupon was used
+	shipping *models.Address
+	billing  *models.Address
+	delivery *models.ShippingQuote //nil for orders that are not shipped
+
+	tax         models.Money //added on top of the prices
+	includedTax models.Money //already part of the prices
+}
+
+// order priced and checked inside a transaction but not yet written
+type orderDraft struct {
+	items   []*models.OrderItem
+	details orderDetails
+	//runs in the same transaction once the order is written, may be nil
+	finish func(tx *sql.Tx, order *models.Order) error
+}
+
+// builds the draft of an order, stock is taken and rows locked in tx
+type draftFunc func(tx *sql.Tx) (*orderDraft, error)
+
+// what the buyer pays for an order: line items less discount, plus tax and shipping
+func orderDue(items []*models.OrderItem, details orderDetails) (models.Money, error) {
+	due, err := orderTotal(items)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if details.coupon != nil {
+		if due, err = due.Sub(details.coupon.Discount); err != nil {
+			return models.Money{}, err
+		}
+	}
+	if due, err = due.Add(models.NewMoney(details.tax.Amount, due.Currency)); err != nil {
+		return models.Money{}, err
+	}
+	if details.delivery != nil {
+		if due, err = due.Add(details.delivery.Cost); err != nil {
+			return models.Money{}, err
+		}
+	}
+	return due, nil
+}
+
+// write order and its line items, caller owns the transaction
+func createOrder(tx *sql.Tx, userID int, items []*models.OrderItem, details orderDetails, payment *models.Payment) (*models.Order, error) {
+	query := `insert into orders(user_id, ordered_at, price, discount, currency, status, payment_type, payment_provider, payment_ref, payment_status, coupon_id,
+	shipping_address_id, billing_address_id, shipping_address, billing_address, shipping_carrier, shipping_method, shipping_cost, tax, included_tax)
+	values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	total, err := orderTotal(items)
+	if err != nil {
+		return nil, err
+	}
+	order := &models.Order{
+		OrderedAt:     time.Now(),
+		Price:         total,
+		Discount:      models.NewMoney(0, total.Currency),
+		Tax:           models.NewMoney(details.tax.Amount, total.Currency),
+		Status:        models.OrderPending,
+		PaymentMethod: *payment,
+		Items:         items,
+
+		ShippingAddress: details.shipping,
+		BillingAddress:  details.billing,
+		Shipping:        details.delivery,
+		IncludedTax:     models.NewMoney(details.includedTax.Amount, total.Currency),
+	}
+	var couponID sql.NullInt64
+	if details.coupon != nil {
+		order.Discount = details.coupon.Discount
+		order.CouponCode = details.coupon.Code
+		couponID = sql.NullInt64{Int64: int64(details.coupon.CouponID), Valid: true}
+	}
+
+	//addresses are copied onto the order, later edits or removal of the saved address don't change it
+	var shippingID, billingID sql.NullInt64
+	if details.shipping != nil {
+		shippingID = sql.NullInt64{Int64: int64(details.shipping.AddressID), Valid: true}
+	}
+	if details.billing != nil {
+		billingID = sql.NullInt64{Int64: int64(details.billing.AddressID), Valid: true}
+	}
+	shippingJSON, err := addressJSON(details.shipping)
+	if err != nil {
+		return nil, err
+	}
+	billingJSON, err := addressJSON(details.billing)
+	if err != nil {
+		return nil, err
+	}
+
+	var carrier, method sql.NullString
+	var shippingCost int64
+	if details.delivery != nil {
+		carrier = sql.NullString{String: details.delivery.Carrier, Valid: true}
+		method = sql.NullString{String: details.delivery.Method, Valid: true}
+		shippingCost = details.delivery.Cost.Amount
+	}
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(userID, order.OrderedAt, order.Price.Amount, order.Discount.Amount, order.Price.Currency, order.Status, payment.Method, payment.Provider, payment.Reference, payment.Status, couponID, shippingID, billingID, shippingJSON, billingJSON, carrier, method, shippingCost, order.Tax.Amount, order.IncludedTax.Amount)
+	if err != nil {
+		return nil, err
+	}
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	order.OrderID = int(orderID)
+
+	itemStmt, err := tx.Prepare(`insert into order_items(order_id, product_id, product_name, price, quantity, color, size, tax, tax_rate, tax_inclusive) values(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer itemStmt.Close()
+
+	for _, item := range items {
+		if _, err := itemStmt.Exec(order.OrderID, item.ProductID, item.ProductName, item.Price.Amount, item.Quantity, item.Color, item.Size, item.Tax.Amount, item.TaxRate, item.TaxInclusive); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// total an order would come to, the draft is rolled back so nothing stays locked or taken
+func (dm *DBModel) quoteOrder(draft draftFunc) (models.Money, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return models.Money{}, err
+	}
+	defer tx.Rollback()
+
+	d, err := draft(tx)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return orderDue(d.items, d.details)
+}
+
+// price an order, take payment with nothing locked, then draft it again and write it,
+// so a slow payment provider never holds up stock or coupons other checkouts need.
+// ErrOrderChanged is returned when the total moved in between, the caller voids the payment as for any failure
+func (dm *DBModel) placeOrder(userID int, draft draftFunc, authorize AuthorizeFunc) (*models.Order, error) {
+	due, err := dm.quoteOrder(draft)
+	if err != nil {
+		return nil, err
+	}
+	payment, err := authorize(due)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	d, err := draft(tx)
+	if err != nil {
+		return nil, err
+	}
+	current, err := orderDue(d.items, d.details)
+	if err != nil {
+		return nil, err
+	}
+	if current != due {
+		return nil, utils.ErrOrderChanged
+	}
+	order, err := createOrder(tx, userID, d.items, d.details, payment)
+	if err != nil {
+		return nil, err
+	}
+	if d.finish != nil {
+		if err := d.finish(tx, order); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// turn user cart into an order and empty the cart, address ids of 0 use the user's defaults
+func (dm *DBModel) CheckoutCart(userID, shippingAddressID, billingAddressID int, quote QuoteFunc, authorize AuthorizeFunc) (*models.Order, error) {
+	return dm.placeOrder(userID, func(tx *sql.Tx) (*orderDraft, error) {
+		//cart is read under lock so it can't change between pricing and emptying it
+		cartIDs, items, err := lockCart(tx, userID)
+		if err != nil {
+			return nil, err
+		}
+		if len(items) == 0 {
+			return nil, utils.ErrEmptyCart
+		}
+
+		shipping, billing, err := orderAddresses(tx, userID, shippingAddressID, billingAddressID)
+		if err != nil {
+			return nil, err
+		}
+		if err := takeStock(tx, userID, items); err != nil {
+			return nil, err
+		}
+		//coupon is checked again, it may have expired or been used up since it was applied
+		coupon, err := cartCoupon(tx, userID, items)
+		if err != nil {
+			return nil, err
+		}
+		delivery, err := quoteDelivery(tx, items, shipping, quote)
+		if err != nil {
+			return nil, err
+		}
+		details := orderDetails{coupon: coupon, shipping: shipping, billing: billing, delivery: delivery}
+		var discount models.Money
+		if coupon != nil {
+			discount = coupon.Discount
+			if coupon.FreeShipping {
+				delivery.Cost = models.NewMoney(0, delivery.Cost.Currency)
+			}
+		}
+		//tax is worked out for where the order is going
+		if details.tax, details.includedTax, err = applyTax(tx, items, shipping, discount); err != nil {
+			return nil, err
+		}
+
+		finish := func(tx *sql.Tx, order *models.Order) error {
+			if coupon != nil {
+				if err := redeemCoupon(tx, coupon.CouponID, userID, order.OrderID); err != nil {
+					return err
+				}
+			}
+			//only the rows that went into the order are removed
+			placeholders, args := inClause(cartIDs)
+			_, err := tx.Exec(`delete from carts where cart_id in (`+placeholders+`)`, args...)
+			return err
+		}
+		return &orderDraft{items: items, details: details, finish: finish}, nil
+	}, authorize)
+}
+
+// buy a single product straight away, user cart is left untouched
+func (dm *DBModel) InstantBuy(userID int, productUUID string, quantity int, color, size string, shippingAddressID, billingAddressID int, quote QuoteFunc, authorize AuthorizeFunc) (*models.Order, error) {
+	if quantity < 1 {
+		return nil, utils.ErrInvalidQuantity
+	}
+	//current price of the product
+	product, err := dm.GetProduct(productUUID)
+	if err != nil {
+		return nil, err
+	}
+	variant, err := dm.GetVariant(productUUID, color, size)
+	if err != nil {
+		return nil, err
+	}
+
+	return dm.placeOrder(userID, func(tx *sql.Tx) (*orderDraft, error) {
+		shipping, billing, err := orderAddresses(tx, userID, shippingAddressID, billingAddressID)
+		if err != nil {
+			return nil, err
+		}
+
+		items := []*models.OrderItem{
+			{
+				ProductID:   product.ProductID,
+				ProductName: product.ProductName,
+				Price:       variantPrice(variant, product),
+				Quantity:    quantity,
+				Color:       color,
+				Size:        size,
+			},
+		}
+		//stock the buyer holds in their cart stays held for the cart
+		if err := takeStock(tx, 0, items); err != nil {
+			return nil, err
+		}
+		delivery, err := quoteDelivery(tx, items, shipping, quote)
+		if err != nil {
+			return nil, err
+		}
+		details := orderDetails{shipping: shipping, billing: billing, delivery: delivery}
+		if details.tax, details.includedTax, err = applyTax(tx, items, shipping, models.Money{}); err != nil {
+			return nil, err
+		}
+		return &orderDraft{items: items, details: details}, nil
+	}, authorize)
+}
+
+// sorts of a user's orders, most recent first unless asked otherwise
+var orderKeyset = &pagination.Keyset{
+	ID: "o.order_id",
+	Sorts: map[string]pagination.Sort{
+		"newest":     {Desc: true},
+		"oldest":     {},
+		"price_asc":  {Column: "o.price"},
+		"price_desc": {Column: "o.price", Desc: true},
+	},
+	Default: "newest",
+}
+
+// list a page of orders placed by user
+func (dm *DBModel) GetUserOrders(userID int, params pagination.Params) ([]*models.Order, *models.Page, error) {
+	q, err := orderKeyset.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	where, args := q.Where()
+	query := `select o.order_id, o.ordered_at, o.price, o.discount, o.currency, o.status, o.payment_type, o.payment_provider, o.payment_ref, o.payment_status, coalesce(c.code, ''), o.shipping_address, o.billing_address,
+	coalesce(o.shipping_carrier, ''), coalesce(o.shipping_method, ''), o.shipping_cost, o.tax, o.included_tax
+	from orders o left join coupons c on c.coupon_id = o.coupon_id where o.user_id = ? and ` + where + ` order by ` + q.OrderBy() + ` limit ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(append(append([]interface{}{userID}, args...), q.Limit())...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	var Orders []*models.Order
+	for rows.Next() {
+		order := &models.Order{}
+		var shipping, billing []byte
+		delivery := &models.ShippingQuote{}
+		if err := rows.Scan(&order.OrderID, &order.OrderedAt, &order.Price.Amount, &order.Discount.Amount, &order.Price.Currency, &order.Status, &order.PaymentMethod.Method, &order.PaymentMethod.Provider, &order.PaymentMethod.Reference, &order.PaymentMethod.Status, &order.CouponCode, &shipping, &billing, &delivery.Carrier, &delivery.Method, &delivery.Cost.Amount, &order.Tax.Amount, &order.IncludedTax.Amount); err != nil {
+			return nil, nil, err
+		}
+		order.Discount.Currency = order.Price.Currency
+		order.Tax.Currency, order.IncludedTax.Currency = order.Price.Currency, order.Price.Currency
+		if err := orderAddressesFromJSON(order, shipping, billing); err != nil {
+			return nil, nil, err
+		}
+		order.Shipping = orderDelivery(delivery, order.Price.Currency)
+		Orders = append(Orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	Orders, page := pagination.Trim(q, Orders, func(order *models.Order) (interface{}, int64) {
+		return order.Price.Amount, int64(order.OrderID)
+	})
+	return Orders, page, nil
+}
+
+// get a single order of user along with its line items
+func (dm *DBModel) GetUserOrder(userID, orderID int) (*models.Order, error) {
+	query := `select o.order_id, o.ordered_at, o.price, o.discount, o.currency, o.status, o.payment_type, o.payment_provider, o.payment_ref, o.payment_status, coalesce(c.code, ''), o.shipping_address, o.billing_address,
+	coalesce(o.shipping_carrier, ''), coalesce(o.shipping_method, ''), o.shipping_cost, o.tax, o.included_tax
+	from orders o left join coupons c on c.coupon_id = o.coupon_id where o.order_id = ? and o.user_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	order := &models.Order{}
+	var shipping, billing []byte
+	delivery := &models.ShippingQuote{}
+	err = stmt.QueryRow(orderID, userID).Scan(&order.OrderID, &order.OrderedAt, &order.Price.Amount, &order.Discount.Amount, &order.Price.Currency, &order.Status, &order.PaymentMethod.Method, &order.PaymentMethod.Provider, &order.PaymentMethod.Reference, &order.PaymentMethod.Status, &order.CouponCode, &shipping, &billing, &delivery.Carrier, &delivery.Method, &delivery.Cost.Amount, &order.Tax.Amount, &order.IncludedTax.Amount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+
+	order.Discount.Currency = order.Price.Currency
+	order.Tax.Currency, order.IncludedTax.Currency = order.Price.Currency, order.Price.Currency
+	if err := orderAddressesFromJSON(order, shipping, billing); err != nil {
+		return nil, err
+	}
+	order.Shipping = orderDelivery(delivery, order.Price.Currency)
+
+	order.Items, err = getOrderItems(tx, order.OrderID, order.Price.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// line items of an order, prices are in the order's currency
+func getOrderItems(tx *sql.Tx, orderID int, currency string) ([]*models.OrderItem, error) {
+	query := `select product_id, product_name, price, quantity, color, size, tax, tax_rate, tax_inclusive from order_items where order_id = ? order by item_id`
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Items []*models.OrderItem
+	for rows.Next() {
+		item := &models.OrderItem{Price: models.NewMoney(0, currency), Tax: models.NewMoney(0, currency)}
+		if err := rows.Scan(&item.ProductID, &item.ProductName, &item.Price.Amount, &item.Quantity, &item.Color, &item.Size, &item.Tax.Amount, &item.TaxRate, &item.TaxInclusive); err != nil {
+			return nil, err
+		}
+		Items = append(Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return Items, nil
+}
+
+// payment details of an order and the amount it was authorized for
+func (dm *DBModel) GetOrderPayment(orderID int) (*models.Payment, models.Money, error) {
+	query := `select payment_type, payment_provider, payment_ref, payment_status, price - discount + tax + shipping_cost, currency from orders where order_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+	defer stmt.Close()
+
+	payment := &models.Payment{}
+	var amount models.Money
+	err = stmt.QueryRow(orderID).Scan(&payment.Method, &payment.Provider, &payment.Reference, &payment.Status, &amount.Amount, &amount.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, models.Money{}, utils.ErrNoRecord
+		}
+		return nil, models.Money{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, models.Money{}, err
+	}
+	return payment, amount, nil
+}
+
+// record new payment state of an order
+func (dm *DBModel) SetPaymentStatus(orderID int, status models.PaymentStatus) error {
+	query := `update orders set payment_status = ? where order_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(status, orderID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
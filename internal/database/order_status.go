@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// allowed moves between order statuses, anything not listed here is rejected
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderPending:   {models.OrderPaid, models.OrderCancelled},
+	models.OrderPaid:      {models.OrderPacked, models.OrderCancelled, models.OrderRefunded},
+	models.OrderPacked:    {models.OrderShipped, models.OrderCancelled, models.OrderRefunded},
+	models.OrderShipped:   {models.OrderDelivered},
+	models.OrderDelivered: {models.OrderRefunded},
+	models.OrderCancelled: {},
+	models.OrderRefunded:  {},
+}
+
+// check if an order can move from one status to the other
+func CanTransition(from, to models.OrderStatus) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// move order to status and record the change, caller owns the transaction
+// changedBy is invalid(null) when the system makes the change
+func transitionOrder(tx *sql.Tx, orderID int, changedBy sql.NullInt64, status models.OrderStatus) (*models.OrderStatusChange, error) {
+	if _, known := orderTransitions[status]; !known {
+		return nil, utils.ErrInvalidOrderStatus
+	}
+
+	var current models.OrderStatus
+	err := tx.QueryRow(`select status from orders where order_id = ? for update`, orderID).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	if !CanTransition(current, status) {
+		return nil, utils.ErrInvalidOrderTransition
+	}
+
+	stmt, err := tx.Prepare(`update orders set status = ? where order_id = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(status, orderID); err != nil {
+		return nil, err
+	}
+
+	historyStmt, err := tx.Prepare(`insert into order_status_history(order_id, from_status, to_status, changed_by) values(?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer historyStmt.Close()
+	if _, err := historyStmt.Exec(orderID, current, status, changedBy); err != nil {
+		return nil, err
+	}
+	//goods of a cancelled order go back on the shelf
+	if status == models.OrderCancelled {
+		if err := restoreStock(tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+	//paid orders are invoiced right away so numbers follow the order payments came in
+	if status == models.OrderPaid {
+		if _, err := issueInvoice(tx, orderID); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.OrderStatusChange{
+		OrderID:   orderID,
+		From:      current,
+		To:        status,
+		ChangedBy: int(changedBy.Int64),
+		ChangedAt: time.Now(),
+	}, nil
+}
+
+// change order status by admin
+func (dm *DBModel) UpdateOrderStatus(orderID, adminID int, status models.OrderStatus) (*models.OrderStatusChange, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change, err := transitionOrder(tx, orderID, sql.NullInt64{Int64: int64(adminID), Valid: true}, status)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return change, nil
+}
+
+// status changes of an order, oldest first
+func (dm *DBModel) GetOrderStatusHistory(orderID int) ([]*models.OrderStatusChange, error) {
+	query := `select order_id, from_status, to_status, changed_by, changed_at from order_status_history where order_id = ? order by history_id`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var History []*models.OrderStatusChange
+	for rows.Next() {
+		change := &models.OrderStatusChange{}
+		var changedBy sql.NullInt64
+		if err := rows.Scan(&change.OrderID, &change.From, &change.To, &changedBy, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		change.ChangedBy = int(changedBy.Int64)
+		History = append(History, change)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return History, nil
+}
+
+// get the user who placed an order
+func (dm *DBModel) GetOrderBuyer(orderID int) (*models.ResponseUser, error) {
+	query := `select u.id, u.first_name, u.last_name, u.email, u.phone_number from orders o join users u on u.id = o.user_id where o.order_id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	user := &models.ResponseUser{}
+	err = stmt.QueryRow(orderID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.PhoneNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
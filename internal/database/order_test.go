@@ -0,0 +1,141 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/tax"
+)
+
+// cart lines that drift when worked out as floats, 0.10 * 7 is 0.7000000000000001
+func driftingItems() []*models.OrderItem {
+	return []*models.OrderItem{
+		{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 3},
+		{ProductID: "prd-sticker", Price: models.NewMoney(10, "USD"), Quantity: 7},
+		{ProductID: "prd-book", Price: models.NewMoney(435, "USD"), Quantity: 2, TaxClass: "reduced"},
+	}
+}
+
+func TestOrderTotal(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []*models.OrderItem
+		want  models.Money
+		err   error
+	}{
+		{"empty", nil, models.Money{}, nil},
+		{"single line", []*models.OrderItem{{Price: models.NewMoney(1999, "USD"), Quantity: 3}}, models.NewMoney(5997, "USD"), nil},
+		{"multi line", driftingItems(), models.NewMoney(6937, "USD"), nil},
+		{"mixed currencies", []*models.OrderItem{
+			{Price: models.NewMoney(100, "USD"), Quantity: 1},
+			{Price: models.NewMoney(100, "EUR"), Quantity: 1},
+		}, models.Money{}, models.ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderTotal(tt.items)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("orderTotal() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("orderTotal() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrderDue(t *testing.T) {
+	delivery := func(cost models.Money) *models.ShippingQuote {
+		return &models.ShippingQuote{Carrier: "local", Method: "standard", Cost: cost}
+	}
+	coupon := func(discount models.Money) *models.AppliedCoupon {
+		return &models.AppliedCoupon{CouponID: 1, Code: "SAVE", Discount: discount}
+	}
+	tests := []struct {
+		name    string
+		items   []*models.OrderItem
+		details orderDetails
+		want    models.Money
+		err     error
+	}{
+		{"items only", driftingItems(), orderDetails{}, models.NewMoney(6937, "USD"), nil},
+		{"shipping", driftingItems(), orderDetails{delivery: delivery(models.NewMoney(799, "USD"))}, models.NewMoney(7736, "USD"), nil},
+		{"discount", driftingItems(), orderDetails{coupon: coupon(models.NewMoney(1040, "USD"))}, models.NewMoney(5897, "USD"), nil},
+		//69.37 - 10.40 + 3.92 + 7.99 is 70.88000000000001 as floats
+		{"discount, tax and shipping", driftingItems(), orderDetails{
+			coupon:   coupon(models.NewMoney(1040, "USD")),
+			tax:      models.NewMoney(392, "USD"),
+			delivery: delivery(models.NewMoney(799, "USD")),
+		}, models.NewMoney(7088, "USD"), nil},
+		{"included tax is not added", driftingItems(), orderDetails{includedTax: models.NewMoney(500, "USD")}, models.NewMoney(6937, "USD"), nil},
+		{"tax without currency", driftingItems(), orderDetails{tax: models.Money{Amount: 392}}, models.NewMoney(7329, "USD"), nil},
+		{"free shipping", driftingItems(), orderDetails{delivery: delivery(models.NewMoney(0, "USD"))}, models.NewMoney(6937, "USD"), nil},
+		{"shipping in another currency", driftingItems(), orderDetails{delivery: delivery(models.NewMoney(799, "EUR"))}, models.Money{}, models.ErrCurrencyMismatch},
+		{"discount in another currency", driftingItems(), orderDetails{coupon: coupon(models.NewMoney(100, "GBP"))}, models.Money{}, models.ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := orderDue(tt.items, tt.details)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("orderDue() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("orderDue() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// coupon and tax worked out the way checkout does, the total must come out to the cent
+func TestOrderDueWithCouponAndTax(t *testing.T) {
+	items := driftingItems()
+	address := &models.Address{Country: "US", Region: "CA"}
+	rules := []*models.TaxRule{
+		{Country: "US", TaxClass: models.DefaultTaxClass, Rate: 725},
+		{Country: "US", TaxClass: "reduced", Rate: 250},
+	}
+	active := true
+	percentOff := &models.Coupon{CouponID: 1, Code: "SAVE15", Kind: models.CouponPercentage, Percent: 15, Active: &active}
+
+	applied, err := evaluateCoupon(percentOff, items, 0, time.Now())
+	if err != nil {
+		t.Fatalf("evaluateCoupon() error = %v", err)
+	}
+	//15% of 69.37 is 10.4055, rounded down
+	if want := models.NewMoney(1040, "USD"); applied.Discount != want {
+		t.Fatalf("discount = %+v, want %+v", applied.Discount, want)
+	}
+
+	added, included, err := tax.Apply(rules, address, items, applied.Discount)
+	if err != nil {
+		t.Fatalf("tax.Apply() error = %v", err)
+	}
+	//discount is spread by line share: 8.99, 0.10 and 1.31 off the lines, taxed 3.70 + 0.04 + 0.18
+	wantLineTax := []int64{370, 4, 18}
+	for i, item := range items {
+		if item.Tax.Amount != wantLineTax[i] {
+			t.Errorf("line %d tax = %d, want %d", i, item.Tax.Amount, wantLineTax[i])
+		}
+	}
+	if want := models.NewMoney(392, "USD"); added != want {
+		t.Fatalf("added tax = %+v, want %+v", added, want)
+	}
+	if !included.IsZero() {
+		t.Fatalf("included tax = %+v, want zero", included)
+	}
+
+	details := orderDetails{
+		coupon:   applied,
+		tax:      added,
+		delivery: &models.ShippingQuote{Carrier: "local", Method: "standard", Cost: models.NewMoney(799, "USD")},
+	}
+	due, err := orderDue(items, details)
+	if err != nil {
+		t.Fatalf("orderDue() error = %v", err)
+	}
+	if want := models.NewMoney(7088, "USD"); due != want {
+		t.Errorf("orderDue() = %+v, want %+v", due, want)
+	}
+}
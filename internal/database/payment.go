@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* payment operations */
+
+// apply a provider event to the order holding authorizationID.
+// a duplicate event, one whose eventID was seen before, changes nothing.
+// money captured must match what the order is due. a capture on an order that can no longer be paid
+// (e.g cancelled) is recorded and flagged for refund, the caller gives the money back and marks the payment
+// refunded. until it does, replays of the event are flagged again so a failed refund is retried
+func (dm *DBModel) ReconcilePaymentEvent(provider, eventID, eventType, authorizationID string, status models.PaymentStatus, amount models.Money) (*models.PaymentReconciliation, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result := &models.PaymentReconciliation{}
+	var orderStatus models.OrderStatus
+	var current models.PaymentStatus
+	var due models.Money
+	err = tx.QueryRow(`select order_id, status, payment_status, price - discount + tax + shipping_cost, currency from orders where payment_provider = ? and payment_ref = ? for update`, provider, authorizationID).
+		Scan(&result.OrderID, &orderStatus, &current, &due.Amount, &due.Currency)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	if status == models.PaymentCaptured && amount != due {
+		return nil, utils.ErrPaymentMismatch
+	}
+
+	//the primary key on event_id rejects retries
+	eventStmt, err := tx.Prepare(`insert into payment_events(event_id, provider, event_type, order_id) values(?, ?, ?, ?)`)
+	if err != nil {
+		return nil, err
+	}
+	defer eventStmt.Close()
+	if _, err := eventStmt.Exec(eventID, provider, eventType, result.OrderID); err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			result.Duplicate = true
+			result.Refund = status == models.PaymentCaptured && current == models.PaymentCaptured &&
+				(orderStatus == models.OrderCancelled || orderStatus == models.OrderRefunded)
+			return result, nil
+		}
+		return nil, err
+	}
+
+	//money already moved on, e.g refunded by admin before the event arrived
+	if current == models.PaymentCaptured || current == models.PaymentRefunded {
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	next := models.OrderPaid
+	if status == models.PaymentFailed {
+		next = models.OrderCancelled
+	}
+	result.Change, err = transitionOrder(tx, result.OrderID, sql.NullInt64{}, next)
+	if err != nil {
+		if !errors.Is(err, utils.ErrInvalidOrderTransition) {
+			return nil, err
+		}
+		//a failed payment on an order that is already over changes nothing, a capture on one has to be given back
+		result.Refund = status == models.PaymentCaptured
+	}
+
+	stmt, err := tx.Prepare(`update orders set payment_status = ? where order_id = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	if _, err := stmt.Exec(status, result.OrderID); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
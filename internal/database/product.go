@@ -1,15 +1,17 @@
 package database
 
 import (
+	"database/sql"
 	"errors"
 
 	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
 )
 
 // TODO: push this to the products package.
 
-func NewProduct(name, description, image string, price float64) (*models.Product, error) {
+func NewProduct(name, description, image string, price models.Money) (*models.Product, error) {
 	uuid, err := utils.GenerateUUID("product")
 	return &models.Product{
 		ProductID:   uuid,
@@ -23,17 +25,33 @@ func NewProduct(name, description, image string, price float64) (*models.Product
 
 /* admin operations*/
 
-// add new product by admin
-func (dm *DBModel) AddProduct(adminID int, name, description, image string, price float64) (int64, error) {
+// add new product by admin, stock goes on the product's default variant and weight is in grams
+func (dm *DBModel) AddProduct(adminID int, name, description, image string, price models.Money, stock, weight int, taxClass string) (int64, error) {
 	//set ratings to 0 initially
-	if adminID != 1 {
-		return 0, errors.New("only admin can add products")
+	allowed, err := dm.UserHasPermission(adminID, models.PermCatalogWrite)
+	if err != nil {
+		return 0, err
+	}
+	if !allowed {
+		return 0, utils.ErrForbidden
+	}
+	if stock < 0 || weight < 0 {
+		return 0, utils.ErrInvalidQuantity
+	}
+	if price.Currency == "" {
+		price.Currency = models.DefaultCurrency
+	}
+	if err := price.Validate(); err != nil {
+		return 0, err
+	}
+	if taxClass == "" {
+		taxClass = models.DefaultTaxClass
 	}
 	product, err := NewProduct(name, description, image, price)
 	if err != nil {
 		return 0, err
 	}
-	query := `insert into products(product_id, product_name, description, image, price, rating) values(?, ?, ?, ?, ?, ?)`
+	query := `insert into products(product_id, product_name, description, image, price, currency, rating, weight, tax_class) values(?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -45,8 +63,9 @@ func (dm *DBModel) AddProduct(adminID int, name, description, image string, pric
 	if err != nil {
 		return 0, err
 	}
+	defer stmt.Close()
 
-	result, err := stmt.Exec(product.ProductID, product.ProductName, product.Description, product.Image, product.Price, product.Rating)
+	result, err := stmt.Exec(product.ProductID, product.ProductName, product.Description, product.Image, product.Price.Amount, product.Price.Currency, product.Rating, weight, taxClass)
 	if err != nil {
 		return 0, err
 	}
@@ -54,6 +73,9 @@ func (dm *DBModel) AddProduct(adminID int, name, description, image string, pric
 	if err != nil {
 		return 0, err
 	}
+	if _, err := tx.Exec(`insert into product_variants(product_id, color, size, stock) values(?, '', '', ?)`, product.ProductID, stock); err != nil {
+		return 0, err
+	}
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
@@ -83,8 +105,9 @@ func (dm *DBModel) CheckProductExist(productUUID string) (int, error) {
 }
 
 // out of units  --admin stuff
+// product stays in the store so carts and orders referencing it keep working
 func (dm *DBModel) RemoveProductFromStore(productUUID string) error {
-	query := `delete from products where product_id = ?`
+	query := `update product_variants set stock = 0 where product_id = ?`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -102,6 +125,10 @@ func (dm *DBModel) RemoveProductFromStore(productUUID string) error {
 	if err != nil {
 		return err
 	}
+	_, err = tx.Exec(`delete from stock_reservations where variant_id in (select variant_id from product_variants where product_id = ?)`, productUUID)
+	if err != nil {
+		return err
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -110,77 +137,131 @@ func (dm *DBModel) RemoveProductFromStore(productUUID string) error {
 
 /* Normal Product operations */
 
-// viewProducts --a list of products for home page
-func (dm *DBModel) ViewHomeProducts() ([]*models.ResponseProduct, error) {
-	query := `select product_name, description, image, price, rating from products limit 30`
+// sorts of product lists, newest first unless asked otherwise
+var productKeyset = &pagination.Keyset{
+	ID: "p.id",
+	Sorts: map[string]pagination.Sort{
+		"newest":     {Desc: true},
+		"oldest":     {},
+		"price_asc":  {Column: "p.price"},
+		"price_desc": {Column: "p.price", Desc: true},
+		"rating":     {Column: "coalesce(p.rating, 0)", Desc: true},
+		"name":       {Column: "coalesce(p.product_name, '')"},
+	},
+	Default: "newest",
+}
 
-	tx, err := dm.DB.Begin()
-	if err != nil {
-		return nil, err
-	}
-	defer tx.Rollback()
+// product along with the row id it is paged by
+type productRow struct {
+	id      int64
+	product *models.ResponseProduct
+}
 
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		return nil, err
-	}
-	defer stmt.Close()
+// page of the products p that meet filter, caller owns the transaction
+func productPage(tx *sql.Tx, filter string, args []interface{}, q *pagination.Query) ([]*models.ResponseProduct, *models.Page, error) {
+	where, pageArgs := q.Where()
+	query := `select p.id, p.product_id, coalesce(p.product_name, ''), p.description, p.image, p.price, p.currency, coalesce(p.rating, 0) from products p
+	where ` + filter + ` and ` + where + ` order by ` + q.OrderBy() + ` limit ?`
 
-	rows, err := stmt.Query()
+	rows, err := tx.Query(query, append(append(args, pageArgs...), q.Limit())...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	var Products []*models.ResponseProduct
+	defer rows.Close()
+
+	var Rows []productRow
 	for rows.Next() {
-		product := &models.ResponseProduct{}
-		if err := rows.Scan(&product.ProductName, &product.Description, &product.Image, &product.Price, &product.Rating); err != nil {
-			return nil, err
+		row := productRow{product: &models.ResponseProduct{}}
+		product := row.product
+		if err := rows.Scan(&row.id, &product.ProductID, &product.ProductName, &product.Description, &product.Image, &product.Price.Amount, &product.Price.Currency, &product.Rating); err != nil {
+			return nil, nil, err
 		}
-		if err := rows.Err(); err != nil {
-			return nil, err
+		Rows = append(Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	Rows, page := pagination.Trim(q, Rows, func(row productRow) (interface{}, int64) {
+		switch q.Sort() {
+		case "price_asc", "price_desc":
+			return row.product.Price.Amount, row.id
+		case "rating":
+			return int64(row.product.Rating), row.id
+		case "name":
+			return row.product.ProductName, row.id
 		}
-		Products = append(Products, product)
+		return nil, row.id
+	})
+	Products := make([]*models.ResponseProduct, len(Rows))
+	for i, row := range Rows {
+		Products[i] = row.product
 	}
-	return Products, nil
+	return Products, page, nil
 }
 
-// get product for other Operations by product uuid
-func (dm *DBModel) GetProduct(productUUID string) (*models.Product, error) {
-	query := `select product_name, description, image, price, rating from products where product_id = ?`
-
+// viewProducts --a page of products for home page.
+// categorySlug features one category and its subcategories, without one the featured categories are shown
+// and when no category is featured it is the whole catalog
+func (dm *DBModel) ViewHomeProducts(categorySlug string, params pagination.Params) ([]*models.ResponseProduct, *models.Page, error) {
+	q, err := productKeyset.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
 	tx, err := dm.DB.Begin()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		return nil, err
+	var slugs []string
+	if categorySlug != "" {
+		slugs = []string{categorySlug}
+	} else {
+		rows, err := tx.Query(`select slug from categories where featured = true`)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var slug string
+			if err := rows.Scan(&slug); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			slugs = append(slugs, slug)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
 	}
-	defer stmt.Close()
 
-	row, err := stmt.Query(productUUID)
-	if err != nil {
-		return nil, err
-	}
-	defer row.Close()
-	var Product models.Product
-	if row.Next() {
-		err = row.Scan(&Product.ProductName, &Product.Description, &Product.Image, &Product.Price, &Product.Rating)
+	var Products []*models.ResponseProduct
+	var page *models.Page
+	if len(slugs) > 0 {
+		categoryIDs, err := categoryIDsWithSubtree(tx, slugs)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		Products, page, err = categoriesProducts(tx, categoryIDs, q)
+		if err != nil {
+			return nil, nil, err
+		}
+	} else {
+		Products, page, err = productPage(tx, "true", nil, q)
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return &Product, nil
+	return Products, page, nil
 }
 
-// search for Product by name
-func (dm *DBModel) GetProductByName(name string) ([]*models.ResponseProduct, error) {
-	query := `select product_name, description, price, rating,image from products where product_name like ?`
+// get product for other Operations by product uuid
+func (dm *DBModel) GetProduct(productUUID string) (*models.Product, error) {
+	query := `select id, product_id, product_name, description, image, price, currency, rating, review_count from products where product_id = ?`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
@@ -188,30 +269,22 @@ func (dm *DBModel) GetProductByName(name string) ([]*models.ResponseProduct, err
 	}
 	defer tx.Rollback()
 
-	//create statament
 	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return nil, err
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(name)
+	var Product models.Product
+	err = stmt.QueryRow(productUUID).Scan(&Product.ID, &Product.ProductID, &Product.ProductName, &Product.Description, &Product.Image, &Product.Price.Amount, &Product.Price.Currency, &Product.Rating, &Product.ReviewCount)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var Products []*models.ResponseProduct
-	for rows.Next() {
-		product := &models.ResponseProduct{}
-		err := rows.Scan(&product.ProductName, &product.Description, &product.Price, &product.Rating, &product.Image)
-		if err != nil {
-			return nil, err
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
 		}
-		Products = append(Products, product)
+		return nil, err
 	}
 	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
-	return Products, nil
+	return &Product, nil
 }
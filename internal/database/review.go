@@ -0,0 +1,281 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* review operations */
+
+// longest review text accepted, in characters
+const maxReviewLength = 2000
+
+// sorts of a product's reviews, newest first unless asked otherwise
+var reviewKeyset = &pagination.Keyset{
+	ID: "r.review_id",
+	Sorts: map[string]pagination.Sort{
+		"newest":      {Desc: true},
+		"oldest":      {},
+		"rating_desc": {Column: "r.rating", Desc: true},
+		"rating_asc":  {Column: "r.rating"},
+	},
+	Default: "newest",
+}
+
+// tidy up review text and check rating is 1 to 5
+func validateReview(rating int, body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if rating < 1 || rating > 5 || utf8.RuneCountInString(body) > maxReviewLength {
+		return "", utils.ErrInvalidReview
+	}
+	return body, nil
+}
+
+// lock product row so changes to its reviews or images go one at a time, caller owns the transaction
+func lockProduct(tx *sql.Tx, productUUID string) error {
+	var id int
+	err := tx.QueryRow(`select id from products where product_id = ? for update`, productUUID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return utils.ErrNoRecord
+	}
+	return err
+}
+
+// recompute rating and review count of a product from its visible reviews, caller owns the transaction
+func refreshProductRating(tx *sql.Tx, productUUID string) error {
+	_, err := tx.Exec(`update products set
+	rating = (select coalesce(round(avg(rating)), 0) from reviews where product_id = ? and hidden = false),
+	review_count = (select count(*) from reviews where product_id = ? and hidden = false)
+	where product_id = ?`, productUUID, productUUID, productUUID)
+	return err
+}
+
+// lock product of a review and the review itself, userID 0 is any user's review.
+// caller owns the transaction
+func lockReview(tx *sql.Tx, reviewID, userID int) (string, error) {
+	var productUUID string
+	var authorID int
+	err := tx.QueryRow(`select product_id, user_id from reviews where review_id = ?`, reviewID).Scan(&productUUID, &authorID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", utils.ErrNoRecord
+		}
+		return "", err
+	}
+	if userID != 0 && authorID != userID {
+		return "", utils.ErrNoRecord
+	}
+	//product first, the same order reviews are added in
+	if err := lockProduct(tx, productUUID); err != nil {
+		return "", err
+	}
+	err = tx.QueryRow(`select product_id from reviews where review_id = ? for update`, reviewID).Scan(&productUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", utils.ErrNoRecord
+	}
+	return productUUID, err
+}
+
+// review by id, caller owns the transaction
+func getReview(tx *sql.Tx, reviewID int) (*models.Review, error) {
+	review := &models.Review{}
+	err := tx.QueryRow(`select r.review_id, r.product_id, r.user_id, u.first_name, r.rating, coalesce(r.body, ''), r.hidden, r.created_at, r.updated_at
+	from reviews r join users u on u.id = r.user_id where r.review_id = ?`, reviewID).
+		Scan(&review.ReviewID, &review.ProductID, &review.UserID, &review.Author, &review.Rating, &review.Body, &review.Hidden, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	return review, nil
+}
+
+// post a review of a product user has had delivered, one per user and product
+func (dm *DBModel) AddReview(userID int, productUUID string, rating int, body string) (*models.Review, error) {
+	body, err := validateReview(rating, body)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockProduct(tx, productUUID); err != nil {
+		return nil, err
+	}
+	var delivered bool
+	err = tx.QueryRow(`select exists(select 1 from orders o join order_items i on i.order_id = o.order_id
+	where o.user_id = ? and i.product_id = ? and o.status = ?)`, userID, productUUID, models.OrderDelivered).Scan(&delivered)
+	if err != nil {
+		return nil, err
+	}
+	if !delivered {
+		return nil, utils.ErrNotPurchased
+	}
+
+	result, err := tx.Exec(`insert into reviews(product_id, user_id, rating, body) values(?, ?, ?, ?)`, productUUID, userID, rating, body)
+	if err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return nil, utils.ErrExistingReview
+		}
+		return nil, err
+	}
+	reviewID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := refreshProductRating(tx, productUUID); err != nil {
+		return nil, err
+	}
+	review, err := getReview(tx, int(reviewID))
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// change rating and text of user's own review, a hidden review stays hidden
+func (dm *DBModel) UpdateReview(userID, reviewID, rating int, body string) (*models.Review, error) {
+	body, err := validateReview(rating, body)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	productUUID, err := lockReview(tx, reviewID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`update reviews set rating = ?, body = ? where review_id = ?`, rating, body, reviewID); err != nil {
+		return nil, err
+	}
+	if err := refreshProductRating(tx, productUUID); err != nil {
+		return nil, err
+	}
+	review, err := getReview(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// hide or show a review, hidden reviews stop counting towards the rating --admin stuff
+func (dm *DBModel) ModerateReview(reviewID int, hidden bool) (*models.Review, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	productUUID, err := lockReview(tx, reviewID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`update reviews set hidden = ?, updated_at = updated_at where review_id = ?`, hidden, reviewID); err != nil {
+		return nil, err
+	}
+	if err := refreshProductRating(tx, productUUID); err != nil {
+		return nil, err
+	}
+	review, err := getReview(tx, reviewID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// remove a review for good --admin stuff
+func (dm *DBModel) DeleteReview(reviewID int) error {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	productUUID, err := lockReview(tx, reviewID, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`delete from reviews where review_id = ?`, reviewID); err != nil {
+		return err
+	}
+	if err := refreshProductRating(tx, productUUID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// page of reviews of a product, empty productUUID is every product.
+// hidden reviews are only included for moderation
+func (dm *DBModel) GetReviews(productUUID string, includeHidden bool, params pagination.Params) ([]*models.Review, *models.Page, error) {
+	q, err := reviewKeyset.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	where, args := q.Where()
+	query := `select r.review_id, r.product_id, r.user_id, u.first_name, r.rating, coalesce(r.body, ''), r.hidden, r.created_at, r.updated_at
+	from reviews r join users u on u.id = r.user_id
+	where (? = '' or r.product_id = ?) and (? or r.hidden = false) and ` + where + ` order by ` + q.OrderBy() + ` limit ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(append(append([]interface{}{productUUID, productUUID, includeHidden}, args...), q.Limit())...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	Reviews := []*models.Review{}
+	for rows.Next() {
+		review := &models.Review{}
+		if err := rows.Scan(&review.ReviewID, &review.ProductID, &review.UserID, &review.Author, &review.Rating, &review.Body, &review.Hidden, &review.CreatedAt, &review.UpdatedAt); err != nil {
+			return nil, nil, err
+		}
+		Reviews = append(Reviews, review)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	Reviews, page := pagination.Trim(q, Reviews, func(review *models.Review) (interface{}, int64) {
+		return int64(review.Rating), int64(review.ReviewID)
+	})
+	return Reviews, page, nil
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* role operations */
+
+// names of the roles held by user, caller owns the transaction
+func userRoles(tx *sql.Tx, userID int) ([]string, error) {
+	query := `select r.name from user_roles ur join roles r on r.role_id = ur.role_id where ur.user_id = ? order by r.name`
+	rows, err := tx.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Roles []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		Roles = append(Roles, name)
+	}
+	return Roles, rows.Err()
+}
+
+// check if any of the named roles grants permission, used by the permission middleware
+func (dm *DBModel) RolesHavePermission(roles []string, permission string) (bool, error) {
+	if len(roles) == 0 {
+		return false, nil
+	}
+	query := `select count(*) from role_permissions rp join roles r on r.role_id = rp.role_id join permissions p on p.permission_id = rp.permission_id
+	where p.name = ? and r.name in (?` + strings.Repeat(", ?", len(roles)-1) + `)`
+
+	args := make([]interface{}, 0, len(roles)+1)
+	args = append(args, permission)
+	for _, role := range roles {
+		args = append(args, role)
+	}
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// check if user currently holds a role that grants permission
+func (dm *DBModel) UserHasPermission(userID int, permission string) (bool, error) {
+	query := `select count(*) from user_roles ur join role_permissions rp on rp.role_id = ur.role_id join permissions p on p.permission_id = rp.permission_id
+	where ur.user_id = ? and p.name = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	if err := tx.QueryRow(query, userID, permission).Scan(&count); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// every role with the permissions it grants --admin stuff
+func (dm *DBModel) GetRoles() ([]*models.Role, error) {
+	query := `select r.role_id, r.name, coalesce(p.name, '') from roles r
+	left join role_permissions rp on rp.role_id = r.role_id left join permissions p on p.permission_id = rp.permission_id
+	order by r.role_id, p.name`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Roles []*models.Role
+	for rows.Next() {
+		var roleID int
+		var name, permission string
+		if err := rows.Scan(&roleID, &name, &permission); err != nil {
+			return nil, err
+		}
+		//rows come grouped by role
+		if len(Roles) == 0 || Roles[len(Roles)-1].RoleID != roleID {
+			Roles = append(Roles, &models.Role{RoleID: roleID, Name: name, Permissions: []string{}})
+		}
+		if permission != "" {
+			role := Roles[len(Roles)-1]
+			role.Permissions = append(role.Permissions, permission)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Roles, nil
+}
+
+// replace the roles of a user, an empty list takes away admin access --admin stuff
+func (dm *DBModel) SetUserRoles(userID int, roles []string) ([]string, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow(`select count(*) > 0 from users where id = ?`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, utils.ErrNoRecord
+	}
+
+	if _, err := tx.Exec(`delete from user_roles where user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare(`insert ignore into user_roles(user_id, role_id) select ?, role_id from roles where name = ?`)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, role := range roles {
+		result, err := stmt.Exec(userID, role)
+		if err != nil {
+			return nil, err
+		}
+		//nothing inserted and not a duplicate means there is no such role
+		if rows, err := result.RowsAffected(); err == nil && rows == 0 {
+			var known bool
+			if err := tx.QueryRow(`select count(*) > 0 from roles where name = ?`, role).Scan(&known); err != nil {
+				return nil, err
+			}
+			if !known {
+				return nil, utils.ErrUnknownRole
+			}
+		}
+	}
+
+	granted, err := userRoles(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return granted, nil
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
+	"github.com/h3th-IV/mysticMerch/internal/search"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* catalog search operations */
+
+const (
+	matchExpr   = `match(p.product_name, p.description) against (? in boolean mode)`
+	inStockExpr = `exists(select 1 from product_variants v where v.product_id = p.product_id and v.stock > 0)`
+)
+
+// order by clause for each sort, newer products break ties
+var searchOrder = map[models.SearchSort]string{
+	models.SortRelevance: `score desc, p.id desc`,
+	models.SortNewest:    `p.id desc`,
+	models.SortPriceAsc:  `p.price, p.id desc`,
+	models.SortPriceDesc: `p.price desc, p.id desc`,
+	models.SortRating:    `coalesce(p.rating, 0) desc, p.id desc`,
+}
+
+// FULLTEXT index is missing (1191) or the table engine has none (1214), e.g a test database
+func noFulltextIndex(err error) bool {
+	return errors.As(err, &utils.MySQLErr) && (utils.MySQLErr.Number == 1191 || utils.MySQLErr.Number == 1214)
+}
+
+// boolean mode query where every term must start a word, e.g "+blue* +shirt*"
+func booleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		parts[i] = "+" + term + "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// where clause over products p for the filters of a search
+func searchWhere(q *models.ProductQuery, terms []string, categoryIDs []int) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(terms) > 0 {
+		conditions = append(conditions, matchExpr)
+		args = append(args, booleanQuery(terms))
+	}
+	if q.MinPrice > 0 {
+		conditions = append(conditions, `p.price >= ?`)
+		args = append(args, q.MinPrice)
+	}
+	if q.MaxPrice > 0 {
+		conditions = append(conditions, `p.price <= ?`)
+		args = append(args, q.MaxPrice)
+	}
+	if q.MinRating > 0 {
+		conditions = append(conditions, `coalesce(p.rating, 0) >= ?`)
+		args = append(args, q.MinRating)
+	}
+	if categoryIDs != nil {
+		placeholders, ids := inClause(categoryIDs)
+		conditions = append(conditions, `p.product_id in (select product_id from product_categories where category_id in (`+placeholders+`))`)
+		args = append(args, ids...)
+	}
+	if q.InStock {
+		conditions = append(conditions, inStockExpr)
+	}
+	if len(conditions) == 0 {
+		return "true", nil
+	}
+	return strings.Join(conditions, " and "), args
+}
+
+// page of products matching a search, caller owns the transaction
+func searchPage(tx *sql.Tx, q *models.ProductQuery, terms []string, where string, args []interface{}) ([]*models.ResponseProduct, error) {
+	score, scoreArgs := "0", []interface{}(nil)
+	if len(terms) > 0 {
+		score, scoreArgs = matchExpr, []interface{}{booleanQuery(terms)}
+	}
+	query := `select p.product_id, p.product_name, p.description, p.image, p.price, p.currency, coalesce(p.rating, 0), ` + score + ` as score
+	from products p where ` + where + ` order by ` + searchOrder[q.Sort] + ` limit ? offset ?`
+
+	args = append(append(scoreArgs, args...), q.Limit, q.Offset)
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	Products := []*models.ResponseProduct{}
+	for rows.Next() {
+		product := &models.ResponseProduct{}
+		var relevance float64
+		if err := rows.Scan(&product.ProductID, &product.ProductName, &product.Description, &product.Image, &product.Price.Amount, &product.Price.Currency, &product.Rating, &relevance); err != nil {
+			return nil, err
+		}
+		Products = append(Products, product)
+	}
+	return Products, rows.Err()
+}
+
+// total and facet counts of every product matching a search, caller owns the transaction
+func searchFacets(tx *sql.Tx, where string, args []interface{}) (int, *models.SearchFacets, error) {
+	facets := search.NewFacets()
+	var total int
+	err := tx.QueryRow(`select count(*), coalesce(min(p.price), 0), coalesce(max(p.price), 0), coalesce(sum(`+inStockExpr+`), 0) from products p where `+where, args...).
+		Scan(&total, &facets.MinPrice, &facets.MaxPrice, &facets.InStock)
+	if err != nil {
+		return 0, nil, err
+	}
+	if total == 0 {
+		return 0, facets, nil
+	}
+
+	rows, err := tx.Query(`select c.slug, c.name, count(*) from products p
+	join product_categories pc on pc.product_id = p.product_id
+	join categories c on c.category_id = pc.category_id
+	where `+where+` group by c.category_id, c.slug, c.name`, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		facet := &models.CategoryFacet{}
+		if err := rows.Scan(&facet.Slug, &facet.Name, &facet.Count); err != nil {
+			return 0, nil, err
+		}
+		facets.Categories = append(facets.Categories, facet)
+	}
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	ratingRows, err := tx.Query(`select coalesce(p.rating, 0) as stars, count(*) from products p where `+where+` group by stars`, args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer ratingRows.Close()
+	for ratingRows.Next() {
+		facet := &models.RatingFacet{}
+		if err := ratingRows.Scan(&facet.Rating, &facet.Count); err != nil {
+			return 0, nil, err
+		}
+		facets.Ratings = append(facets.Ratings, facet)
+	}
+	if err := ratingRows.Err(); err != nil {
+		return 0, nil, err
+	}
+	search.SortFacets(facets)
+	return total, facets, nil
+}
+
+// every product with its categories and stock for the in-memory search, caller owns the transaction
+func searchDocuments(tx *sql.Tx) ([]*models.SearchDocument, error) {
+	categories, err := allCategories(tx)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]*models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.CategoryID] = category
+	}
+
+	rows, err := tx.Query(`select p.id, p.product_id, p.product_name, p.description, p.image, p.price, p.currency, coalesce(p.rating, 0), ` + inStockExpr + ` from products p`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var Documents []*models.SearchDocument
+	byProduct := make(map[string]*models.SearchDocument)
+	for rows.Next() {
+		doc := &models.SearchDocument{}
+		product := &doc.Product
+		if err := rows.Scan(&doc.Seq, &product.ProductID, &product.ProductName, &product.Description, &product.Image, &product.Price.Amount, &product.Price.Currency, &product.Rating, &doc.InStock); err != nil {
+			return nil, err
+		}
+		Documents = append(Documents, doc)
+		byProduct[product.ProductID] = doc
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	linkRows, err := tx.Query(`select product_id, category_id from product_categories`)
+	if err != nil {
+		return nil, err
+	}
+	defer linkRows.Close()
+	for linkRows.Next() {
+		var productID string
+		var categoryID int
+		if err := linkRows.Scan(&productID, &categoryID); err != nil {
+			return nil, err
+		}
+		if doc, ok := byProduct[productID]; ok && byID[categoryID] != nil {
+			doc.Categories = append(doc.Categories, byID[categoryID])
+		}
+	}
+	return Documents, linkRows.Err()
+}
+
+// search the catalog by text and filters, ranked by FULLTEXT relevance.
+// falls back to searching in memory when the database has no FULLTEXT index.
+// ranked results have no stable key so pages are cut by position
+func (dm *DBModel) SearchProducts(q *models.ProductQuery, params pagination.Params) (*models.SearchResult, error) {
+	q.Sort = models.SearchSort(params.Sort)
+	if err := search.Validate(q); err != nil {
+		return nil, err
+	}
+	offset, err := pagination.Offset(params, string(q.Sort))
+	if err != nil {
+		return nil, err
+	}
+	q.Limit, q.Offset = params.Limit, offset
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var categoryIDs []int
+	if q.Category != "" {
+		if categoryIDs, err = categoryIDsWithSubtree(tx, []string{q.Category}); err != nil {
+			return nil, err
+		}
+	}
+
+	terms := search.Terms(q.Text)
+	where, args := searchWhere(q, terms, categoryIDs)
+	result := &models.SearchResult{}
+	result.Products, err = searchPage(tx, q, terms, where, args)
+	if err == nil {
+		result.Total, result.Facets, err = searchFacets(tx, where, args)
+	}
+	if err != nil {
+		if !noFulltextIndex(err) || len(terms) == 0 {
+			return nil, err
+		}
+		utils.ReplaceLogger.Warn("products have no FULLTEXT index, searching in memory")
+		docs, err := searchDocuments(tx)
+		if err != nil {
+			return nil, err
+		}
+		result = search.Memory(docs, q, categoryIDs)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Page = pagination.OffsetPage(params, string(q.Sort), offset, result.Total)
+	return result, nil
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* shipping operations */
+
+// shipping zones with their rates, used by the local carrier
+func (dm *DBModel) GetShippingZones() ([]*models.ShippingZone, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`select zone_id, name, country, city, postal_prefix from shipping_zones order by zone_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Zones []*models.ShippingZone
+	byID := make(map[int]*models.ShippingZone)
+	for rows.Next() {
+		zone := &models.ShippingZone{}
+		if err := rows.Scan(&zone.ZoneID, &zone.Name, &zone.Country, &zone.City, &zone.PostalPrefix); err != nil {
+			return nil, err
+		}
+		Zones = append(Zones, zone)
+		byID[zone.ZoneID] = zone
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rateRows, err := tx.Query(`select rate_id, zone_id, method, name, kind, min_weight, coalesce(max_weight, 0), price, currency, delivery_days from shipping_rates order by zone_id, min_weight`)
+	if err != nil {
+		return nil, err
+	}
+	defer rateRows.Close()
+	for rateRows.Next() {
+		rate := &models.ShippingRate{}
+		var zoneID int
+		if err := rateRows.Scan(&rate.RateID, &zoneID, &rate.Method, &rate.Name, &rate.Kind, &rate.MinWeight, &rate.MaxWeight, &rate.Price.Amount, &rate.Price.Currency, &rate.DeliveryDays); err != nil {
+			return nil, err
+		}
+		if zone, ok := byID[zoneID]; ok {
+			zone.Rates = append(zone.Rates, rate)
+		}
+	}
+	if err := rateRows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Zones, nil
+}
+
+// total weight in grams of line items, caller owns the transaction
+func itemsWeight(tx *sql.Tx, items []*models.OrderItem) (int, error) {
+	stmt, err := tx.Prepare(`select weight from products where product_id = ?`)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	var total int
+	for _, item := range items {
+		var weight int
+		if err := stmt.QueryRow(item.ProductID).Scan(&weight); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return 0, utils.ErrNoRecord
+			}
+			return 0, err
+		}
+		total += weight * item.Quantity
+	}
+	return total, nil
+}
+
+// parcel for line items going to address, caller owns the transaction
+func newParcel(tx *sql.Tx, items []*models.OrderItem, address *models.Address) (*models.Parcel, error) {
+	subtotal, err := orderTotal(items)
+	if err != nil {
+		return nil, err
+	}
+	weight, err := itemsWeight(tx, items)
+	if err != nil {
+		return nil, err
+	}
+	return &models.Parcel{
+		Destination: address,
+		Weight:      weight,
+		Subtotal:    subtotal,
+	}, nil
+}
+
+// parcel of user cart going to a saved address, 0 is the default shipping address.
+// the cart coupon comes along so free shipping can be shown on quotes
+func (dm *DBModel) CartParcel(userID, addressID int) (*models.Parcel, *models.AppliedCoupon, error) {
+	cart, err := dm.GetUserCart(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(cart) == 0 {
+		return nil, nil, utils.ErrEmptyCart
+	}
+	items := cartItems(cart)
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	address, _, err := orderAddresses(tx, userID, addressID, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	parcel, err := newParcel(tx, items, address)
+	if err != nil {
+		return nil, nil, err
+	}
+	coupon, err := previewCartCoupon(tx, userID, items)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return parcel, coupon, nil
+}
+
+// price shipping of line items to address, caller owns the transaction
+func quoteDelivery(tx *sql.Tx, items []*models.OrderItem, address *models.Address, quote QuoteFunc) (*models.ShippingQuote, error) {
+	parcel, err := newParcel(tx, items, address)
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := quote(parcel)
+	if err != nil {
+		return nil, err
+	}
+	//quotes may be shared by the carrier, the order gets its own copy
+	copied := *delivery
+	return &copied, nil
+}
+
+// shipping stored on an order, nil when the order was not shipped
+func orderDelivery(delivery *models.ShippingQuote, currency string) *models.ShippingQuote {
+	if delivery.Carrier == "" {
+		return nil
+	}
+	delivery.Cost.Currency = currency
+	return delivery
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/shipping"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// grams per unit of the products the shipping tests put in parcels
+var productWeights = map[string]int64{
+	"prd-shirt":   250,
+	"prd-sticker": 10,
+	"prd-book":    600,
+}
+
+var registerWeightDriver sync.Once
+
+// transaction on a database that only answers product weight lookups
+func weightTx(t *testing.T) *sql.Tx {
+	registerWeightDriver.Do(func() { sql.Register("weightdb", weightDriver{}) })
+	db, err := sql.Open("weightdb", "")
+	if err != nil {
+		t.Fatalf("sql.Open() error = %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+func TestQuoteDelivery(t *testing.T) {
+	//same zones as the local carrier reads from shipping_zones and shipping_rates
+	zones := []*models.ShippingZone{
+		{ZoneID: 1, Name: "Nigeria", Country: "NG", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "Light", Kind: models.ShippingByWeight, MaxWeight: 1000, Price: models.NewMoney(1500, "USD"), DeliveryDays: 5},
+			{Method: "standard", Name: "Heavy", Kind: models.ShippingByWeight, MinWeight: 1000, Price: models.NewMoney(3000, "USD"), DeliveryDays: 5},
+		}},
+		{ZoneID: 2, Name: "Lagos", Country: "NG", City: "Lagos", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "Lagos", Kind: models.ShippingFlat, Price: models.NewMoney(800, "USD"), DeliveryDays: 2},
+		}},
+	}
+	carrier := shipping.NewLocalCarrier(func() ([]*models.ShippingZone, error) { return zones, nil })
+	quote := func(parcel *models.Parcel) (*models.ShippingQuote, error) {
+		rates, err := carrier.Rates(parcel)
+		if err != nil {
+			return nil, err
+		}
+		return rates[0], nil
+	}
+	abuja := &models.Address{Country: "NG", City: "Abuja"}
+
+	tests := []struct {
+		name    string
+		items   []*models.OrderItem
+		address *models.Address
+		quote   QuoteFunc
+		want    string //name of the rate the order is shipped with
+		err     error
+	}{
+		//3 shirts and 7 stickers weigh 820g
+		{"weight of every unit", []*models.OrderItem{
+			{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 3},
+			{ProductID: "prd-sticker", Price: models.NewMoney(10, "USD"), Quantity: 7},
+		}, abuja, quote, "Light", nil},
+		//2 books weigh 1200g
+		{"heavier bracket", []*models.OrderItem{
+			{ProductID: "prd-book", Price: models.NewMoney(435, "USD"), Quantity: 2},
+		}, abuja, quote, "Heavy", nil},
+		{"zone of the address", []*models.OrderItem{
+			{ProductID: "prd-book", Price: models.NewMoney(435, "USD"), Quantity: 2},
+		}, &models.Address{Country: "NG", City: "Lagos"}, quote, "Lagos", nil},
+		{"no zone for the address", []*models.OrderItem{
+			{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 1},
+		}, &models.Address{Country: "GH", City: "Accra"}, quote, "", utils.ErrNoShippingRate},
+		{"unknown carrier", []*models.OrderItem{
+			{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 1},
+		}, abuja, func(parcel *models.Parcel) (*models.ShippingQuote, error) {
+			return shipping.Quote("pigeon", "", parcel)
+		}, "", utils.ErrUnknownCarrier},
+		{"product without a weight", []*models.OrderItem{
+			{ProductID: "prd-missing", Price: models.NewMoney(1999, "USD"), Quantity: 1},
+		}, abuja, quote, "", utils.ErrNoRecord},
+		{"mixed currencies", []*models.OrderItem{
+			{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 1},
+			{ProductID: "prd-book", Price: models.NewMoney(435, "EUR"), Quantity: 1},
+		}, abuja, quote, "", models.ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery, err := quoteDelivery(weightTx(t), tt.items, tt.address, tt.quote)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("quoteDelivery() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && delivery.Name != tt.want {
+				t.Errorf("quoteDelivery() = %q, want %q", delivery.Name, tt.want)
+			}
+		})
+	}
+}
+
+// the carrier's quote is shared, changing the order's copy must not reach it
+func TestQuoteDeliveryCopies(t *testing.T) {
+	shared := &models.ShippingQuote{Carrier: shipping.CarrierLocal, Method: "standard", Name: "Standard", Cost: models.NewMoney(1500, "USD")}
+	items := []*models.OrderItem{{ProductID: "prd-shirt", Price: models.NewMoney(1999, "USD"), Quantity: 1}}
+	var parcel *models.Parcel
+	delivery, err := quoteDelivery(weightTx(t), items, &models.Address{Country: "NG"}, func(p *models.Parcel) (*models.ShippingQuote, error) {
+		parcel = p
+		return shared, nil
+	})
+	if err != nil {
+		t.Fatalf("quoteDelivery() error = %v", err)
+	}
+	want := &models.Parcel{Destination: &models.Address{Country: "NG"}, Weight: 250, Subtotal: models.NewMoney(1999, "USD")}
+	if !reflect.DeepEqual(parcel, want) {
+		t.Errorf("quoteDelivery() parcel = %+v, want %+v", parcel, want)
+	}
+	delivery.Cost = models.NewMoney(0, "USD")
+	if shared.Cost != models.NewMoney(1500, "USD") {
+		t.Errorf("quoteDelivery() returned the carrier's quote, cost changed to %+v", shared.Cost)
+	}
+}
+
+type weightDriver struct{}
+
+func (weightDriver) Open(name string) (driver.Conn, error) { return weightConn{}, nil }
+
+type weightConn struct{}
+
+func (weightConn) Prepare(query string) (driver.Stmt, error) {
+	if !strings.HasPrefix(query, "select weight from products") {
+		return nil, errors.New("weightdb: unexpected query")
+	}
+	return weightStmt{}, nil
+}
+
+func (weightConn) Close() error              { return nil }
+func (weightConn) Begin() (driver.Tx, error) { return weightConn{}, nil }
+func (weightConn) Commit() error             { return nil }
+func (weightConn) Rollback() error           { return nil }
+
+type weightStmt struct{}
+
+func (weightStmt) Close() error  { return nil }
+func (weightStmt) NumInput() int { return 1 }
+
+func (weightStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, errors.New("weightdb: read only")
+}
+
+func (weightStmt) Query(args []driver.Value) (driver.Rows, error) {
+	weight, ok := productWeights[args[0].(string)]
+	if !ok {
+		return &weightRows{}, nil
+	}
+	return &weightRows{weights: []int64{weight}}, nil
+}
+
+type weightRows struct {
+	weights []int64
+}
+
+func (r *weightRows) Columns() []string { return []string{"weight"} }
+func (r *weightRows) Close() error      { return nil }
+
+func (r *weightRows) Next(dest []driver.Value) error {
+	if len(r.weights) == 0 {
+		return io.EOF
+	}
+	dest[0], r.weights = r.weights[0], r.weights[1:]
+	return nil
+}
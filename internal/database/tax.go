@@ -0,0 +1,121 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/tax"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* tax operations */
+
+// tax rules of a country, caller owns the transaction
+func countryTaxRules(tx *sql.Tx, country string) ([]*models.TaxRule, error) {
+	rows, err := tx.Query(`select rule_id, name, country, region, tax_class, rate, inclusive from tax_rules where country = ?`, country)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Rules []*models.TaxRule
+	for rows.Next() {
+		rule := &models.TaxRule{}
+		if err := rows.Scan(&rule.RuleID, &rule.Name, &rule.Country, &rule.Region, &rule.TaxClass, &rule.Rate, &rule.Inclusive); err != nil {
+			return nil, err
+		}
+		Rules = append(Rules, rule)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return Rules, nil
+}
+
+// fill in the tax class of each line from its product, caller owns the transaction
+func setTaxClasses(tx *sql.Tx, items []*models.OrderItem) error {
+	stmt, err := tx.Prepare(`select tax_class from products where product_id = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, item := range items {
+		if err := stmt.QueryRow(item.ProductID).Scan(&item.TaxClass); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrNoRecord
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// tax of line items going to addr, lines get their tax set. returns the tax added on top
+// of the prices and the tax already included in them, caller owns the transaction
+func applyTax(tx *sql.Tx, items []*models.OrderItem, addr *models.Address, discount models.Money) (models.Money, models.Money, error) {
+	if err := setTaxClasses(tx, items); err != nil {
+		return models.Money{}, models.Money{}, err
+	}
+	var rules []*models.TaxRule
+	if addr != nil {
+		var err error
+		if rules, err = countryTaxRules(tx, addr.Country); err != nil {
+			return models.Money{}, models.Money{}, err
+		}
+	}
+	return tax.Apply(rules, addr, items, discount)
+}
+
+// totals of user cart, tax is worked out for the default shipping address and left at zero without one
+func (dm *DBModel) CartTotals(userID int) (*models.CartTotals, error) {
+	cart, err := dm.GetUserCart(userID)
+	if err != nil {
+		return nil, err
+	}
+	items := cartItems(cart)
+	subtotal, err := orderTotal(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(items) == 0 {
+		zero := models.NewMoney(0, models.DefaultCurrency)
+		return &models.CartTotals{Subtotal: zero, Discount: zero, Tax: zero, IncludedTax: zero, Total: zero}, nil
+	}
+	totals := &models.CartTotals{
+		Subtotal: subtotal,
+		Discount: models.NewMoney(0, subtotal.Currency),
+	}
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	coupon, err := previewCartCoupon(tx, userID, items)
+	if err != nil {
+		return nil, err
+	}
+	if coupon != nil {
+		totals.Discount = coupon.Discount
+	}
+	addr, err := userAddress(tx, userID, 0, "default_shipping")
+	if err != nil {
+		return nil, err
+	}
+	if totals.Tax, totals.IncludedTax, err = applyTax(tx, items, addr, totals.Discount); err != nil {
+		return nil, err
+	}
+	if totals.Total, err = subtotal.Sub(totals.Discount); err != nil {
+		return nil, err
+	}
+	if totals.Total, err = totals.Total.Add(totals.Tax); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return totals, nil
+}
@@ -0,0 +1,218 @@
+package database
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* token operations */
+
+// only the hash of a token is kept, a leaked table can't be replayed
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// store a new refresh token, caller owns the transaction
+func insertRefreshToken(tx *sql.Tx, userID int, familyID string, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	query := `insert into refresh_tokens(user_id, token_hash, family_id, expires_at) values(?, ?, ?, date_add(now(), interval ? second))`
+	if _, err := tx.Exec(query, userID, hashToken(token), familyID, int(ttl.Seconds())); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// start a new refresh token family for user, e.g at login
+func (dm *DBModel) CreateRefreshToken(userID int, ttl time.Duration) (string, error) {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	token, err := insertRefreshToken(tx, userID, uuid.NewString(), ttl)
+	if err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// swap a refresh token for the next one in its family, the user it belongs to is returned.
+// a token that was already rotated is treated as stolen and its whole family is revoked
+func (dm *DBModel) RotateRefreshToken(token string, ttl time.Duration) (int, string, error) {
+	query := `select token_id, user_id, family_id, revoked_at is not null, expires_at <= now() from refresh_tokens where token_hash = ? for update`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	var tokenID, userID int
+	var familyID string
+	var revoked, expired bool
+	err = tx.QueryRow(query, hashToken(token)).Scan(&tokenID, &userID, &familyID, &revoked, &expired)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, "", utils.ErrInvalidToken
+		}
+		return 0, "", err
+	}
+	if revoked {
+		if _, err := tx.Exec(`update refresh_tokens set revoked_at = now() where family_id = ? and revoked_at is null`, familyID); err != nil {
+			return 0, "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, "", err
+		}
+		return 0, "", utils.ErrTokenReused
+	}
+	if expired {
+		return 0, "", utils.ErrInvalidToken
+	}
+
+	if _, err := tx.Exec(`update refresh_tokens set revoked_at = now() where token_id = ?`, tokenID); err != nil {
+		return 0, "", err
+	}
+	next, err := insertRefreshToken(tx, userID, familyID, ttl)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, "", err
+	}
+	return userID, next, nil
+}
+
+// revoke the family of a refresh token held by user, e.g at logout
+func (dm *DBModel) RevokeRefreshToken(userID int, token string) error {
+	query := `update refresh_tokens t join refresh_tokens f on f.family_id = t.family_id
+	set f.revoked_at = now() where t.token_hash = ? and t.user_id = ? and f.revoked_at is null`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(hashToken(token), userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// revoke every refresh token of user, signs them out everywhere once access tokens lapse
+func (dm *DBModel) RevokeUserRefreshTokens(userID int) error {
+	query := `update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// put access token id on the revocation list until the token would have expired anyway
+func (dm *DBModel) RevokeAccessToken(jti string, ttl time.Duration) error {
+	query := `insert into revoked_tokens(jti, expires_at) values(?, date_add(now(), interval ? second))
+	on duplicate key update expires_at = values(expires_at)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//entries past their expiry no longer matter
+	if _, err := tx.Exec(`delete from revoked_tokens where expires_at <= now()`); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(jti, int(ttl.Seconds())); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// check access token id against the revocation list
+func (dm *DBModel) IsTokenRevoked(jti string) (bool, error) {
+	query := `select count(*) from revoked_tokens where jti = ? and expires_at > now()`
+
+	var count int
+	if err := dm.DB.QueryRow(query, jti).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// user details that go into a token
+func (dm *DBModel) GetTokenUser(userID int) (*models.User, error) {
+	query := `select id, user_id, email from users where id = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	user := &models.User{}
+	if err := tx.QueryRow(query, userID).Scan(&user.ID, &user.UserID, &user.Email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	user.Roles, err = userRoles(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -1,4 +1,3 @@
-// []TODO complete edit user adress
 package database
 
 import (
@@ -7,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/pagination"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
 )
 
@@ -33,45 +33,49 @@ func NewUser(fName, lName, email, phoneNumber, password string) (*models.User, e
 }
 
 // create new user in dB
-func (dm *DBModel) InsertUser(fname, lname, email, phoneNumber, password string) error {
+func (dm *DBModel) InsertUser(fname, lname, email, phoneNumber, password string) (int, error) {
 	user, err := NewUser(fname, lname, email, phoneNumber, password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	query := `insert into users(user_id, first_name, last_name, email, phone_number, password_hash) values(?, ?, ?, ?, ?, ?)`
 	tx, err := dm.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	//statement
 	stmt, err := tx.Prepare(query)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(user.UserID, user.FirstName, user.LastName, user.Email, user.PhoneNumber, user.Password)
+	result, err := stmt.Exec(user.UserID, user.FirstName, user.LastName, user.Email, user.PhoneNumber, user.Password)
 	if err != nil {
 		//check if err is of type mysql err
 		if errors.As(err, &utils.MySQLErr) {
 			//check if error is existing credentials (not unique) with the constraint 'users_uc_email'
 			if utils.MySQLErr.Number == 1062 && strings.Contains(utils.MySQLErr.Message, "user_uc_email") {
-				return utils.ErrExsistingCrednetials
+				return 0, utils.ErrExsistingCrednetials
 			}
 		}
-		return err
+		return 0, err
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
 	if err := tx.Commit(); err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return int(userID), nil
 }
 
 // GetUserby uuid(i.e when logged in)
 func (dm *DBModel) GetUserbyUUID(uuid string) (*models.ResponseUser, error) {
-	query := `select id, first_name, last_name, email, phone_number from users where user_id = ?`
+	query := `select id, first_name, last_name, email, phone_number, email_verified_at is not null from users where user_id = ?`
 	tx, err := dm.DB.Begin()
 	if err != nil {
 		return nil, err
@@ -83,18 +87,19 @@ func (dm *DBModel) GetUserbyUUID(uuid string) (*models.ResponseUser, error) {
 	}
 	defer stmt.Close()
 	user := models.ResponseUser{}
-	rowErr := stmt.QueryRow(uuid).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.PhoneNumber)
+	rowErr := stmt.QueryRow(uuid).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.PhoneNumber, &user.EmailVerified)
 	if rowErr != nil {
-		if errors.Is(rowErr, sql.ErrNoRows) {
-			return nil, rowErr
-		}
+		return nil, rowErr
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
 	}
 	return &user, nil
 }
 
-// Get all users from DB
-func (dm *DBModel) GetAllUsers() ([]*models.ResponseUser, error) {
-	query := `select id, first_name, last_name, email, phone_number from users`
+// get user by email, e.g for password recovery
+func (dm *DBModel) GetUserByEmail(email string) (*models.ResponseUser, error) {
+	query := `select id, first_name, last_name, email, phone_number, email_verified_at is not null from users where email = ?`
 	tx, err := dm.DB.Begin()
 	if err != nil {
 		return nil, err
@@ -105,27 +110,73 @@ func (dm *DBModel) GetAllUsers() ([]*models.ResponseUser, error) {
 		return nil, err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query()
+	user := &models.ResponseUser{}
+	err = stmt.QueryRow(email).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Email, &user.PhoneNumber, &user.EmailVerified)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNoRecord
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
+	return user, nil
+}
+
+// sorts of the user list, newest sign ups first unless asked otherwise
+var userKeyset = &pagination.Keyset{
+	ID: "id",
+	Sorts: map[string]pagination.Sort{
+		"newest": {Desc: true},
+		"oldest": {},
+		"email":  {Column: "email"},
+	},
+	Default: "newest",
+}
+
+// Get a page of users from DB
+func (dm *DBModel) GetUsers(params pagination.Params) ([]*models.ResponseUser, *models.Page, error) {
+	q, err := userKeyset.Query(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	where, args := q.Where()
+	query := `select id, first_name, last_name, email, phone_number from users where ` + where + ` order by ` + q.OrderBy() + ` limit ?`
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query(append(args, q.Limit())...)
+	if err != nil {
+		return nil, nil, err
+	}
 	defer rows.Close()
 	var Users []*models.ResponseUser
 	for rows.Next() {
 		uSer := &models.ResponseUser{}
-		if err := rows.Scan(&uSer.ID, &uSer.FirstName, &uSer.LastName, &uSer.PhoneNumber); err != nil {
-			return nil, err
+		if err := rows.Scan(&uSer.ID, &uSer.FirstName, &uSer.LastName, &uSer.Email, &uSer.PhoneNumber); err != nil {
+			return nil, nil, err
 		}
 		Users = append(Users, uSer)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return Users, nil
+	Users, page := pagination.Trim(q, Users, func(user *models.ResponseUser) (interface{}, int64) {
+		return user.Email, int64(user.ID)
+	})
+	return Users, page, nil
 }
 
 // auth the user for login
@@ -153,6 +204,11 @@ func (um *DBModel) AuthenticateUser(email string) (*models.User, error) {
 			return nil, err
 		}
 	}
+	//roles go into the user's token
+	user.Roles, err = userRoles(tx, user.ID)
+	if err != nil {
+		return nil, err
+	}
 
 	err = tx.Commit()
 	if err != nil {
@@ -162,8 +218,8 @@ func (um *DBModel) AuthenticateUser(email string) (*models.User, error) {
 }
 
 // Remove user fields --cascade set to on delete
-func (dm *DBModel) RemoveUser(user_id int) error {
-	query := `delete from users where user_id = ?`
+func (dm *DBModel) RemoveUser(userID int) error {
+	query := `delete from users where id = ?`
 
 	//use db pool
 	tx, err := dm.DB.Begin()
@@ -172,107 +228,87 @@ func (dm *DBModel) RemoveUser(user_id int) error {
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(query)
-	if err != nil {
-		return err
-	}
-	_, err = stmt.Exec(user_id)
+	//orders still on their way can't go with the account, the lock keeps new ones out until it is gone
+	var open int
+	err = tx.QueryRow(`select count(*) from orders where user_id = ? and status in (?, ?, ?, ?) for update`,
+		userID, models.OrderPending, models.OrderPaid, models.OrderPacked, models.OrderShipped).Scan(&open)
 	if err != nil {
 		return err
 	}
-	return nil
-}
-
-// create new address
-func NewAddress(user *models.ResponseUser, houseNo, str, city, postalCode string) *models.Address {
-	return &models.Address{
-		HouseNo:     houseNo,
-		Street:      str,
-		City:        city,
-		PostalCode:  postalCode,
-		UserPhoneNo: user.PhoneNumber,
+	if open > 0 {
+		return utils.ErrOpenOrders
 	}
-}
 
-// register new address
-func (dm *DBModel) AddUserAddress(user *models.ResponseUser, houseNo, str, city, postalCode string) error {
-	adrr := NewAddress(user, houseNo, str, city, postalCode)
-	query := `insert into address(user_id, house_no, street, city, postal_code) values(?, ?, ?, ?, ?)`
-
-	tx, err := dm.DB.Begin()
+	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return err
 	}
-
-	defer tx.Rollback()
-
-	stmt, err := tx.Prepare(query)
+	defer stmt.Close()
+	result, err := stmt.Exec(userID)
 	if err != nil {
 		return err
 	}
-	defer stmt.Close()
-	_, err = stmt.Exec(user.ID, adrr.HouseNo, adrr.Street, adrr.City, adrr.PostalCode)
+	rows, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return utils.ErrNoRecord
+	}
 	if err := tx.Commit(); err != nil {
 		return err
 	}
 	return nil
 }
 
-// return user addresses
-func (dm *DBModel) ReturnUserAddress(userID int) ([]*models.Address, error) {
-	query := `select * from address where user_id = ?`
+// update name and phone number of user, nil fields are left as they are
+func (dm *DBModel) UpdateUserProfile(userID int, firstName, lastName, phoneNumber *string) error {
+	query := `update users set first_name = coalesce(?, first_name), last_name = coalesce(?, last_name), phone_number = coalesce(?, phone_number) where id = ?`
+
 	tx, err := dm.DB.Begin()
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer tx.Rollback()
+
 	stmt, err := tx.Prepare(query)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer stmt.Close()
-	rows, err := stmt.Query(userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var UserAddrs []*models.Address
-	for rows.Next() {
-		useraddr := &models.Address{}
-		if err := rows.Scan(&useraddr.HouseNo, &useraddr.Street, &useraddr.City, &useraddr.PostalCode); err != nil {
-			return nil, err
-		}
-		UserAddrs = append(UserAddrs, useraddr)
+
+	if _, err := stmt.Exec(firstName, lastName, phoneNumber, userID); err != nil {
+		return err
 	}
 	if err := tx.Commit(); err != nil {
-		return nil, err
+		return err
 	}
-
-	return UserAddrs, nil
+	return nil
 }
 
-// reomve address
-func (dm *DBModel) RemoveAddress(userID, address_id int) error {
-	query := `delete from address where address_id = ? and user_id = ? `
+// set new password hash for user and sign out their other sessions
+func (dm *DBModel) ChangePassword(userID int, passwordHash string) error {
+	query := `update users set password_hash = ? where id = ?`
 
 	tx, err := dm.DB.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
+
 	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
-	_, err = stmt.Exec(address_id, userID)
-	if err != nil {
+
+	if _, err := stmt.Exec(passwordHash, userID); err != nil {
 		return err
 	}
-	if err = tx.Commit(); err != nil {
+	if _, err := tx.Exec(`update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
 		return err
 	}
 	return nil
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* one-time emailed token operations */
+
+// issue a one-time token for user, tokens of the same purpose sent earlier stop working
+func (dm *DBModel) CreateUserToken(userID int, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := utils.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	query := `insert into user_tokens(user_id, purpose, token_hash, expires_at) values(?, ?, ?, date_add(now(), interval ? second))`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`update user_tokens set used_at = now() where user_id = ? and purpose = ? and used_at is null`, userID, purpose); err != nil {
+		return "", err
+	}
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+
+	if _, err := stmt.Exec(userID, purpose, hashToken(token), int(ttl.Seconds())); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// tokens of a purpose issued to user within window and how long ago the last one went out
+func (dm *DBModel) RecentUserTokens(userID int, purpose models.TokenPurpose, window time.Duration) (int, time.Duration, error) {
+	query := `select count(*), coalesce(timestampdiff(second, max(created_at), now()), -1) from user_tokens
+	where user_id = ? and purpose = ? and created_at > date_sub(now(), interval ? second)`
+
+	var count, since int
+	if err := dm.DB.QueryRow(query, userID, purpose, int(window.Seconds())).Scan(&count, &since); err != nil {
+		return 0, 0, err
+	}
+	if since < 0 {
+		return count, window, nil
+	}
+	return count, time.Duration(since) * time.Second, nil
+}
+
+// spend a token, the user it was issued to is returned. caller owns the transaction
+func useUserToken(tx *sql.Tx, token string, purpose models.TokenPurpose) (int, error) {
+	query := `select token_id, user_id from user_tokens where token_hash = ? and purpose = ? and used_at is null and expires_at > now() for update`
+
+	var tokenID, userID int
+	if err := tx.QueryRow(query, hashToken(token), purpose).Scan(&tokenID, &userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, utils.ErrInvalidToken
+		}
+		return 0, err
+	}
+	if _, err := tx.Exec(`update user_tokens set used_at = now() where token_id = ?`, tokenID); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+// confirm email address of the user a verification token was sent to
+func (dm *DBModel) VerifyEmail(token string) error {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := useUserToken(tx, token, models.TokenVerifyEmail)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`update users set email_verified_at = coalesce(email_verified_at, now()) where id = ?`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// set a new password for the user a reset token was sent to, every refresh token of theirs is revoked
+func (dm *DBModel) ResetPassword(token, passwordHash string) error {
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	userID, err := useUserToken(tx, token, models.TokenPasswordReset)
+	if err != nil {
+		return err
+	}
+	//the reset link went to their inbox, so the address is proven as well
+	if _, err := tx.Exec(`update users set password_hash = ?, email_verified_at = coalesce(email_verified_at, now()) where id = ?`, passwordHash, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`update refresh_tokens set revoked_at = now() where user_id = ? and revoked_at is null`, userID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+/* product variant operations */
+
+// anything a variant row can be scanned from
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// columns scanVariant expects, v is product_variants and p is products
+const variantColumns = `v.variant_id, v.product_id, coalesce(v.sku, ''), v.color, v.size, v.price, p.currency`
+
+// scan variantColumns followed by the stock count
+func scanVariant(row rowScanner) (*models.ProductVariant, error) {
+	variant := &models.ProductVariant{}
+	var price sql.NullInt64
+	var currency string
+	if err := row.Scan(&variant.VariantID, &variant.ProductID, &variant.SKU, &variant.Color, &variant.Size, &price, &currency, &variant.Stock); err != nil {
+		return nil, err
+	}
+	if price.Valid {
+		amount := models.NewMoney(price.Int64, currency)
+		variant.Price = &amount
+	}
+	return variant, nil
+}
+
+// price a variant sells for, its own or the product's
+func variantPrice(variant *models.ProductVariant, product *models.Product) models.Money {
+	if variant.Price != nil {
+		return *variant.Price
+	}
+	return product.Price
+}
+
+// get variant of product by color and size
+func (dm *DBModel) GetVariant(productUUID, color, size string) (*models.ProductVariant, error) {
+	query := `select ` + variantColumns + `, v.stock from product_variants v join products p on p.product_id = v.product_id
+	where v.product_id = ? and v.color = ? and v.size = ?`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	variant, err := scanVariant(stmt.QueryRow(productUUID, color, size))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrInvalidVariant
+		}
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// remove the plain variant a product is made with, it is kept while it has stock,
+// is held or sits in a cart so none of those are lost. caller owns the transaction
+func dropDefaultVariant(tx *sql.Tx, productUUID string) error {
+	var variantID, stock int
+	err := tx.QueryRow(`select variant_id, stock from product_variants where product_id = ? and color = '' and size = '' for update`, productUUID).Scan(&variantID, &stock)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+	if stock > 0 {
+		return nil
+	}
+	var inUse bool
+	err = tx.QueryRow(`select exists(select 1 from stock_reservations where variant_id = ? and expires_at > now())
+	or exists(select 1 from carts where product_id = ? and color = '' and size = '')`, variantID, productUUID).Scan(&inUse)
+	if err != nil || inUse {
+		return err
+	}
+	_, err = tx.Exec(`delete from product_variants where variant_id = ?`, variantID)
+	return err
+}
+
+// add color/size option to a product --admin stuff
+// the default variant made with the product is dropped once it has real options and nothing left in it
+func (dm *DBModel) AddVariant(productUUID, sku, color, size string, price *models.Money, stock int) (*models.ProductVariant, error) {
+	if stock < 0 {
+		return nil, utils.ErrInvalidQuantity
+	}
+	product, err := dm.GetProduct(productUUID)
+	if err != nil {
+		return nil, err
+	}
+	var amount sql.NullInt64
+	if price != nil {
+		if err := price.Validate(); err != nil {
+			return nil, err
+		}
+		if price.Currency != product.Price.Currency {
+			return nil, models.ErrCurrencyMismatch
+		}
+		amount = sql.NullInt64{Int64: price.Amount, Valid: true}
+	}
+	query := `insert into product_variants(product_id, sku, color, size, price, stock) values(?, nullif(?, ''), ?, ?, ?, ?)`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	result, err := stmt.Exec(productUUID, sku, color, size, amount, stock)
+	if err != nil {
+		if errors.As(err, &utils.MySQLErr) && utils.MySQLErr.Number == 1062 {
+			return nil, utils.ErrExistingSKU
+		}
+		return nil, err
+	}
+	variantID, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if color != "" || size != "" {
+		if err := dropDefaultVariant(tx, productUUID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &models.ProductVariant{
+		VariantID: int(variantID),
+		ProductID: productUUID,
+		SKU:       sku,
+		Color:     color,
+		Size:      size,
+		Price:     price,
+		Stock:     stock,
+	}, nil
+}
+
+// variants of a product that can still be bought, stock is what is left after cart holds
+func (dm *DBModel) GetAvailableVariants(productUUID string) ([]*models.ProductVariant, error) {
+	query := `select ` + variantColumns + `,
+	v.stock - coalesce((select sum(r.quantity) from stock_reservations r where r.variant_id = v.variant_id and r.expires_at > now()), 0) as available
+	from product_variants v join products p on p.product_id = v.product_id where v.product_id = ? having available > 0 order by v.variant_id`
+
+	tx, err := dm.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+
+	rows, err := stmt.Query(productUUID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var Variants []*models.ProductVariant
+	for rows.Next() {
+		variant, err := scanVariant(rows)
+		if err != nil {
+			return nil, err
+		}
+		Variants = append(Variants, variant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return Variants, nil
+}
@@ -0,0 +1,152 @@
+package invoice
+
+import (
+	"bytes"
+	"html/template"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+)
+
+// content type of rendered invoices
+const ContentType = "text/html; charset=utf-8"
+
+// file name invoice is sent as, e.g INV-2024-000042.html
+func FileName(inv *models.Invoice) string {
+	return inv.Number + ".html"
+}
+
+// money on an invoice line, keeps the template free of currency logic
+type line struct {
+	Name     string
+	Options  string
+	Quantity int
+	Price    string
+	Total    string
+	Tax      string
+}
+
+// everything the template prints, already formatted
+type page struct {
+	Number          string
+	IssuedAt        string
+	OrderID         int
+	OrderedAt       string
+	Buyer           *models.ResponseUser
+	BillingAddress  *models.Address
+	ShippingAddress *models.Address
+	Lines           []line
+	Subtotal        string
+	Discount        string
+	CouponCode      string
+	Shipping        string
+	ShippingName    string
+	Tax             string
+	IncludedTax     string
+	Total           string
+	PaymentMethod   string
+	PaymentStatus   string
+}
+
+var invoiceTemplate = template.Must(template.New("invoice").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; color: #222; margin: 40px; }
+table { width: 100%; border-collapse: collapse; margin-top: 24px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ddd; text-align: left; }
+td.amount, th.amount { text-align: right; }
+.addresses { display: flex; gap: 48px; margin-top: 24px; }
+.totals td { border: none; }
+</style>
+</head>
+<body>
+<h1>mysticMerch</h1>
+<p><b>Invoice {{.Number}}</b><br>Issued {{.IssuedAt}}<br>Order #{{.OrderID}} placed {{.OrderedAt}}</p>
+<div class="addresses">
+<div><b>Bill to</b><br>{{.Buyer.FirstName}} {{.Buyer.LastName}}<br>{{.Buyer.Email}}{{with .BillingAddress}}<br>{{.HouseNo}} {{.Street}}<br>{{.City}}{{if .Region}}, {{.Region}}{{end}} {{.PostalCode}}<br>{{.Country}}{{end}}</div>
+{{with .ShippingAddress}}<div><b>Ship to</b><br>{{.HouseNo}} {{.Street}}<br>{{.City}}{{if .Region}}, {{.Region}}{{end}} {{.PostalCode}}<br>{{.Country}}</div>{{end}}
+</div>
+<table>
+<tr><th>Item</th><th class="amount">Qty</th><th class="amount">Unit price</th><th class="amount">Tax</th><th class="amount">Amount</th></tr>
+{{range .Lines}}<tr><td>{{.Name}}{{if .Options}} ({{.Options}}){{end}}</td><td class="amount">{{.Quantity}}</td><td class="amount">{{.Price}}</td><td class="amount">{{.Tax}}</td><td class="amount">{{.Total}}</td></tr>
+{{end}}</table>
+<table class="totals">
+<tr><td class="amount">Subtotal</td><td class="amount">{{.Subtotal}}</td></tr>
+{{if .Discount}}<tr><td class="amount">Discount{{if .CouponCode}} ({{.CouponCode}}){{end}}</td><td class="amount">-{{.Discount}}</td></tr>
+{{end}}{{if .Shipping}}<tr><td class="amount">Shipping ({{.ShippingName}})</td><td class="amount">{{.Shipping}}</td></tr>
+{{end}}{{if .Tax}}<tr><td class="amount">Tax</td><td class="amount">{{.Tax}}</td></tr>
+{{end}}<tr><td class="amount"><b>Total</b></td><td class="amount"><b>{{.Total}}</b></td></tr>
+{{if .IncludedTax}}<tr><td class="amount">Includes tax of</td><td class="amount">{{.IncludedTax}}</td></tr>
+{{end}}</table>
+<p>Paid by {{.PaymentMethod}}, payment {{.PaymentStatus}}.</p>
+</body>
+</html>
+`))
+
+// render invoice as an HTML document, the same invoice always renders to the same bytes
+func Render(inv *models.Invoice) ([]byte, error) {
+	order := inv.Order
+	total, err := order.Price.Sub(order.Discount)
+	if err != nil {
+		return nil, err
+	}
+	if total, err = total.Add(order.Tax); err != nil {
+		return nil, err
+	}
+
+	p := page{
+		Number:          inv.Number,
+		IssuedAt:        inv.IssuedAt.UTC().Format("2 January 2006"),
+		OrderID:         order.OrderID,
+		OrderedAt:       order.OrderedAt.UTC().Format("2 January 2006"),
+		Buyer:           inv.Buyer,
+		BillingAddress:  order.BillingAddress,
+		ShippingAddress: order.ShippingAddress,
+		Subtotal:        order.Price.String(),
+		CouponCode:      order.CouponCode,
+		PaymentMethod:   order.PaymentMethod.Provider,
+		PaymentStatus:   string(order.PaymentMethod.Status),
+	}
+	if !order.Discount.IsZero() {
+		p.Discount = order.Discount.String()
+	}
+	if !order.Tax.IsZero() {
+		p.Tax = order.Tax.String()
+	}
+	if !order.IncludedTax.IsZero() {
+		p.IncludedTax = order.IncludedTax.String()
+	}
+	if order.Shipping != nil {
+		p.Shipping, p.ShippingName = order.Shipping.Cost.String(), order.Shipping.Method
+		if total, err = total.Add(order.Shipping.Cost); err != nil {
+			return nil, err
+		}
+	}
+	p.Total = total.String()
+
+	for _, item := range order.Items {
+		options := item.Color
+		if item.Size != "" {
+			if options != "" {
+				options += ", "
+			}
+			options += item.Size
+		}
+		p.Lines = append(p.Lines, line{
+			Name:     item.ProductName,
+			Options:  options,
+			Quantity: item.Quantity,
+			Price:    item.Price.String(),
+			Total:    item.Price.Mul(item.Quantity).String(),
+			Tax:      item.Tax.String(),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := invoiceTemplate.Execute(&buf, p); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
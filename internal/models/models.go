@@ -23,10 +23,37 @@ type User struct {
 	Email       string      `json:"email" validate:"required,email"`
 	PhoneNumber string      `json:"phone_number" validate:"required"`
 	Password    string      `json:"password"`
+	Roles       []string    `json:"roles,omitempty"`
 	CreatedAt   time.Time   `json:"createdAt"`
 	UpdatedAt   time.Ticker `json:"updatedAt"`
 }
 
+// permissions admin routes can require
+const (
+	PermCatalogWrite       = "catalog:write"
+	PermOrdersManage       = "orders:manage"
+	PermCouponsManage      = "coupons:manage"
+	PermEmailBroadcast     = "email:broadcast"
+	PermEmailTransactional = "email:transactional"
+	PermRolesManage        = "roles:manage"
+	PermReviewsModerate    = "reviews:moderate"
+)
+
+// admin role and the permissions it grants
+type Role struct {
+	RoleID      int      `json:"role_id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+type RequestUserRoles struct {
+	Roles []string `json:"roles"`
+}
+
+type RequestRefreshToken struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
 type RequestUser struct {
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
@@ -40,29 +67,143 @@ type Login struct {
 	Password string `json:"password"`
 }
 type ResponseUser struct {
-	ID          int    `json:"id"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Email       string `json:"email"`
-	PhoneNumber string `json:"phone_number"`
+	ID            int    `json:"id"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Email         string `json:"email"`
+	PhoneNumber   string `json:"phone_number"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// what a one-time emailed token is for
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail   TokenPurpose = "verify_email"
+	TokenPasswordReset TokenPurpose = "password_reset"
+)
+
+type RequestEmail struct {
+	Email string `json:"email"`
+}
+
+// fields left out are not changed
+type RequestUpdateProfile struct {
+	FirstName   *string `json:"first_name"`
+	LastName    *string `json:"last_name"`
+	PhoneNumber *string `json:"phone_number"`
+}
+
+type RequestChangePassword struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type RequestDeleteAccount struct {
+	Password string `json:"password"`
+}
+
+type RequestPasswordReset struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
 }
 
 // Products available in store.
 type Product struct {
-	ID          int     `json:"id"`         //auto increment
-	ProductID   string  `json:"product_id"` //for non db ops uuid generated
-	ProductName string  `json:"product_name"`
-	Description string  `json:"description"`
-	Image       string  `json:"image"`
-	Price       float64 `json:"price"`
-	Rating      int8    `json:"rating"`
+	ID          int    `json:"id"`         //auto increment
+	ProductID   string `json:"product_id"` //for non db ops uuid generated
+	ProductName string `json:"product_name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	Price       Money  `json:"price"`
+	Rating      int8   `json:"rating"` //rounded average of visible reviews
+	ReviewCount int    `json:"review_count"`
 }
 
 type NewProduct struct {
-	ProductName string  `json:"product_name"`
-	Description string  `json:"description"`
-	Image       string  `json:"image"`
-	Price       float64 `json:"price"`
+	ProductName string `json:"product_name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	Price       Money  `json:"price"`
+	Stock       int    `json:"stock"`
+	Weight      int    `json:"weight_grams"` //shipping weight of one unit
+	TaxClass    string `json:"tax_class"`    //standard when left out
+}
+
+// color/size combination of a product with its own sku, stock and optionally price
+type ProductVariant struct {
+	VariantID int    `json:"variant_id"`
+	ProductID string `json:"product_id"`
+	SKU       string `json:"sku,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Size      string `json:"size,omitempty"`
+	Price     *Money `json:"price,omitempty"` //nil means the product price applies
+	Stock     int    `json:"stock"`
+}
+
+type RequestVariant struct {
+	ProductUUID string `json:"product_id"`
+	SKU         string `json:"sku"`
+	Color       string `json:"color"`
+	Size        string `json:"size"`
+	Price       *Money `json:"price,omitempty"` //must be in the product's currency
+	Stock       int    `json:"stock"`
+}
+
+// product details along with the variants that can be bought
+type ResponseProductDetails struct {
+	ResponseProduct
+	ReviewCount int               `json:"review_count"`
+	Images      []*ProductImage   `json:"images"`
+	Variants    []*ProductVariant `json:"variants"`
+	Reviews     []*Review         `json:"reviews"`
+	ReviewsPage *Page             `json:"reviews_page"`
+}
+
+// uploaded image of a product, Position 0 is the main image
+type ProductImage struct {
+	ImageID     int    `json:"image_id"`
+	ProductID   string `json:"product_id"`
+	Key         string `json:"-"` //where the file is kept in the blob store
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Position    int    `json:"position"`
+}
+
+// every image of a product, main image first
+type RequestImageOrder struct {
+	ImageIDs []int `json:"image_ids"`
+}
+
+// a buyer's rating and text for a product, Hidden reviews are only seen by admins
+type Review struct {
+	ReviewID  int       `json:"review_id"`
+	ProductID string    `json:"product_id"`
+	UserID    int       `json:"-"`
+	Author    string    `json:"author"` //first name of reviewer
+	Rating    int       `json:"rating"`
+	Body      string    `json:"body"`
+	Hidden    bool      `json:"hidden,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RequestReview struct {
+	ProductUUID string `json:"product_id"`
+	Rating      int    `json:"rating"`
+	Body        string `json:"body"`
+}
+
+type RequestModerateReview struct {
+	Hidden bool `json:"hidden"`
+}
+
+type RequestStock struct {
+	ProductUUID string `json:"product_id"`
+	Color       string `json:"color"`
+	Size        string `json:"size"`
+	Stock       int    `json:"stock"`
 }
 
 // type NilProduct struct{
@@ -82,11 +223,95 @@ type RequestProductView struct {
 
 // simplified product for API response
 type ResponseProduct struct {
-	ProductName string  `json:"product_name"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	Rating      int8    `json:"rating"`
-	Image       string  `json:"image"`
+	ProductID   string `json:"product_id,omitempty"`
+	ProductName string `json:"product_name"`
+	Description string `json:"description"`
+	Price       Money  `json:"price"`
+	Rating      int8   `json:"rating"`
+	Image       string `json:"image"`
+}
+
+// node of the category tree, Featured categories are shown on the home page
+type Category struct {
+	CategoryID int         `json:"category_id"`
+	ParentID   *int        `json:"parent_id,omitempty"` //nil for top level categories
+	Name       string      `json:"name"`
+	Slug       string      `json:"slug"`
+	Featured   bool        `json:"featured"`
+	Children   []*Category `json:"children,omitempty"`
+}
+
+// replace the categories of a product
+type RequestProductCategories struct {
+	ProductUUID string   `json:"product_id"`
+	Categories  []string `json:"categories"` //slugs
+}
+
+// order of catalog search results
+type SearchSort string
+
+const (
+	SortRelevance SearchSort = "relevance" //default when searching by text
+	SortNewest    SearchSort = "newest"    //default otherwise
+	SortPriceAsc  SearchSort = "price_asc"
+	SortPriceDesc SearchSort = "price_desc"
+	SortRating    SearchSort = "rating"
+)
+
+// catalog search request, zero values leave a filter off
+type ProductQuery struct {
+	Text      string
+	MinPrice  int64 //minor units
+	MaxPrice  int64
+	MinRating int
+	Category  string //slug, subcategories are included
+	InStock   bool
+	Sort      SearchSort
+	Limit     int
+	Offset    int
+}
+
+// product as seen by the in-memory search engine
+type SearchDocument struct {
+	Product    ResponseProduct
+	Seq        int         //insert order, higher is newer
+	Categories []*Category //categories the product is directly listed under
+	InStock    bool
+}
+
+type CategoryFacet struct {
+	Slug  string `json:"slug"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type RatingFacet struct {
+	Rating int `json:"rating"`
+	Count  int `json:"count"`
+}
+
+// counts over every product matching a search, not just the returned page
+type SearchFacets struct {
+	Categories []*CategoryFacet `json:"categories"`
+	Ratings    []*RatingFacet   `json:"ratings"`
+	MinPrice   int64            `json:"min_price"`
+	MaxPrice   int64            `json:"max_price"`
+	InStock    int              `json:"in_stock"`
+}
+
+type SearchResult struct {
+	Products []*ResponseProduct `json:"items"`
+	Total    int                `json:"total"`
+	Facets   *SearchFacets      `json:"facets"`
+	Page     *Page              `json:"page"`
+}
+
+// position of a page in a list, cursors are passed back as ?cursor= to move between pages
+type Page struct {
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Limit int    `json:"limit"`
+	Sort  string `json:"sort"`
 }
 
 type RemoveProduct struct {
@@ -97,7 +322,7 @@ type RemoveProduct struct {
 type UserProducts struct {
 	ProductID   int    `json:"product_id"`
 	ProductName string `json:"product_name"`
-	Price       int    `json:"price"`
+	Price       Money  `json:"price"`
 	Rating      uint   `json:"rating"`
 	Image       string `json:"image"`
 	Quantity    int    `json:"quantity"`
@@ -107,8 +332,9 @@ type UserProducts struct {
 
 // simplified cartProducts for API response
 type ResponseCartProducts struct {
+	ProductID   string `json:"product_id"`
 	ProductName string `json:"product_name"`
-	Price       int    `json:"price"`
+	Price       Money  `json:"price"`
 	Rating      uint   `json:"rating"`
 	Image       string `json:"image"`
 	Quantity    int    `json:"quantity"`
@@ -129,27 +355,236 @@ type TransactionNotification struct {
 
 // Oorder model
 type Order struct {
-	OrderID       int       `json:"order_id"`
-	OrderedAt     time.Time `json:"order_at"`
-	Price         int       `json:"order_price"`
-	Discount      int       `json:"discount"`
-	PaymentMethod Payment   `json:"payment_type"`
+	OrderID         int            `json:"order_id"`
+	OrderedAt       time.Time      `json:"order_at"`
+	Price           Money          `json:"order_price"`
+	Discount        Money          `json:"discount"`
+	Tax             Money          `json:"tax"`          //added on top of the prices
+	IncludedTax     Money          `json:"included_tax"` //already part of the prices
+	PaymentMethod   Payment        `json:"payment_type"`
+	Status          OrderStatus    `json:"status"`
+	CouponCode      string         `json:"coupon_code,omitempty"`
+	ShippingAddress *Address       `json:"shipping_address,omitempty"`
+	BillingAddress  *Address       `json:"billing_address,omitempty"`
+	Shipping        *ShippingQuote `json:"shipping,omitempty"`
+	Items           []*OrderItem   `json:"items,omitempty"`
+}
+
+// invoice of an order, Number runs sequentially within each year e.g INV-2024-000042
+type Invoice struct {
+	Number   string        `json:"number"`
+	IssuedAt time.Time     `json:"issued_at"`
+	Buyer    *ResponseUser `json:"buyer"`
+	Order    *Order        `json:"order"`
+}
+
+// lifecycle state of an order
+type OrderStatus string
+
+const (
+	OrderPending   OrderStatus = "pending"
+	OrderPaid      OrderStatus = "paid"
+	OrderPacked    OrderStatus = "packed"
+	OrderShipped   OrderStatus = "shipped"
+	OrderDelivered OrderStatus = "delivered"
+	OrderCancelled OrderStatus = "cancelled"
+	OrderRefunded  OrderStatus = "refunded"
+)
+
+// audit record of an order moving between statuses
+type OrderStatusChange struct {
+	OrderID   int         `json:"order_id"`
+	From      OrderStatus `json:"from"`
+	To        OrderStatus `json:"to"`
+	ChangedBy int         `json:"changed_by,omitempty"` //0 when changed by the system
+	ChangedAt time.Time   `json:"changed_at"`
+}
+
+type RequestOrderStatus struct {
+	Status OrderStatus `json:"status"`
+}
+
+// product bought in an order, a snapshot of the product at the time of purchase
+type OrderItem struct {
+	ProductID    string `json:"product_id"`
+	ProductName  string `json:"product_name"`
+	Price        Money  `json:"price"` //unit price
+	Quantity     int    `json:"quantity"`
+	Color        string `json:"color,omitempty"`
+	Size         string `json:"size,omitempty"`
+	TaxClass     string `json:"-"`
+	Tax          Money  `json:"tax"`         //tax on the whole line
+	TaxRate      int    `json:"tax_rate_bp"` //basis points, 750 is 7.5%
+	TaxInclusive bool   `json:"tax_inclusive"`
+}
+
+type CouponKind string
+
+const (
+	CouponPercentage   CouponKind = "percentage"
+	CouponFixed        CouponKind = "fixed"
+	CouponFreeShipping CouponKind = "free_shipping"
+)
+
+// admin managed discount code
+type Coupon struct {
+	CouponID     int        `json:"coupon_id"`
+	Code         string     `json:"code"`
+	Kind         CouponKind `json:"kind"`
+	Percent      int        `json:"percent,omitempty"` //percentage coupons, 1-100
+	Amount       Money      `json:"amount"`            //fixed coupons
+	MinSpend     Money      `json:"min_spend"`         //cart subtotal needed, in the coupon's currency
+	PerUserLimit int        `json:"per_user_limit"`    //0 means no limit
+	StartsAt     *time.Time `json:"starts_at,omitempty"`
+	EndsAt       *time.Time `json:"ends_at,omitempty"`
+	Active       *bool      `json:"active"`               //true when left out of a new coupon, unchanged when left out of an update
+	Products     []string   `json:"products,omitempty"`   //product uuids the coupon is limited to, empty along with Categories means all
+	Categories   []string   `json:"categories,omitempty"` //category slugs the coupon is limited to, subcategories included
+
+	CategoryProducts []string `json:"-"` //products under Categories, filled in when the coupon is checked against a cart
+}
+
+// coupon as worked out against a cart
+type AppliedCoupon struct {
+	CouponID     int    `json:"coupon_id"`
+	Code         string `json:"code"`
+	Discount     Money  `json:"discount"`
+	FreeShipping bool   `json:"free_shipping"`
+}
+
+type RequestCoupon struct {
+	Code string `json:"code"`
 }
 
 // user's address details.
 type Address struct {
-	AddressID   int    `json:"address_id"`
-	HouseNo     string `json:"house_no"`
-	Street      string `json:"street"`
-	City        string `json:"city"`
-	PostalCode  string `json:"postal_code"`
-	UserPhoneNo string `json:"phone_number"`
+	AddressID       int    `json:"address_id"`
+	HouseNo         string `json:"house_no"`
+	Street          string `json:"street"`
+	City            string `json:"city"`
+	Region          string `json:"region"`
+	PostalCode      string `json:"postal_code"`
+	Country         string `json:"country"` //ISO 3166-1 alpha-2 e.g NG, US
+	UserPhoneNo     string `json:"phone_number"`
+	DefaultShipping bool   `json:"default_shipping"`
+	DefaultBilling  bool   `json:"default_billing"`
+}
+
+// area orders are shipped to, empty City and PostalPrefix match any address in Country
+// and an empty Country matches anywhere, the most specific zone wins
+type ShippingZone struct {
+	ZoneID       int             `json:"zone_id"`
+	Name         string          `json:"name"`
+	Country      string          `json:"country,omitempty"`
+	City         string          `json:"city,omitempty"`
+	PostalPrefix string          `json:"postal_prefix,omitempty"`
+	Rates        []*ShippingRate `json:"rates,omitempty"`
+}
+
+type ShippingRateKind string
+
+const (
+	ShippingFlat     ShippingRateKind = "flat"   //same price whatever the parcel weighs
+	ShippingByWeight ShippingRateKind = "weight" //price of a weight bracket
+)
+
+// price of a shipping method within a zone, weights are in grams
+type ShippingRate struct {
+	RateID       int              `json:"rate_id"`
+	Method       string           `json:"method"` //e.g standard, express
+	Name         string           `json:"name"`
+	Kind         ShippingRateKind `json:"kind"`
+	MinWeight    int              `json:"min_weight"`
+	MaxWeight    int              `json:"max_weight"` //0 means no upper bound
+	Price        Money            `json:"price"`
+	DeliveryDays int              `json:"delivery_days"`
+}
+
+// tax class products get when none is given
+const DefaultTaxClass = "standard"
+
+// tax charged on a product tax class in a country, or only in one of its regions when Region is set.
+// Inclusive rules are for destinations where catalog prices already contain the tax
+type TaxRule struct {
+	RuleID    int    `json:"rule_id"`
+	Name      string `json:"name"`
+	Country   string `json:"country"`
+	Region    string `json:"region,omitempty"`
+	TaxClass  string `json:"tax_class"`
+	Rate      int    `json:"rate_bp"` //basis points, 750 is 7.5%
+	Inclusive bool   `json:"inclusive"`
+}
+
+// money summary of a cart, Total is what checkout charges before shipping
+type CartTotals struct {
+	Subtotal    Money `json:"subtotal"`
+	Discount    Money `json:"discount"`
+	Tax         Money `json:"tax"`
+	IncludedTax Money `json:"included_tax"`
+	Total       Money `json:"total"`
 }
 
-// payment method for an order, indicating whether electronic payment or cash was used.
+// what is being shipped and where
+type Parcel struct {
+	Destination *Address
+	Weight      int //grams
+	Subtotal    Money
+}
+
+// price a carrier gives for shipping a parcel with one of its methods
+type ShippingQuote struct {
+	Carrier      string `json:"carrier"`
+	Method       string `json:"method"`
+	Name         string `json:"name"`
+	Cost         Money  `json:"cost"`
+	DeliveryDays int    `json:"delivery_days,omitempty"`
+}
+
+// payment for an order, Method matches the orders.payment_type column
 type Payment struct {
-	EletronicPayment bool `json:"electronic_payment"`
-	Cash             bool `json:"cash"`
+	Method    string        `json:"method"`
+	Provider  string        `json:"provider"`
+	Reference string        `json:"reference,omitempty"` //provider's authorization id
+	Status    PaymentStatus `json:"status"`
+}
+
+const (
+	PaymentElectronic = "Electronic"
+	PaymentCash       = "Cash"
+)
+
+// state of the money behind an order
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending" //e.g cash awaiting delivery
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentFailed     PaymentStatus = "failed"
+	PaymentRefunded   PaymentStatus = "refunded"
+)
+
+// outcome of applying a provider event to an order
+type PaymentReconciliation struct {
+	OrderID   int
+	Change    *OrderStatusChange //nil when the order status did not move
+	Duplicate bool               //event was seen before and changed nothing
+	Refund    bool               //money is captured on an order that can no longer be paid, it has to go back to the buyer
+}
+
+// how the user wants to pay at checkout
+type CheckoutRequest struct {
+	PaymentMethod     string `json:"payment_method"` //provider name e.g cash, card
+	CardToken         string `json:"card_token,omitempty"`
+	ShippingCarrier   string `json:"shipping_carrier,omitempty"`    //local when left out
+	ShippingMethod    string `json:"shipping_method,omitempty"`     //cheapest method when left out
+	ShippingAddressID int    `json:"shipping_address_id,omitempty"` //saved address, default shipping address when left out
+	BillingAddressID  int    `json:"billing_address_id,omitempty"`  //saved address, default billing then shipping address when left out
+}
+
+type RequestInstantBuy struct {
+	RequestProduct
+	CheckoutRequest
 }
 
 type ValidAta struct {
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// currency used when none is given
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("err: amounts are in different currencies")
+	ErrInvalidCurrency  = errors.New("err: currency must be an ISO 4217 code")
+	ErrNegativeAmount   = errors.New("err: amount cannot be negative")
+)
+
+var currencyCode = regexp.MustCompile("^[A-Z]{3}$")
+
+// currencies without a minor unit, everything else is assumed to have two decimals
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"XAF": true,
+	"XOF": true,
+}
+
+// Money is an amount in the minor unit of its currency (e.g cents for USD),
+// integer maths keeps cart and order totals exact.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// check currency is a three letter code and amount is not negative
+func (m Money) Validate() error {
+	if !currencyCode.MatchString(m.Currency) {
+		return ErrInvalidCurrency
+	}
+	if m.Amount < 0 {
+		return ErrNegativeAmount
+	}
+	return nil
+}
+
+// sum of m and o, both must be in the same currency
+// zero value Money takes on the currency of the other amount so totals can start from Money{}
+func (m Money) Add(o Money) (Money, error) {
+	switch {
+	case m.Currency == "":
+		m.Currency = o.Currency
+	case o.Currency != "" && m.Currency != o.Currency:
+		return Money{}, ErrCurrencyMismatch
+	}
+	m.Amount += o.Amount
+	return m, nil
+}
+
+// m less o, both must be in the same currency
+func (m Money) Sub(o Money) (Money, error) {
+	o.Amount = -o.Amount
+	return m.Add(o)
+}
+
+// m multiplied by a quantity
+func (m Money) Mul(quantity int) Money {
+	m.Amount *= int64(quantity)
+	return m
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// human readable amount e.g 12.50 USD
+func (m Money) String() string {
+	if zeroDecimalCurrencies[m.Currency] {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	return fmt.Sprintf("%s%d.%02d %s", sign, amount/100, amount%100, m.Currency)
+}
@@ -0,0 +1,127 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"same currency", NewMoney(1999, "USD"), NewMoney(1, "USD"), NewMoney(2000, "USD"), nil},
+		//0.10 + 0.20 is 0.30000000000000004 as floats
+		{"no float drift", NewMoney(10, "USD"), NewMoney(20, "USD"), NewMoney(30, "USD"), nil},
+		{"zero value takes other currency", Money{}, NewMoney(500, "EUR"), NewMoney(500, "EUR"), nil},
+		{"adding zero value keeps currency", NewMoney(500, "EUR"), Money{}, NewMoney(500, "EUR"), nil},
+		{"negative amount", NewMoney(500, "USD"), NewMoney(-700, "USD"), NewMoney(-200, "USD"), nil},
+		{"currency mismatch", NewMoney(100, "USD"), NewMoney(100, "EUR"), Money{}, ErrCurrencyMismatch},
+		{"mismatch from zero amount", NewMoney(0, "USD"), NewMoney(100, "JPY"), Money{}, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Add() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Add() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"same currency", NewMoney(2000, "USD"), NewMoney(1, "USD"), NewMoney(1999, "USD"), nil},
+		//0.30 - 0.10 is 0.19999999999999998 as floats
+		{"no float drift", NewMoney(30, "USD"), NewMoney(10, "USD"), NewMoney(20, "USD"), nil},
+		{"below zero", NewMoney(100, "USD"), NewMoney(250, "USD"), NewMoney(-150, "USD"), nil},
+		{"from zero value", Money{}, NewMoney(100, "GBP"), NewMoney(-100, "GBP"), nil},
+		{"currency mismatch", NewMoney(100, "USD"), NewMoney(50, "GBP"), Money{}, ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Sub(tt.b)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Sub() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Sub() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	tests := []struct {
+		name     string
+		m        Money
+		quantity int
+		want     Money
+	}{
+		{"one", NewMoney(1999, "USD"), 1, NewMoney(1999, "USD")},
+		//0.10 * 7 is 0.7000000000000001 as floats
+		{"no float drift", NewMoney(10, "USD"), 7, NewMoney(70, "USD")},
+		{"several", NewMoney(1999, "USD"), 3, NewMoney(5997, "USD")},
+		{"zero quantity", NewMoney(1999, "USD"), 0, NewMoney(0, "USD")},
+		{"large quantity", NewMoney(333, "USD"), 100000, NewMoney(33300000, "USD")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.m.Mul(tt.quantity); got != tt.want {
+				t.Errorf("Mul() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMoneyValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Money
+		err  error
+	}{
+		{"valid", NewMoney(100, "USD"), nil},
+		{"zero amount", NewMoney(0, "NGN"), nil},
+		{"negative amount", NewMoney(-1, "USD"), ErrNegativeAmount},
+		{"empty currency", NewMoney(100, ""), ErrInvalidCurrency},
+		{"lowercase currency", NewMoney(100, "usd"), ErrInvalidCurrency},
+		{"long currency", NewMoney(100, "USDT"), ErrInvalidCurrency},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.m.Validate(); !errors.Is(err, tt.err) {
+				t.Errorf("Validate() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{NewMoney(1250, "USD"), "12.50 USD"},
+		{NewMoney(5, "USD"), "0.05 USD"},
+		{NewMoney(-5, "EUR"), "-0.05 EUR"},
+		{NewMoney(-1250, "EUR"), "-12.50 EUR"},
+		{NewMoney(1250, "JPY"), "1250 JPY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := tt.m.String(); got != tt.want {
+				t.Errorf("String() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
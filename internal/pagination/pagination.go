@@ -0,0 +1,231 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+// format time keys travel in, what MySQL compares datetime columns against
+const timeKey = "2006-01-02 15:04:05.999999"
+
+// Params is a page request as read from ?limit=&cursor=&sort=
+type Params struct {
+	Limit  int
+	Sort   string //empty is the list's default sort
+	Cursor *Cursor
+}
+
+// Cursor marks where a page starts, clients only ever see it encoded.
+// Keyset lists page from the row with Key and ID (ids start at 1), ranked searches page by Offset
+type Cursor struct {
+	Sort   string      `json:"s"`
+	Key    interface{} `json:"k,omitempty"`
+	ID     int64       `json:"i,omitempty"`
+	Before bool        `json:"b,omitempty"` //page ends before the row instead of starting after it
+	Offset int         `json:"o,omitempty"`
+}
+
+// opaque form of cursor sent to clients
+func (c *Cursor) Encode() string {
+	if t, ok := c.Key.(time.Time); ok {
+		c.Key = t.UTC().Format(timeKey)
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// read a cursor made by Encode
+func Decode(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, utils.ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.UseNumber()
+	cursor := &Cursor{}
+	if err := decoder.Decode(cursor); err != nil || cursor.Offset < 0 {
+		return nil, utils.ErrInvalidCursor
+	}
+	//numbers come back as json.Number, keys are either whole numbers or strings
+	if number, ok := cursor.Key.(json.Number); ok {
+		if cursor.Key, err = number.Int64(); err != nil {
+			return nil, utils.ErrInvalidCursor
+		}
+	}
+	return cursor, nil
+}
+
+// read ?limit=&cursor=&sort= from request, limit is capped at MaxLimit
+func FromRequest(r *http.Request) (Params, error) {
+	query := r.URL.Query()
+	params := Params{Limit: DefaultLimit, Sort: query.Get("sort")}
+	if limit, err := strconv.Atoi(query.Get("limit")); err == nil && limit > 0 {
+		params.Limit = limit
+	}
+	if params.Limit > MaxLimit {
+		params.Limit = MaxLimit
+	}
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := Decode(raw)
+		if err != nil {
+			return params, err
+		}
+		params.Cursor = cursor
+	}
+	return params, nil
+}
+
+// Sort orders a list by Column and then by the list's id column in the same direction
+type Sort struct {
+	Column string //sql expression, empty sorts by the id column alone
+	Desc   bool
+}
+
+// Keyset describes how a list can be sorted
+type Keyset struct {
+	ID      string //unique column that breaks ties, e.g "o.order_id"
+	Sorts   map[string]Sort
+	Default string
+}
+
+// Query is a page request checked against the sorts of a list
+type Query struct {
+	keyset *Keyset
+	name   string
+	sort   Sort
+	params Params
+}
+
+// check sort and cursor of params belong to the list
+func (k *Keyset) Query(params Params) (*Query, error) {
+	name := params.Sort
+	if name == "" {
+		name = k.Default
+	}
+	sort, ok := k.Sorts[name]
+	if !ok {
+		return nil, utils.ErrInvalidSort
+	}
+	if c := params.Cursor; c != nil && (c.Sort != name || c.ID == 0 || (sort.Column != "" && c.Key == nil)) {
+		return nil, utils.ErrInvalidCursor
+	}
+	return &Query{keyset: k, name: name, sort: sort, params: params}, nil
+}
+
+// sort the page is in
+func (q *Query) Sort() string {
+	return q.name
+}
+
+// rows are read in reverse when paging backwards
+func (q *Query) reversed() bool {
+	return q.params.Cursor != nil && q.params.Cursor.Before
+}
+
+// condition rows past the cursor meet, "true" on the first page
+func (q *Query) Where() (string, []interface{}) {
+	cursor := q.params.Cursor
+	if cursor == nil {
+		return "true", nil
+	}
+	op := ">"
+	if q.sort.Desc != q.reversed() {
+		op = "<"
+	}
+	if q.sort.Column == "" {
+		return q.keyset.ID + " " + op + " ?", []interface{}{cursor.ID}
+	}
+	return "(" + q.sort.Column + " " + op + " ? or (" + q.sort.Column + " = ? and " + q.keyset.ID + " " + op + " ?))",
+		[]interface{}{cursor.Key, cursor.Key, cursor.ID}
+}
+
+// order by clause of the page
+func (q *Query) OrderBy() string {
+	direction := " asc"
+	if q.sort.Desc != q.reversed() {
+		direction = " desc"
+	}
+	if q.sort.Column == "" {
+		return q.keyset.ID + direction
+	}
+	return q.sort.Column + direction + ", " + q.keyset.ID + direction
+}
+
+// rows to fetch, one more than the page holds tells whether there is a page after it
+func (q *Query) Limit() int {
+	return q.params.Limit + 1
+}
+
+// Trim drops the look ahead row, puts rows read backwards back in order and
+// works out the cursors either side of the page. key gives the sort column value and id of a row
+func Trim[T any](q *Query, rows []T, key func(T) (interface{}, int64)) ([]T, *models.Page) {
+	more := len(rows) > q.params.Limit
+	if more {
+		rows = rows[:q.params.Limit]
+	}
+	if q.reversed() {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+
+	page := &models.Page{Limit: q.params.Limit, Sort: q.name}
+	if len(rows) == 0 {
+		return rows, page
+	}
+	cursor := func(row T, before bool) string {
+		k, id := key(row)
+		if q.sort.Column == "" {
+			k = nil
+		}
+		return (&Cursor{Sort: q.name, Key: k, ID: id, Before: before}).Encode()
+	}
+	//going back there is always a page after, going forward there is a page before unless this is the first
+	if more || q.reversed() {
+		page.Next = cursor(rows[len(rows)-1], false)
+	}
+	if (more && q.reversed()) || (q.params.Cursor != nil && !q.reversed()) {
+		page.Prev = cursor(rows[0], true)
+	}
+	return rows, page
+}
+
+// offset into a list paged by position, for lists with no stable key such as search results
+func Offset(params Params, sort string) (int, error) {
+	cursor := params.Cursor
+	if cursor == nil {
+		return 0, nil
+	}
+	if cursor.Sort != sort || cursor.ID != 0 {
+		return 0, utils.ErrInvalidCursor
+	}
+	return cursor.Offset, nil
+}
+
+// cursors of a page that starts at offset of a list total long
+func OffsetPage(params Params, sort string, offset, total int) *models.Page {
+	page := &models.Page{Limit: params.Limit, Sort: sort}
+	if offset+params.Limit < total {
+		page.Next = (&Cursor{Sort: sort, Offset: offset + params.Limit}).Encode()
+	}
+	if offset > 0 {
+		prev := offset - params.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Prev = (&Cursor{Sort: sort, Offset: prev}).Encode()
+	}
+	return page
+}
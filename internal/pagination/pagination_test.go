@@ -0,0 +1,329 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// sorts like the orders list, by id alone or by a column with the id breaking ties
+var testKeyset = &Keyset{
+	ID: "o.order_id",
+	Sorts: map[string]Sort{
+		"newest":     {Desc: true},
+		"oldest":     {},
+		"price_asc":  {Column: "o.price"},
+		"price_desc": {Column: "o.price", Desc: true},
+	},
+	Default: "newest",
+}
+
+func encoded(s string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(s))
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		want   *Cursor
+	}{
+		{"id only", &Cursor{Sort: "newest", ID: 42}, &Cursor{Sort: "newest", ID: 42}},
+		{"whole number key", &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}, &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}},
+		{"int key comes back as int64", &Cursor{Sort: "price_asc", Key: 1999, ID: 7}, &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}},
+		{"string key", &Cursor{Sort: "name", Key: "blue shirt", ID: 3}, &Cursor{Sort: "name", Key: "blue shirt", ID: 3}},
+		//times travel in the format MySQL compares datetime columns against, in UTC
+		{"time key", &Cursor{Sort: "created", Key: time.Date(2024, 3, 1, 13, 4, 5, 123456000, time.FixedZone("WAT", 3600)), ID: 9},
+			&Cursor{Sort: "created", Key: "2024-03-01 12:04:05.123456", ID: 9}},
+		{"before", &Cursor{Sort: "oldest", ID: 11, Before: true}, &Cursor{Sort: "oldest", ID: 11, Before: true}},
+		{"offset", &Cursor{Sort: "relevance", Offset: 40}, &Cursor{Sort: "relevance", Offset: 40}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.cursor.Encode())
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Decode(Encode()) = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	valid := (&Cursor{Sort: "newest", ID: 42}).Encode()
+	tests := []struct {
+		name   string
+		cursor string
+	}{
+		{"not base64", "%%%"},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"s":"newest","i":1}`))},
+		{"truncated", valid[:len(valid)-3]},
+		{"not json", encoded("newest:42")},
+		{"json array", encoded(`["newest",42]`)},
+		{"wrong field type", encoded(`{"s":"newest","i":"42"}`)},
+		{"negative offset", encoded(`{"s":"relevance","o":-20}`)},
+		{"fractional key", encoded(`{"s":"price_asc","k":19.99,"i":1}`)},
+		{"key out of range", encoded(`{"s":"price_asc","k":99999999999999999999,"i":1}`)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if cursor, err := Decode(tt.cursor); !errors.Is(err, utils.ErrInvalidCursor) {
+				t.Errorf("Decode() = %+v, %v, want %v", cursor, err, utils.ErrInvalidCursor)
+			}
+		})
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		limit int
+		sort  string
+		err   error
+	}{
+		{"defaults", "", DefaultLimit, "", nil},
+		{"limit", "limit=5", 5, "", nil},
+		{"largest limit", "limit=100", MaxLimit, "", nil},
+		{"limit capped", "limit=1000", MaxLimit, "", nil},
+		{"zero limit", "limit=0", DefaultLimit, "", nil},
+		{"negative limit", "limit=-5", DefaultLimit, "", nil},
+		{"limit not a number", "limit=ten", DefaultLimit, "", nil},
+		{"sort", "sort=price_asc", DefaultLimit, "price_asc", nil},
+		{"cursor", "cursor=" + (&Cursor{Sort: "newest", ID: 42}).Encode(), DefaultLimit, "", nil},
+		{"invalid cursor", "cursor=%25%25%25", DefaultLimit, "", utils.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := FromRequest(httptest.NewRequest("GET", "/orders?"+tt.query, nil))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("FromRequest() error = %v, want %v", err, tt.err)
+			}
+			if params.Limit != tt.limit || params.Sort != tt.sort {
+				t.Errorf("FromRequest() = limit %d sort %q, want limit %d sort %q", params.Limit, params.Sort, tt.limit, tt.sort)
+			}
+		})
+	}
+}
+
+func TestKeysetQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		sort   string
+		err    error
+	}{
+		{"default sort", Params{Limit: 10}, "newest", nil},
+		{"named sort", Params{Limit: 10, Sort: "price_asc"}, "price_asc", nil},
+		{"unknown sort", Params{Limit: 10, Sort: "rating"}, "", utils.ErrInvalidSort},
+		{"cursor of sort", Params{Limit: 10, Sort: "price_asc", Cursor: &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}}, "price_asc", nil},
+		//a cursor is only good for the sort that made it
+		{"cursor of other sort", Params{Limit: 10, Sort: "price_desc", Cursor: &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}}, "", utils.ErrInvalidCursor},
+		{"cursor of default sort", Params{Limit: 10, Cursor: &Cursor{Sort: "oldest", ID: 7}}, "", utils.ErrInvalidCursor},
+		{"cursor without id", Params{Limit: 10, Sort: "oldest", Cursor: &Cursor{Sort: "oldest"}}, "", utils.ErrInvalidCursor},
+		{"cursor without key", Params{Limit: 10, Sort: "price_asc", Cursor: &Cursor{Sort: "price_asc", ID: 7}}, "", utils.ErrInvalidCursor},
+		{"offset cursor", Params{Limit: 10, Sort: "oldest", Cursor: &Cursor{Sort: "oldest", Offset: 20}}, "", utils.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := testKeyset.Query(tt.params)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Query() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && q.Sort() != tt.sort {
+				t.Errorf("Query().Sort() = %q, want %q", q.Sort(), tt.sort)
+			}
+		})
+	}
+}
+
+func TestQueryWhereOrderBy(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		where   string
+		args    []interface{}
+		orderBy string
+	}{
+		{"first page by id", Params{Sort: "oldest"}, "true", nil, "o.order_id asc"},
+		{"first page by id descending", Params{Sort: "newest"}, "true", nil, "o.order_id desc"},
+		{"first page by column", Params{Sort: "price_asc"}, "true", nil, "o.price asc, o.order_id asc"},
+		{"after id", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 7}},
+			"o.order_id > ?", []interface{}{int64(7)}, "o.order_id asc"},
+		{"after id descending", Params{Sort: "newest", Cursor: &Cursor{Sort: "newest", ID: 7}},
+			"o.order_id < ?", []interface{}{int64(7)}, "o.order_id desc"},
+		{"before id", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 7, Before: true}},
+			"o.order_id < ?", []interface{}{int64(7)}, "o.order_id desc"},
+		{"before id descending", Params{Sort: "newest", Cursor: &Cursor{Sort: "newest", ID: 7, Before: true}},
+			"o.order_id > ?", []interface{}{int64(7)}, "o.order_id asc"},
+		//equal prices fall back to the id so no row is skipped or repeated
+		{"after column", Params{Sort: "price_asc", Cursor: &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7}},
+			"(o.price > ? or (o.price = ? and o.order_id > ?))", []interface{}{int64(1999), int64(1999), int64(7)}, "o.price asc, o.order_id asc"},
+		{"after column descending", Params{Sort: "price_desc", Cursor: &Cursor{Sort: "price_desc", Key: int64(1999), ID: 7}},
+			"(o.price < ? or (o.price = ? and o.order_id < ?))", []interface{}{int64(1999), int64(1999), int64(7)}, "o.price desc, o.order_id desc"},
+		{"before column", Params{Sort: "price_asc", Cursor: &Cursor{Sort: "price_asc", Key: int64(1999), ID: 7, Before: true}},
+			"(o.price < ? or (o.price = ? and o.order_id < ?))", []interface{}{int64(1999), int64(1999), int64(7)}, "o.price desc, o.order_id desc"},
+		{"before column descending", Params{Sort: "price_desc", Cursor: &Cursor{Sort: "price_desc", Key: int64(1999), ID: 7, Before: true}},
+			"(o.price > ? or (o.price = ? and o.order_id > ?))", []interface{}{int64(1999), int64(1999), int64(7)}, "o.price asc, o.order_id asc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Limit = 10
+			q, err := testKeyset.Query(tt.params)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			where, args := q.Where()
+			if where != tt.where || !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("Where() = %q %v, want %q %v", where, args, tt.where, tt.args)
+			}
+			if orderBy := q.OrderBy(); orderBy != tt.orderBy {
+				t.Errorf("OrderBy() = %q, want %q", orderBy, tt.orderBy)
+			}
+			if q.Limit() != 11 {
+				t.Errorf("Limit() = %d, want one look ahead row over 10", q.Limit())
+			}
+		})
+	}
+}
+
+// row of a list sorted by price, ids and prices rise together
+type testRow struct {
+	id    int64
+	price int64
+}
+
+func testRows(ids ...int64) []testRow {
+	rows := []testRow{}
+	for _, id := range ids {
+		rows = append(rows, testRow{id: id, price: id * 100})
+	}
+	return rows
+}
+
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		name   string
+		params Params
+		rows   []testRow //as read from the database, limit is 3
+		want   []int64
+		next   *Cursor
+		prev   *Cursor
+	}{
+		{"empty", Params{Sort: "oldest"}, testRows(), []int64{}, nil, nil},
+		{"fewer than limit", Params{Sort: "oldest"}, testRows(1, 2), []int64{1, 2}, nil, nil},
+		{"exactly limit", Params{Sort: "oldest"}, testRows(1, 2, 3), []int64{1, 2, 3}, nil, nil},
+		{"more than limit", Params{Sort: "oldest"}, testRows(1, 2, 3, 4), []int64{1, 2, 3},
+			&Cursor{Sort: "oldest", ID: 3}, nil},
+		{"later page", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 3}}, testRows(4, 5, 6, 7), []int64{4, 5, 6},
+			&Cursor{Sort: "oldest", ID: 6}, &Cursor{Sort: "oldest", ID: 4, Before: true}},
+		{"last page", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 3}}, testRows(4, 5), []int64{4, 5},
+			nil, &Cursor{Sort: "oldest", ID: 4, Before: true}},
+		//paging back reads rows in reverse, they come out in list order
+		{"back with more before", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 8, Before: true}}, testRows(7, 6, 5, 4), []int64{5, 6, 7},
+			&Cursor{Sort: "oldest", ID: 7}, &Cursor{Sort: "oldest", ID: 5, Before: true}},
+		{"back to first page", Params{Sort: "oldest", Cursor: &Cursor{Sort: "oldest", ID: 4, Before: true}}, testRows(3, 2, 1), []int64{1, 2, 3},
+			&Cursor{Sort: "oldest", ID: 3}, nil},
+		{"column sort", Params{Sort: "price_asc"}, testRows(1, 2, 3, 4), []int64{1, 2, 3},
+			&Cursor{Sort: "price_asc", Key: int64(300), ID: 3}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Limit = 3
+			q, err := testKeyset.Query(tt.params)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			rows, page := Trim(q, tt.rows, func(row testRow) (interface{}, int64) {
+				return row.price, row.id
+			})
+
+			ids := []int64{}
+			for _, row := range rows {
+				ids = append(ids, row.id)
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("Trim() rows = %v, want %v", ids, tt.want)
+			}
+			if page.Limit != 3 || page.Sort != tt.params.Sort {
+				t.Errorf("Trim() page = limit %d sort %q, want limit 3 sort %q", page.Limit, page.Sort, tt.params.Sort)
+			}
+			checkCursor(t, "next", page.Next, tt.next)
+			checkCursor(t, "prev", page.Prev, tt.prev)
+		})
+	}
+}
+
+func checkCursor(t *testing.T, name, got string, want *Cursor) {
+	t.Helper()
+	if want == nil {
+		if got != "" {
+			t.Errorf("%s = %q, want none", name, got)
+		}
+		return
+	}
+	cursor, err := Decode(got)
+	if err != nil {
+		t.Fatalf("%s %q: Decode() error = %v", name, got, err)
+	}
+	if !reflect.DeepEqual(cursor, want) {
+		t.Errorf("%s = %+v, want %+v", name, cursor, want)
+	}
+}
+
+func TestOffsetPage(t *testing.T) {
+	tests := []struct {
+		name   string
+		offset int
+		total  int
+		next   *Cursor
+		prev   *Cursor
+	}{
+		{"only page", 0, 8, nil, nil},
+		{"first page", 0, 25, &Cursor{Sort: "relevance", Offset: 10}, nil},
+		{"middle page", 10, 25, &Cursor{Sort: "relevance", Offset: 20}, &Cursor{Sort: "relevance"}},
+		{"last page", 20, 25, nil, &Cursor{Sort: "relevance", Offset: 10}},
+		{"ends on limit", 10, 20, nil, &Cursor{Sort: "relevance"}},
+		//an offset off the page grid goes back to the start, not below it
+		{"odd offset", 5, 25, &Cursor{Sort: "relevance", Offset: 15}, &Cursor{Sort: "relevance"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := OffsetPage(Params{Limit: 10}, "relevance", tt.offset, tt.total)
+			checkCursor(t, "next", page.Next, tt.next)
+			checkCursor(t, "prev", page.Prev, tt.prev)
+		})
+	}
+}
+
+func TestOffset(t *testing.T) {
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		want   int
+		err    error
+	}{
+		{"first page", nil, 0, nil},
+		{"offset", &Cursor{Sort: "relevance", Offset: 20}, 20, nil},
+		{"other sort", &Cursor{Sort: "newest", Offset: 20}, 0, utils.ErrInvalidCursor},
+		{"keyset cursor", &Cursor{Sort: "relevance", ID: 7}, 0, utils.ErrInvalidCursor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Offset(Params{Limit: 10, Cursor: tt.cursor}, "relevance")
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Offset() error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Offset() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"github.com/google/uuid"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+)
+
+// CashOnDelivery collects money when the order gets to the buyer,
+// there is nothing to hold up front so every call succeeds.
+type CashOnDelivery struct{}
+
+func NewCashOnDelivery() *CashOnDelivery {
+	return &CashOnDelivery{}
+}
+
+func (c *CashOnDelivery) Name() string {
+	return ProviderCash
+}
+
+func (c *CashOnDelivery) Method() string {
+	return models.PaymentCash
+}
+
+// nothing is held, the order waits for cash
+func (c *CashOnDelivery) Authorize(charge *Charge) (*Authorization, error) {
+	return &Authorization{
+		ID:     "cod_" + uuid.NewString(),
+		Status: models.PaymentPending,
+	}, nil
+}
+
+// cash was collected on delivery
+func (c *CashOnDelivery) Capture(authorizationID string, amount models.Money) error {
+	return nil
+}
+
+// cash refunds are handed back in person
+func (c *CashOnDelivery) Refund(authorizationID string, amount models.Money) error {
+	return nil
+}
+
+func (c *CashOnDelivery) VerifyWebhook(payload []byte, signature string) (*Event, error) {
+	return nil, ErrWebhookUnsupported
+}
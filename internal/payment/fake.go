@@ -0,0 +1,132 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// card token the fake gateway always declines
+const DeclineToken = "tok_decline"
+
+type fakeCharge struct {
+	currency   string
+	authorized int64
+	captured   int64
+	refunded   int64
+}
+
+// FakeGateway is an in-process card gateway, it keeps authorizations in memory
+// and signs webhooks with HMAC-SHA256 so the whole card flow runs without a network.
+// it is for tests and local runs only, see Lookup
+type FakeGateway struct {
+	secret  []byte
+	mu      sync.Mutex
+	charges map[string]*fakeCharge
+}
+
+func NewFakeGateway(secret string) *FakeGateway {
+	return &FakeGateway{
+		secret:  []byte(secret),
+		charges: make(map[string]*fakeCharge),
+	}
+}
+
+func (f *FakeGateway) Name() string {
+	return ProviderCard
+}
+
+func (f *FakeGateway) Method() string {
+	return models.PaymentElectronic
+}
+
+// hold amount on the card, DeclineToken is refused
+func (f *FakeGateway) Authorize(charge *Charge) (*Authorization, error) {
+	if charge.Token == "" || charge.Token == DeclineToken {
+		return nil, utils.ErrPaymentDeclined
+	}
+	if charge.Amount.Amount <= 0 || charge.Amount.Validate() != nil {
+		return nil, ErrInvalidAmount
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "auth_" + uuid.NewString()
+	f.charges[id] = &fakeCharge{currency: charge.Amount.Currency, authorized: charge.Amount.Amount}
+	return &Authorization{
+		ID:     id,
+		Status: models.PaymentAuthorized,
+	}, nil
+}
+
+func (f *FakeGateway) Capture(authorizationID string, amount models.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge, ok := f.charges[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorize
+	}
+	if amount.Currency != charge.currency {
+		return models.ErrCurrencyMismatch
+	}
+	if charge.captured+amount.Amount > charge.authorized {
+		return ErrInvalidAmount
+	}
+	charge.captured += amount.Amount
+	return nil
+}
+
+// refund captured money, or release the hold when nothing was captured
+func (f *FakeGateway) Refund(authorizationID string, amount models.Money) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	charge, ok := f.charges[authorizationID]
+	if !ok {
+		return ErrUnknownAuthorize
+	}
+	if charge.captured == 0 {
+		charge.authorized = 0
+		return nil
+	}
+	if amount.Currency != charge.currency {
+		return models.ErrCurrencyMismatch
+	}
+	if charge.refunded+amount.Amount > charge.captured {
+		return ErrInvalidAmount
+	}
+	charge.refunded += amount.Amount
+	return nil
+}
+
+// hex encoded HMAC-SHA256 of payload, what the gateway puts in the signature header
+func (f *FakeGateway) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *FakeGateway) VerifyWebhook(payload []byte, signature string) (*Event, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || len(f.secret) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, f.secret)
+	mac.Write(payload)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, ErrInvalidSignature
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
@@ -0,0 +1,189 @@
+package payment
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+func TestFakeGatewayAuthorize(t *testing.T) {
+	tests := []struct {
+		name   string
+		charge *Charge
+		err    error
+	}{
+		{"approved", &Charge{Amount: models.NewMoney(2500, "USD"), Token: "tok_visa"}, nil},
+		{"declined token", &Charge{Amount: models.NewMoney(2500, "USD"), Token: DeclineToken}, utils.ErrPaymentDeclined},
+		{"missing token", &Charge{Amount: models.NewMoney(2500, "USD")}, utils.ErrPaymentDeclined},
+		{"zero amount", &Charge{Amount: models.NewMoney(0, "USD"), Token: "tok_visa"}, ErrInvalidAmount},
+		{"negative amount", &Charge{Amount: models.NewMoney(-100, "USD"), Token: "tok_visa"}, ErrInvalidAmount},
+		{"invalid currency", &Charge{Amount: models.NewMoney(2500, "usd"), Token: "tok_visa"}, ErrInvalidAmount},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, err := NewFakeGateway("secret").Authorize(tt.charge)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Authorize() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			if auth.ID == "" || auth.Status != models.PaymentAuthorized {
+				t.Errorf("Authorize() = %+v, want an id and status %q", auth, models.PaymentAuthorized)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayCapture(t *testing.T) {
+	tests := []struct {
+		name     string
+		captures []models.Money
+		err      error //of the last capture, the ones before it succeed
+	}{
+		{"full amount", []models.Money{models.NewMoney(2500, "USD")}, nil},
+		{"in parts", []models.Money{models.NewMoney(1000, "USD"), models.NewMoney(1500, "USD")}, nil},
+		{"more than authorized", []models.Money{models.NewMoney(2501, "USD")}, ErrInvalidAmount},
+		{"parts over authorized", []models.Money{models.NewMoney(2000, "USD"), models.NewMoney(501, "USD")}, ErrInvalidAmount},
+		{"other currency", []models.Money{models.NewMoney(2500, "EUR")}, models.ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := NewFakeGateway("secret")
+			auth, err := gateway.Authorize(&Charge{Amount: models.NewMoney(2500, "USD"), Token: "tok_visa"})
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			last := len(tt.captures) - 1
+			for i, amount := range tt.captures[:last] {
+				if err := gateway.Capture(auth.ID, amount); err != nil {
+					t.Fatalf("Capture() %d error = %v", i, err)
+				}
+			}
+			if err := gateway.Capture(auth.ID, tt.captures[last]); !errors.Is(err, tt.err) {
+				t.Errorf("Capture() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayUnknownAuthorization(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	if err := gateway.Capture("auth_missing", models.NewMoney(100, "USD")); !errors.Is(err, ErrUnknownAuthorize) {
+		t.Errorf("Capture() error = %v, want %v", err, ErrUnknownAuthorize)
+	}
+	if err := gateway.Refund("auth_missing", models.NewMoney(100, "USD")); !errors.Is(err, ErrUnknownAuthorize) {
+		t.Errorf("Refund() error = %v, want %v", err, ErrUnknownAuthorize)
+	}
+}
+
+// a hold that was never captured is voided, so nothing can be captured from it afterwards
+func TestFakeGatewayVoid(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	auth, err := gateway.Authorize(&Charge{Amount: models.NewMoney(2500, "USD"), Token: "tok_visa"})
+	if err != nil {
+		t.Fatalf("Authorize() error = %v", err)
+	}
+	if err := gateway.Refund(auth.ID, models.NewMoney(2500, "USD")); err != nil {
+		t.Fatalf("Refund() error = %v", err)
+	}
+	if err := gateway.Capture(auth.ID, models.NewMoney(1, "USD")); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("Capture() after void error = %v, want %v", err, ErrInvalidAmount)
+	}
+}
+
+func TestFakeGatewayRefund(t *testing.T) {
+	tests := []struct {
+		name    string
+		refunds []models.Money
+		err     error //of the last refund, the ones before it succeed
+	}{
+		{"full amount", []models.Money{models.NewMoney(2000, "USD")}, nil},
+		{"in parts", []models.Money{models.NewMoney(500, "USD"), models.NewMoney(1500, "USD")}, nil},
+		{"more than captured", []models.Money{models.NewMoney(2001, "USD")}, ErrInvalidAmount},
+		{"parts over captured", []models.Money{models.NewMoney(1500, "USD"), models.NewMoney(501, "USD")}, ErrInvalidAmount},
+		{"other currency", []models.Money{models.NewMoney(2000, "EUR")}, models.ErrCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gateway := NewFakeGateway("secret")
+			auth, err := gateway.Authorize(&Charge{Amount: models.NewMoney(2500, "USD"), Token: "tok_visa"})
+			if err != nil {
+				t.Fatalf("Authorize() error = %v", err)
+			}
+			//refunds are limited by what was captured, not by what was authorized
+			if err := gateway.Capture(auth.ID, models.NewMoney(2000, "USD")); err != nil {
+				t.Fatalf("Capture() error = %v", err)
+			}
+			last := len(tt.refunds) - 1
+			for i, amount := range tt.refunds[:last] {
+				if err := gateway.Refund(auth.ID, amount); err != nil {
+					t.Fatalf("Refund() %d error = %v", i, err)
+				}
+			}
+			if err := gateway.Refund(auth.ID, tt.refunds[last]); !errors.Is(err, tt.err) {
+				t.Errorf("Refund() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayVerifyWebhook(t *testing.T) {
+	gateway := NewFakeGateway("secret")
+	payload, err := json.Marshal(&Event{
+		ID:              "evt_1",
+		Type:            EventPaymentSucceeded,
+		AuthorizationID: "auth_1",
+		Amount:          models.NewMoney(2500, "USD"),
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-2] = '9'
+
+	tests := []struct {
+		name      string
+		gateway   *FakeGateway
+		payload   []byte
+		signature string
+		err       error
+	}{
+		{"signed", gateway, payload, gateway.Sign(payload), nil},
+		{"missing signature", gateway, payload, "", ErrInvalidSignature},
+		{"not hex", gateway, payload, "not-a-signature", ErrInvalidSignature},
+		{"other secret", gateway, payload, NewFakeGateway("other").Sign(payload), ErrInvalidSignature},
+		{"tampered payload", gateway, tampered, gateway.Sign(payload), ErrInvalidSignature},
+		//without a secret anyone could sign events
+		{"no secret", NewFakeGateway(""), payload, NewFakeGateway("").Sign(payload), ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event, err := tt.gateway.VerifyWebhook(tt.payload, tt.signature)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("VerifyWebhook() error = %v, want %v", err, tt.err)
+			}
+			if err != nil {
+				return
+			}
+			want := Event{ID: "evt_1", Type: EventPaymentSucceeded, AuthorizationID: "auth_1", Amount: models.NewMoney(2500, "USD")}
+			if *event != want {
+				t.Errorf("VerifyWebhook() = %+v, want %+v", *event, want)
+			}
+		})
+	}
+}
+
+// the fake gateway approves nearly any card, it must not take card payments unless asked to
+func TestLookupWithoutFakePayments(t *testing.T) {
+	t.Setenv("MM_FAKE_PAYMENTS", "")
+	if _, err := Lookup(ProviderCash); err != nil {
+		t.Errorf("Lookup(%q) error = %v", ProviderCash, err)
+	}
+	if _, err := Lookup(ProviderCard); !errors.Is(err, utils.ErrUnknownPaymentMethod) {
+		t.Errorf("Lookup(%q) error = %v, want %v", ProviderCard, err, utils.ErrUnknownPaymentMethod)
+	}
+}
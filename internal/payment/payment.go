@@ -0,0 +1,107 @@
+package payment
+
+import (
+	"errors"
+	"os"
+	"sync"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// names of the providers a user can pick at checkout
+const (
+	ProviderCash = "cash"
+	ProviderCard = "card"
+)
+
+// webhook event types sent by payment providers
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentFailed    = "payment.failed"
+)
+
+var (
+	ErrWebhookUnsupported = errors.New("err: provider does not send webhooks")
+	ErrInvalidSignature   = errors.New("err: invalid webhook signature")
+	ErrUnknownAuthorize   = errors.New("err: unknown authorization")
+	ErrInvalidAmount      = errors.New("err: amount exceeds what is available")
+)
+
+// money a provider is asked to hold for an order
+type Charge struct {
+	Amount    models.Money
+	Reference string //ours, e.g user uuid
+	Token     string //card token from the client, unused for cash
+}
+
+// result of holding money with a provider
+type Authorization struct {
+	ID     string
+	Status models.PaymentStatus
+}
+
+// notification from a provider about an authorization
+type Event struct {
+	ID              string       `json:"id"`
+	Type            string       `json:"type"`
+	AuthorizationID string       `json:"authorization_id"`
+	Amount          models.Money `json:"amount"`
+}
+
+// PaymentProvider is implemented by anything that can take money for an order
+type PaymentProvider interface {
+	// provider name stored on the order
+	Name() string
+	// value for orders.payment_type, Electronic or Cash
+	Method() string
+	// hold money for a charge
+	Authorize(charge *Charge) (*Authorization, error)
+	// take money that was held
+	Capture(authorizationID string, amount models.Money) error
+	// give money back, voids the authorization when nothing was captured
+	Refund(authorizationID string, amount models.Money) error
+	// check the signature of a webhook payload and decode the event
+	VerifyWebhook(payload []byte, signature string) (*Event, error)
+}
+
+var (
+	providers     = make(map[string]PaymentProvider)
+	providersMu   sync.RWMutex
+	providersOnce sync.Once
+)
+
+// make provider available at checkout under its name, replacing any provider of that name
+func Register(provider PaymentProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[provider.Name()] = provider
+}
+
+// cash on delivery is always available. the fake gateway approves nearly any card and
+// forgets charges on restart, so it only stands in for a card gateway when MM_FAKE_PAYMENTS=true
+func registerDefaults() {
+	utils.LoadEnv()
+	Register(NewCashOnDelivery())
+	if os.Getenv("MM_FAKE_PAYMENTS") != "true" {
+		return
+	}
+	providersMu.RLock()
+	_, ok := providers[ProviderCard]
+	providersMu.RUnlock()
+	if !ok {
+		Register(NewFakeGateway(os.Getenv("HERMES")))
+	}
+}
+
+// get payment provider by name, card fails until a gateway is registered or faked by config
+func Lookup(name string) (PaymentProvider, error) {
+	providersOnce.Do(registerDefaults)
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	provider, ok := providers[name]
+	if !ok {
+		return nil, utils.ErrUnknownPaymentMethod
+	}
+	return provider, nil
+}
@@ -0,0 +1,203 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// shorter words are left out of the MySQL FULLTEXT index (innodb_ft_min_token_size)
+const MinTermLength = 3
+
+// words past this are dropped from a search
+const maxTerms = 10
+
+// lowercased words of a search, too short words are dropped
+func Terms(text string) []string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(word)) < MinTermLength {
+			continue
+		}
+		terms = append(terms, word)
+		if len(terms) == maxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// check filters of a search and fill in the default sort
+func Validate(q *models.ProductQuery) error {
+	if q.MinPrice < 0 || q.MaxPrice < 0 || (q.MaxPrice > 0 && q.MaxPrice < q.MinPrice) {
+		return utils.ErrInvalidSearch
+	}
+	if q.MinRating < 0 || q.MinRating > 5 {
+		return utils.ErrInvalidSearch
+	}
+	switch q.Sort {
+	case "":
+		q.Sort = models.SortNewest
+		if len(Terms(q.Text)) > 0 {
+			q.Sort = models.SortRelevance
+		}
+	case models.SortRelevance, models.SortNewest, models.SortPriceAsc, models.SortPriceDesc, models.SortRating:
+	default:
+		return utils.ErrInvalidSearch
+	}
+	return nil
+}
+
+// how often terms start a word of text, 0 if any term is missing
+func termScore(terms []string, name, description string) (float64, bool) {
+	nameWords := Terms(name)
+	descWords := Terms(description)
+	score := 0.0
+	for _, term := range terms {
+		hits := 0.0
+		for _, word := range nameWords {
+			if strings.HasPrefix(word, term) {
+				hits += 2 //a hit in the name counts double
+			}
+		}
+		for _, word := range descWords {
+			if strings.HasPrefix(word, term) {
+				hits++
+			}
+		}
+		if hits == 0 {
+			return 0, false
+		}
+		score += hits
+	}
+	return score, true
+}
+
+// Memory searches documents held in memory the way the FULLTEXT search does in MySQL:
+// every term must start a word of the name or description, and name hits rank higher.
+// categoryIDs is the category filter with subcategories already expanded, nil is no filter.
+func Memory(docs []*models.SearchDocument, q *models.ProductQuery, categoryIDs []int) *models.SearchResult {
+	terms := Terms(q.Text)
+	inCategory := make(map[int]bool, len(categoryIDs))
+	for _, id := range categoryIDs {
+		inCategory[id] = true
+	}
+
+	type hit struct {
+		doc   *models.SearchDocument
+		score float64
+	}
+	var hits []hit
+	for _, doc := range docs {
+		price := doc.Product.Price.Amount
+		if price < q.MinPrice || (q.MaxPrice > 0 && price > q.MaxPrice) {
+			continue
+		}
+		if int(doc.Product.Rating) < q.MinRating || (q.InStock && !doc.InStock) {
+			continue
+		}
+		if categoryIDs != nil {
+			listed := false
+			for _, category := range doc.Categories {
+				if inCategory[category.CategoryID] {
+					listed = true
+					break
+				}
+			}
+			if !listed {
+				continue
+			}
+		}
+		score := 0.0
+		if len(terms) > 0 {
+			var ok bool
+			if score, ok = termScore(terms, doc.Product.ProductName, doc.Product.Description); !ok {
+				continue
+			}
+		}
+		hits = append(hits, hit{doc, score})
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		switch q.Sort {
+		case models.SortRelevance:
+			if a.score != b.score {
+				return a.score > b.score
+			}
+		case models.SortPriceAsc:
+			if a.doc.Product.Price.Amount != b.doc.Product.Price.Amount {
+				return a.doc.Product.Price.Amount < b.doc.Product.Price.Amount
+			}
+		case models.SortPriceDesc:
+			if a.doc.Product.Price.Amount != b.doc.Product.Price.Amount {
+				return a.doc.Product.Price.Amount > b.doc.Product.Price.Amount
+			}
+		case models.SortRating:
+			if a.doc.Product.Rating != b.doc.Product.Rating {
+				return a.doc.Product.Rating > b.doc.Product.Rating
+			}
+		}
+		return a.doc.Seq > b.doc.Seq
+	})
+
+	result := &models.SearchResult{Products: []*models.ResponseProduct{}, Total: len(hits), Facets: NewFacets()}
+	categoryCounts := make(map[int]*models.CategoryFacet)
+	ratingCounts := make(map[int]*models.RatingFacet)
+	for i, h := range hits {
+		if i >= q.Offset && len(result.Products) < q.Limit {
+			product := h.doc.Product
+			result.Products = append(result.Products, &product)
+		}
+
+		price := h.doc.Product.Price.Amount
+		if i == 0 || price < result.Facets.MinPrice {
+			result.Facets.MinPrice = price
+		}
+		if price > result.Facets.MaxPrice {
+			result.Facets.MaxPrice = price
+		}
+		if h.doc.InStock {
+			result.Facets.InStock++
+		}
+		for _, category := range h.doc.Categories {
+			if categoryCounts[category.CategoryID] == nil {
+				categoryCounts[category.CategoryID] = &models.CategoryFacet{Slug: category.Slug, Name: category.Name}
+				result.Facets.Categories = append(result.Facets.Categories, categoryCounts[category.CategoryID])
+			}
+			categoryCounts[category.CategoryID].Count++
+		}
+		rating := int(h.doc.Product.Rating)
+		if ratingCounts[rating] == nil {
+			ratingCounts[rating] = &models.RatingFacet{Rating: rating}
+			result.Facets.Ratings = append(result.Facets.Ratings, ratingCounts[rating])
+		}
+		ratingCounts[rating].Count++
+	}
+	SortFacets(result.Facets)
+	return result
+}
+
+// facets of an empty result, lists are never null
+func NewFacets() *models.SearchFacets {
+	return &models.SearchFacets{Categories: []*models.CategoryFacet{}, Ratings: []*models.RatingFacet{}}
+}
+
+// most used categories first, ratings high to low
+func SortFacets(facets *models.SearchFacets) {
+	sort.SliceStable(facets.Categories, func(i, j int) bool {
+		a, b := facets.Categories[i], facets.Categories[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Name < b.Name
+	})
+	sort.Slice(facets.Ratings, func(i, j int) bool {
+		return facets.Ratings[i].Rating > facets.Ratings[j].Rating
+	})
+}
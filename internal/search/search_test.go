@@ -0,0 +1,211 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+var (
+	apparel = &models.Category{CategoryID: 1, Name: "Apparel", Slug: "apparel"}
+	shirts  = &models.Category{CategoryID: 2, Name: "Shirts", Slug: "shirts"}
+	books   = &models.Category{CategoryID: 3, Name: "Books", Slug: "books"}
+)
+
+// catalog the Memory tests search, seq is the insert order so prd-5 is the newest
+func testDocuments() []*models.SearchDocument {
+	doc := func(seq int, name, description string, price int64, rating int8, inStock bool, categories ...*models.Category) *models.SearchDocument {
+		return &models.SearchDocument{
+			Product: models.ResponseProduct{
+				ProductID:   fmt.Sprintf("prd-%d", seq),
+				ProductName: name,
+				Description: description,
+				Price:       models.NewMoney(price, "USD"),
+				Rating:      rating,
+			},
+			Seq:        seq,
+			Categories: categories,
+			InStock:    inStock,
+		}
+	}
+	return []*models.SearchDocument{
+		doc(1, "Blue Cotton Shirt", "soft cotton tee", 1999, 4, true, shirts),
+		doc(2, "Red Shirt", "a bright red shirt made of linen", 2499, 5, false, shirts),
+		doc(3, "Cotton Tote Bag", "carry books in cotton", 1299, 3, true, apparel),
+		doc(4, "Go Programming", "learn to program", 3999, 5, true, books),
+		doc(5, "Shirt Folding Guide", "a book about folding shirts", 999, 2, true, books),
+	}
+}
+
+// ids of the products of a result, in order
+func productIDs(result *models.SearchResult) []string {
+	ids := []string{}
+	for _, product := range result.Products {
+		ids = append(ids, product.ProductID)
+	}
+	return ids
+}
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"empty", "", nil},
+		{"lowercased", "Blue SHIRT", []string{"blue", "shirt"}},
+		{"punctuation splits words", "t-shirt, 100% cotton!", []string{"shirt", "100", "cotton"}},
+		{"short words dropped", "a go to the map", []string{"the", "map"}},
+		{"only short words", "a an to", nil},
+		{"letters beyond ascii", "Café crème", []string{"café", "crème"}},
+		{"short in bytes but not runes", "été", []string{"été"}},
+		{"operators are not terms", "+shirt -cotton* \"red\"", []string{"shirt", "cotton", "red"}},
+		{"at most ten", strings.Repeat("word ", 12), []string{"word", "word", "word", "word", "word", "word", "word", "word", "word", "word"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Terms(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Terms(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    models.ProductQuery
+		wantSort models.SearchSort
+		err      error
+	}{
+		{"text defaults to relevance", models.ProductQuery{Text: "shirt"}, models.SortRelevance, nil},
+		{"no text defaults to newest", models.ProductQuery{}, models.SortNewest, nil},
+		{"only short words defaults to newest", models.ProductQuery{Text: "a to"}, models.SortNewest, nil},
+		{"sort kept", models.ProductQuery{Text: "shirt", Sort: models.SortPriceDesc}, models.SortPriceDesc, nil},
+		{"price range", models.ProductQuery{MinPrice: 100, MaxPrice: 100}, models.SortNewest, nil},
+		{"min price only", models.ProductQuery{MinPrice: 100}, models.SortNewest, nil},
+		{"rating bounds", models.ProductQuery{MinRating: 5}, models.SortNewest, nil},
+		{"negative min price", models.ProductQuery{MinPrice: -1}, "", utils.ErrInvalidSearch},
+		{"negative max price", models.ProductQuery{MaxPrice: -1}, "", utils.ErrInvalidSearch},
+		{"max below min", models.ProductQuery{MinPrice: 500, MaxPrice: 100}, "", utils.ErrInvalidSearch},
+		{"negative rating", models.ProductQuery{MinRating: -1}, "", utils.ErrInvalidSearch},
+		{"rating above five", models.ProductQuery{MinRating: 6}, "", utils.ErrInvalidSearch},
+		{"unknown sort", models.ProductQuery{Sort: "cheapest"}, "", utils.ErrInvalidSearch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			err := Validate(&q)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && q.Sort != tt.wantSort {
+				t.Errorf("Validate() sort = %q, want %q", q.Sort, tt.wantSort)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	tests := []struct {
+		name        string
+		query       models.ProductQuery
+		categoryIDs []int
+		want        []string
+		total       int
+	}{
+		//prd-2 and prd-5 score 3 (name and description), newer first, prd-1 scores 2 (name)
+		{"relevance", models.ProductQuery{Text: "shirt", Sort: models.SortRelevance}, nil, []string{"prd-5", "prd-2", "prd-1"}, 3},
+		{"term is a word prefix", models.ProductQuery{Text: "shir", Sort: models.SortRelevance}, nil, []string{"prd-5", "prd-2", "prd-1"}, 3},
+		{"every term must match", models.ProductQuery{Text: "cotton shirt", Sort: models.SortRelevance}, nil, []string{"prd-1"}, 1},
+		{"term inside a word does not match", models.ProductQuery{Text: "irt", Sort: models.SortRelevance}, nil, []string{}, 0},
+		{"no match", models.ProductQuery{Text: "sweater", Sort: models.SortRelevance}, nil, []string{}, 0},
+		{"newest", models.ProductQuery{Sort: models.SortNewest}, nil, []string{"prd-5", "prd-4", "prd-3", "prd-2", "prd-1"}, 5},
+		{"price ascending", models.ProductQuery{Sort: models.SortPriceAsc}, nil, []string{"prd-5", "prd-3", "prd-1", "prd-2", "prd-4"}, 5},
+		{"price descending", models.ProductQuery{Sort: models.SortPriceDesc}, nil, []string{"prd-4", "prd-2", "prd-1", "prd-3", "prd-5"}, 5},
+		{"rating, ties newest first", models.ProductQuery{Sort: models.SortRating}, nil, []string{"prd-4", "prd-2", "prd-1", "prd-3", "prd-5"}, 5},
+		{"text sorted by price", models.ProductQuery{Text: "shirt", Sort: models.SortPriceAsc}, nil, []string{"prd-5", "prd-1", "prd-2"}, 3},
+		{"min price", models.ProductQuery{MinPrice: 1999, Sort: models.SortNewest}, nil, []string{"prd-4", "prd-2", "prd-1"}, 3},
+		{"max price", models.ProductQuery{MaxPrice: 1999, Sort: models.SortNewest}, nil, []string{"prd-5", "prd-3", "prd-1"}, 3},
+		{"price range", models.ProductQuery{MinPrice: 1000, MaxPrice: 2000, Sort: models.SortNewest}, nil, []string{"prd-3", "prd-1"}, 2},
+		{"min rating", models.ProductQuery{MinRating: 4, Sort: models.SortNewest}, nil, []string{"prd-4", "prd-2", "prd-1"}, 3},
+		{"in stock", models.ProductQuery{InStock: true, Sort: models.SortNewest}, nil, []string{"prd-5", "prd-4", "prd-3", "prd-1"}, 4},
+		{"category with subcategories", models.ProductQuery{Sort: models.SortNewest}, []int{apparel.CategoryID, shirts.CategoryID}, []string{"prd-3", "prd-2", "prd-1"}, 3},
+		{"category and text", models.ProductQuery{Text: "shirt", Sort: models.SortRelevance}, []int{books.CategoryID}, []string{"prd-5"}, 1},
+		{"category without products", models.ProductQuery{Sort: models.SortNewest}, []int{99}, []string{}, 0},
+		{"first page", models.ProductQuery{Sort: models.SortNewest, Limit: 2}, nil, []string{"prd-5", "prd-4"}, 5},
+		{"middle page", models.ProductQuery{Sort: models.SortNewest, Limit: 2, Offset: 2}, nil, []string{"prd-3", "prd-2"}, 5},
+		{"past the end", models.ProductQuery{Sort: models.SortNewest, Limit: 2, Offset: 5}, nil, []string{}, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			if q.Limit == 0 {
+				q.Limit = 10
+			}
+			result := Memory(testDocuments(), &q, tt.categoryIDs)
+			if got := productIDs(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Memory() products = %v, want %v", got, tt.want)
+			}
+			if result.Total != tt.total {
+				t.Errorf("Memory() total = %d, want %d", result.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestMemoryFacets(t *testing.T) {
+	tests := []struct {
+		name  string
+		query models.ProductQuery
+		want  *models.SearchFacets
+	}{
+		{"text search", models.ProductQuery{Text: "shirt", Sort: models.SortRelevance, Limit: 1}, &models.SearchFacets{
+			//counted over every match, not just the page of one
+			Categories: []*models.CategoryFacet{{Slug: "shirts", Name: "Shirts", Count: 2}, {Slug: "books", Name: "Books", Count: 1}},
+			Ratings:    []*models.RatingFacet{{Rating: 5, Count: 1}, {Rating: 4, Count: 1}, {Rating: 2, Count: 1}},
+			MinPrice:   999,
+			MaxPrice:   2499,
+			InStock:    2,
+		}},
+		{"whole catalog", models.ProductQuery{Sort: models.SortNewest, Limit: 10}, &models.SearchFacets{
+			//equal counts are ordered by name
+			Categories: []*models.CategoryFacet{{Slug: "books", Name: "Books", Count: 2}, {Slug: "shirts", Name: "Shirts", Count: 2}, {Slug: "apparel", Name: "Apparel", Count: 1}},
+			Ratings:    []*models.RatingFacet{{Rating: 5, Count: 2}, {Rating: 4, Count: 1}, {Rating: 3, Count: 1}, {Rating: 2, Count: 1}},
+			MinPrice:   999,
+			MaxPrice:   3999,
+			InStock:    4,
+		}},
+		{"no match", models.ProductQuery{Text: "sweater", Sort: models.SortRelevance, Limit: 10}, &models.SearchFacets{
+			Categories: []*models.CategoryFacet{},
+			Ratings:    []*models.RatingFacet{},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := tt.query
+			got := Memory(testDocuments(), &q, nil).Facets
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Memory() facets = %s, want %s", describeFacets(got), describeFacets(tt.want))
+			}
+		})
+	}
+}
+
+// facets written out for failure messages, the lists hold pointers
+func describeFacets(facets *models.SearchFacets) string {
+	var b strings.Builder
+	for _, category := range facets.Categories {
+		fmt.Fprintf(&b, "%s:%d ", category.Slug, category.Count)
+	}
+	for _, rating := range facets.Ratings {
+		fmt.Fprintf(&b, "%d*:%d ", rating.Rating, rating.Count)
+	}
+	fmt.Fprintf(&b, "price %d-%d in stock %d", facets.MinPrice, facets.MaxPrice, facets.InStock)
+	return b.String()
+}
@@ -5,6 +5,7 @@ import (
 
 	"github.com/gorilla/mux"
 	"github.com/h3th-IV/mysticMerch/internal/api"
+	"github.com/h3th-IV/mysticMerch/internal/models"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
 	"github.com/justinas/alice"
 )
@@ -12,10 +13,39 @@ import (
 func SetAdminRoutes(router *mux.Router) {
 	adminRouter := router.PathPrefix("/admin").Subrouter()
 
-	//routes for admin
+	//routes for admin, each chain requires the permission for that area
 	authChain := alice.New(utils.AdminRoute)
-	adminRouter.Handle("/newproduct", authChain.ThenFunc(api.AddItemtoStore)).Methods(http.MethodPost)
-	adminRouter.Handle("/removeproduct", authChain.ThenFunc(api.RemoveItemfromStore)).Methods(http.MethodDelete)
-	adminRouter.Handle("/broadcast", authChain.ThenFunc(api.AdminBroadcast)).Methods(http.MethodPost)
-	adminRouter.Handle("/transactional", authChain.ThenFunc(api.Transactional)).Methods(http.MethodPost)
+	catalogChain := authChain.Append(api.RequirePermission(models.PermCatalogWrite))
+	ordersChain := authChain.Append(api.RequirePermission(models.PermOrdersManage))
+	couponsChain := authChain.Append(api.RequirePermission(models.PermCouponsManage))
+	rolesChain := authChain.Append(api.RequirePermission(models.PermRolesManage))
+	reviewsChain := authChain.Append(api.RequirePermission(models.PermReviewsModerate))
+
+	adminRouter.Handle("/newproduct", catalogChain.ThenFunc(api.AddItemtoStore)).Methods(http.MethodPost)
+	adminRouter.Handle("/removeproduct", catalogChain.ThenFunc(api.RemoveItemfromStore)).Methods(http.MethodDelete)
+	adminRouter.Handle("/stock", catalogChain.ThenFunc(api.UpdateStock)).Methods(http.MethodPut)
+	adminRouter.Handle("/products/variants", catalogChain.ThenFunc(api.AddProductVariant)).Methods(http.MethodPost)
+	adminRouter.Handle("/products/{id}/images", catalogChain.ThenFunc(api.AdminUploadProductImages)).Methods(http.MethodPost)
+	adminRouter.Handle("/products/{id}/images/order", catalogChain.ThenFunc(api.AdminReorderProductImages)).Methods(http.MethodPut)
+	adminRouter.Handle("/products/{id}/images/{image_id:[0-9]+}", catalogChain.ThenFunc(api.AdminDeleteProductImage)).Methods(http.MethodDelete)
+	adminRouter.Handle("/products/categories", catalogChain.ThenFunc(api.AdminSetProductCategories)).Methods(http.MethodPut)
+	adminRouter.Handle("/categories", catalogChain.ThenFunc(api.GetCategories)).Methods(http.MethodGet)
+	adminRouter.Handle("/categories", catalogChain.ThenFunc(api.AdminCreateCategory)).Methods(http.MethodPost)
+	adminRouter.Handle("/categories/{id:[0-9]+}", catalogChain.ThenFunc(api.AdminUpdateCategory)).Methods(http.MethodPut)
+	adminRouter.Handle("/categories/{id:[0-9]+}", catalogChain.ThenFunc(api.AdminDeleteCategory)).Methods(http.MethodDelete)
+	adminRouter.Handle("/broadcast", authChain.Append(api.RequirePermission(models.PermEmailBroadcast)).ThenFunc(api.AdminBroadcast)).Methods(http.MethodPost)
+	adminRouter.Handle("/transactional", authChain.Append(api.RequirePermission(models.PermEmailTransactional)).ThenFunc(api.Transactional)).Methods(http.MethodPost)
+	adminRouter.Handle("/orders/{id:[0-9]+}/status", ordersChain.ThenFunc(api.AdminUpdateOrderStatus)).Methods(http.MethodPut)
+	adminRouter.Handle("/orders/{id:[0-9]+}/status", ordersChain.ThenFunc(api.AdminOrderStatusHistory)).Methods(http.MethodGet)
+	adminRouter.Handle("/orders/{id:[0-9]+}/invoice", ordersChain.ThenFunc(api.AdminOrderInvoice)).Methods(http.MethodGet)
+	adminRouter.Handle("/coupons", couponsChain.ThenFunc(api.AdminGetCoupons)).Methods(http.MethodGet)
+	adminRouter.Handle("/coupons", couponsChain.ThenFunc(api.AdminCreateCoupon)).Methods(http.MethodPost)
+	adminRouter.Handle("/coupons/{id:[0-9]+}", couponsChain.ThenFunc(api.AdminUpdateCoupon)).Methods(http.MethodPut)
+	adminRouter.Handle("/coupons/{id:[0-9]+}", couponsChain.ThenFunc(api.AdminDeleteCoupon)).Methods(http.MethodDelete)
+	adminRouter.Handle("/roles", rolesChain.ThenFunc(api.AdminGetRoles)).Methods(http.MethodGet)
+	adminRouter.Handle("/reviews", reviewsChain.ThenFunc(api.AdminGetReviews)).Methods(http.MethodGet)
+	adminRouter.Handle("/reviews/{id:[0-9]+}", reviewsChain.ThenFunc(api.AdminModerateReview)).Methods(http.MethodPut)
+	adminRouter.Handle("/reviews/{id:[0-9]+}", reviewsChain.ThenFunc(api.AdminDeleteReview)).Methods(http.MethodDelete)
+	adminRouter.Handle("/users", rolesChain.ThenFunc(api.AdminGetUsers)).Methods(http.MethodGet)
+	adminRouter.Handle("/users/{id:[0-9]+}/roles", rolesChain.ThenFunc(api.AdminSetUserRoles)).Methods(http.MethodPut)
 }
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/api"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+	"github.com/justinas/alice"
+)
+
+func SetAuthRoutes(router *mux.Router) {
+	router.HandleFunc("/token/refresh", api.RefreshToken).Methods(http.MethodPost)
+	router.HandleFunc("/password/forgot", api.ForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", api.ResetPasswordForm).Methods(http.MethodGet)
+	router.HandleFunc("/password/reset", api.ResetPassword).Methods(http.MethodPost)
+
+	//users and admins sign tokens with different secrets
+	router.Handle("/logout", alice.New(utils.AuthRoute).ThenFunc(api.LogOut)).Methods(http.MethodPost)
+	router.Handle("/admin/logout", alice.New(utils.AdminRoute).ThenFunc(api.LogOut)).Methods(http.MethodPost)
+}
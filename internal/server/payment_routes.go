@@ -0,0 +1,15 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/h3th-IV/mysticMerch/internal/api"
+)
+
+func SetPaymentRoutes(router *mux.Router) {
+	PaymentRouter := router.PathPrefix("/payments").Subrouter()
+
+	//called by payment providers, authenticated by signature not jwt
+	PaymentRouter.HandleFunc("/webhook", api.PaymentWebhook).Methods(http.MethodPost)
+}
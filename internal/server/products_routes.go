@@ -2,9 +2,11 @@ package server
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
 	"github.com/h3th-IV/mysticMerch/internal/api"
+	"github.com/h3th-IV/mysticMerch/internal/storage"
 	"github.com/h3th-IV/mysticMerch/internal/utils"
 	"github.com/justinas/alice"
 )
@@ -14,6 +16,18 @@ func SetProductRoutes(router *mux.Router) {
 
 	ProductRoutes.HandleFunc("/product", api.ViewProduct).Methods(http.MethodGet)
 	ProductRoutes.HandleFunc("/catalog", api.SearchProduct).Methods(http.MethodGet)
+	ProductRoutes.HandleFunc("/categories", api.GetCategories).Methods(http.MethodGet)
+	ProductRoutes.HandleFunc("/category/{slug}", api.GetCategoryProducts).Methods(http.MethodGet)
+}
+
+// serve uploaded images, neuteredFileSystem keeps directory listings blocked
+func SetUploadRoutes(router *mux.Router) {
+	files, ok := storage.Default().(storage.FileServer)
+	if !ok {
+		return //store hands its files out itself
+	}
+	fileServer := http.FileServer(neuteredFileSystem{fs: files.FileSystem()})
+	router.PathPrefix(storage.URLPrefix).Handler(http.StripPrefix(strings.TrimSuffix(storage.URLPrefix, "/"), fileServer)).Methods(http.MethodGet)
 }
 
 func SetCartRoutes(router *mux.Router) {
@@ -26,6 +40,9 @@ func SetCartRoutes(router *mux.Router) {
 	CartProducts.Handle("/updateitem", userMWchain.ThenFunc(api.UpdateProductDetails)).Methods(http.MethodPut)
 	CartProducts.Handle("/removeitem", userMWchain.ThenFunc(api.RemovefromCart)).Methods(http.MethodDelete)
 	CartProducts.Handle("/item", userMWchain.ThenFunc(api.GetItemFromCart)).Methods(http.MethodGet)
-	CartProducts.Handle("checkout", userMWchain.ThenFunc(api.BuyFromCart))
-	CartProducts.Handle("/buy", userMWchain.ThenFunc(api.InstantBuy))
+	CartProducts.Handle("/applycoupon", userMWchain.ThenFunc(api.ApplyCoupon)).Methods(http.MethodPost)
+	CartProducts.Handle("/applycoupon", userMWchain.ThenFunc(api.RemoveCoupon)).Methods(http.MethodDelete)
+	CartProducts.Handle("/shipping-quote", userMWchain.ThenFunc(api.ShippingQuote)).Methods(http.MethodGet)
+	CartProducts.Handle("/checkout", userMWchain.ThenFunc(api.BuyFromCart)).Methods(http.MethodPost)
+	CartProducts.Handle("/buy", userMWchain.ThenFunc(api.InstantBuy)).Methods(http.MethodPost)
 }
@@ -22,6 +22,10 @@ func StartServer() {
 	router.HandleFunc("/", api.Home)
 	router.HandleFunc("/signup", api.SignUp).Methods(http.MethodPost)
 	router.HandleFunc("/login", api.LogIn).Methods(http.MethodPost)
+	router.HandleFunc("/verify-email", api.VerifyEmail).Methods(http.MethodGet)
+
+	//set token refresh and logout routes
+	SetAuthRoutes(router)
 
 	//set Admin related routes
 	SetAdminRoutes(router)
@@ -32,9 +36,15 @@ func StartServer() {
 	//set Product related routes
 	SetProductRoutes(router)
 
+	//set uploaded image routes
+	SetUploadRoutes(router)
+
 	//set Cart routes
 	SetCartRoutes(router)
 
+	//set Payment routes
+	SetPaymentRoutes(router)
+
 	router.Use(middlewareChain.Then)
 	server := &http.Server{
 		Addr:     ":8000",
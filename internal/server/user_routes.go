@@ -47,6 +47,25 @@ func SetUserRoutes(router *mux.Router) {
 
 	userMWchain := alice.New(utils.AuthRoute)
 
+	//profile
+	UserRouter.Handle("/me", userMWchain.ThenFunc(api.GetProfile)).Methods(http.MethodGet)
+	UserRouter.Handle("/me", userMWchain.ThenFunc(api.UpdateProfile)).Methods(http.MethodPatch)
+	UserRouter.Handle("/me", userMWchain.ThenFunc(api.DeleteAccount)).Methods(http.MethodDelete)
+	UserRouter.Handle("/password", userMWchain.ThenFunc(api.ChangePassword)).Methods(http.MethodPost)
+	UserRouter.Handle("/verify-email/resend", userMWchain.ThenFunc(api.ResendVerification)).Methods(http.MethodPost)
 	UserRouter.Handle("/addaddress", userMWchain.ThenFunc(api.AddNewAddr)).Methods(http.MethodPost)
 	UserRouter.Handle("/removeaddress/{id:[0-9]+}", userMWchain.ThenFunc(api.RemoveAddress)).Methods(http.MethodDelete)
+
+	//address book
+	UserRouter.Handle("/addresses", userMWchain.ThenFunc(api.GetUserAddresses)).Methods(http.MethodGet)
+	UserRouter.Handle("/addresses/{id:[0-9]+}", userMWchain.ThenFunc(api.UpdateAddress)).Methods(http.MethodPut)
+
+	//order history
+	UserRouter.Handle("/orders", userMWchain.ThenFunc(api.GetUserOrders)).Methods(http.MethodGet)
+	UserRouter.Handle("/orders/{id:[0-9]+}", userMWchain.ThenFunc(api.GetUserOrder)).Methods(http.MethodGet)
+	UserRouter.Handle("/orders/{id:[0-9]+}/invoice", userMWchain.ThenFunc(api.GetUserOrderInvoice)).Methods(http.MethodGet)
+
+	//reviews of delivered products
+	UserRouter.Handle("/reviews", userMWchain.ThenFunc(api.PostReview)).Methods(http.MethodPost)
+	UserRouter.Handle("/reviews/{id:[0-9]+}", userMWchain.ThenFunc(api.UpdateReview)).Methods(http.MethodPut)
 }
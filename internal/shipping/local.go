@@ -0,0 +1,112 @@
+package shipping
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// loads shipping zones along with their rates
+type ZoneSource func() ([]*models.ShippingZone, error)
+
+// LocalCarrier is our own delivery service, prices come from the zone and rate
+// tables so they can be changed without a deploy.
+type LocalCarrier struct {
+	zones ZoneSource
+}
+
+func NewLocalCarrier(zones ZoneSource) *LocalCarrier {
+	return &LocalCarrier{zones: zones}
+}
+
+func (l *LocalCarrier) Name() string {
+	return CarrierLocal
+}
+
+// rates of the zone the parcel is going to, one per method
+func (l *LocalCarrier) Rates(parcel *models.Parcel) ([]*models.ShippingQuote, error) {
+	zones, err := l.zones()
+	if err != nil {
+		return nil, err
+	}
+	zone := matchZone(zones, parcel.Destination)
+	if zone == nil {
+		return nil, utils.ErrNoShippingRate
+	}
+
+	//cheapest applicable rate of each method
+	byMethod := make(map[string]*models.ShippingQuote)
+	for _, rate := range zone.Rates {
+		if rate.Price.Currency != parcel.Subtotal.Currency {
+			continue
+		}
+		if rate.Kind == models.ShippingByWeight && (parcel.Weight < rate.MinWeight || (rate.MaxWeight > 0 && parcel.Weight >= rate.MaxWeight)) {
+			continue
+		}
+		if current, ok := byMethod[rate.Method]; ok && current.Cost.Amount <= rate.Price.Amount {
+			continue
+		}
+		byMethod[rate.Method] = &models.ShippingQuote{
+			Carrier:      CarrierLocal,
+			Method:       rate.Method,
+			Name:         rate.Name,
+			Cost:         rate.Price,
+			DeliveryDays: rate.DeliveryDays,
+		}
+	}
+	if len(byMethod) == 0 {
+		return nil, utils.ErrNoShippingRate
+	}
+
+	quotes := make([]*models.ShippingQuote, 0, len(byMethod))
+	for _, quote := range byMethod {
+		quotes = append(quotes, quote)
+	}
+	sort.Slice(quotes, func(i, j int) bool {
+		if quotes[i].Cost.Amount != quotes[j].Cost.Amount {
+			return quotes[i].Cost.Amount < quotes[j].Cost.Amount
+		}
+		return quotes[i].Method < quotes[j].Method
+	})
+	return quotes, nil
+}
+
+// most specific zone covering addr, postal prefix beats city and city beats country
+func matchZone(zones []*models.ShippingZone, addr *models.Address) *models.ShippingZone {
+	if addr == nil {
+		return nil
+	}
+	postalCode := strings.ToUpper(strings.ReplaceAll(addr.PostalCode, " ", ""))
+
+	var best *models.ShippingZone
+	bestScore := -1
+	for _, zone := range zones {
+		score := 0
+		if zone.Country != "" {
+			if !strings.EqualFold(zone.Country, addr.Country) {
+				continue
+			}
+			score += 1
+		}
+		if zone.City != "" {
+			if !strings.EqualFold(zone.City, strings.TrimSpace(addr.City)) {
+				continue
+			}
+			score += 2
+		}
+		if zone.PostalPrefix != "" {
+			prefix := strings.ToUpper(strings.ReplaceAll(zone.PostalPrefix, " ", ""))
+			if !strings.HasPrefix(postalCode, prefix) {
+				continue
+			}
+			//longer prefixes are narrower
+			score += 4 + len(prefix)
+		}
+		if score > bestScore {
+			best, bestScore = zone, score
+		}
+	}
+	return best
+}
@@ -0,0 +1,146 @@
+package shipping
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// zones the local carrier tests price against, from the whole world down to one postal area
+func testZones() []*models.ShippingZone {
+	return []*models.ShippingZone{
+		{ZoneID: 1, Name: "Worldwide", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "International", Kind: models.ShippingFlat, Price: models.NewMoney(5000, "USD"), DeliveryDays: 14},
+		}},
+		{ZoneID: 2, Name: "Nigeria", Country: "NG", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "Standard", Kind: models.ShippingByWeight, MaxWeight: 1000, Price: models.NewMoney(1500, "USD"), DeliveryDays: 5},
+			{Method: "standard", Name: "Standard", Kind: models.ShippingByWeight, MinWeight: 1000, Price: models.NewMoney(3000, "USD"), DeliveryDays: 5},
+			{Method: "express", Name: "Express", Kind: models.ShippingFlat, Price: models.NewMoney(4000, "USD"), DeliveryDays: 2},
+			//a cheaper flat rate of the same method wins over the brackets
+			{Method: "standard", Name: "Standard saver", Kind: models.ShippingFlat, Price: models.NewMoney(2500, "USD"), DeliveryDays: 7},
+		}},
+		{ZoneID: 3, Name: "Lagos", Country: "NG", City: "Lagos", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "Lagos standard", Kind: models.ShippingFlat, Price: models.NewMoney(800, "USD"), DeliveryDays: 2},
+		}},
+		{ZoneID: 4, Name: "Ikeja", Country: "NG", City: "Lagos", PostalPrefix: "1002", Rates: []*models.ShippingRate{
+			{Method: "same_day", Name: "Same day", Kind: models.ShippingFlat, Price: models.NewMoney(1200, "USD"), DeliveryDays: 0},
+		}},
+		{ZoneID: 5, Name: "Ikeja GRA", Country: "NG", City: "Lagos", PostalPrefix: "100 271", Rates: []*models.ShippingRate{
+			{Method: "same_day", Name: "Same day GRA", Kind: models.ShippingFlat, Price: models.NewMoney(1000, "USD"), DeliveryDays: 0},
+		}},
+		{ZoneID: 6, Name: "Ghana", Country: "GH", Rates: []*models.ShippingRate{
+			{Method: "standard", Name: "Standard", Kind: models.ShippingFlat, Price: models.NewMoney(200, "GHS"), DeliveryDays: 6},
+		}},
+	}
+}
+
+func TestMatchZone(t *testing.T) {
+	tests := []struct {
+		name string
+		addr *models.Address
+		want int //zone id, 0 is no zone
+	}{
+		{"no address", nil, 0},
+		{"other country falls back to worldwide", &models.Address{Country: "US", City: "Lagos"}, 1},
+		{"country", &models.Address{Country: "NG", City: "Abuja"}, 2},
+		{"country is case insensitive", &models.Address{Country: "ng", City: "Abuja"}, 2},
+		{"city beats country", &models.Address{Country: "NG", City: "Lagos", PostalCode: "101233"}, 3},
+		{"city is case insensitive and trimmed", &models.Address{Country: "NG", City: " lagos "}, 3},
+		{"postal prefix beats city", &models.Address{Country: "NG", City: "Lagos", PostalCode: "100212"}, 4},
+		{"longer prefix beats shorter", &models.Address{Country: "NG", City: "Lagos", PostalCode: "100271"}, 5},
+		{"postal spaces are ignored", &models.Address{Country: "NG", City: "Lagos", PostalCode: "10 02 71"}, 5},
+		{"prefix of another city does not match", &models.Address{Country: "NG", City: "Ibadan", PostalCode: "100271"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := 0
+			if zone := matchZone(testZones(), tt.addr); zone != nil {
+				got = zone.ZoneID
+			}
+			if got != tt.want {
+				t.Errorf("matchZone() = zone %d, want zone %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchZoneWithoutFallback(t *testing.T) {
+	zones := testZones()[1:]
+	if zone := matchZone(zones, &models.Address{Country: "US"}); zone != nil {
+		t.Errorf("matchZone() = zone %d, want none", zone.ZoneID)
+	}
+}
+
+func TestLocalCarrierRates(t *testing.T) {
+	errZones := errors.New("zones unavailable")
+	tests := []struct {
+		name   string
+		zones  ZoneSource
+		parcel *models.Parcel
+		want   []models.ShippingQuote
+		err    error
+	}{
+		{
+			name:   "light parcel takes the first bracket",
+			parcel: &models.Parcel{Destination: &models.Address{Country: "NG", City: "Abuja"}, Weight: 999, Subtotal: models.NewMoney(5000, "USD")},
+			want: []models.ShippingQuote{
+				{Carrier: CarrierLocal, Method: "standard", Name: "Standard", Cost: models.NewMoney(1500, "USD"), DeliveryDays: 5},
+				{Carrier: CarrierLocal, Method: "express", Name: "Express", Cost: models.NewMoney(4000, "USD"), DeliveryDays: 2},
+			},
+		},
+		{
+			name:   "bracket upper bound is exclusive, cheaper flat rate wins",
+			parcel: &models.Parcel{Destination: &models.Address{Country: "NG", City: "Abuja"}, Weight: 1000, Subtotal: models.NewMoney(5000, "USD")},
+			want: []models.ShippingQuote{
+				{Carrier: CarrierLocal, Method: "standard", Name: "Standard saver", Cost: models.NewMoney(2500, "USD"), DeliveryDays: 7},
+				{Carrier: CarrierLocal, Method: "express", Name: "Express", Cost: models.NewMoney(4000, "USD"), DeliveryDays: 2},
+			},
+		},
+		{
+			name:   "only the rates of the matched zone",
+			parcel: &models.Parcel{Destination: &models.Address{Country: "NG", City: "Lagos", PostalCode: "100212"}, Weight: 500, Subtotal: models.NewMoney(5000, "USD")},
+			want: []models.ShippingQuote{
+				{Carrier: CarrierLocal, Method: "same_day", Name: "Same day", Cost: models.NewMoney(1200, "USD")},
+			},
+		},
+		{
+			name:   "no zone",
+			zones:  func() ([]*models.ShippingZone, error) { return testZones()[1:], nil },
+			parcel: &models.Parcel{Destination: &models.Address{Country: "US"}, Weight: 500, Subtotal: models.NewMoney(5000, "USD")},
+			err:    utils.ErrNoShippingRate,
+		},
+		{
+			name:   "no rate in the order currency",
+			parcel: &models.Parcel{Destination: &models.Address{Country: "GH"}, Weight: 500, Subtotal: models.NewMoney(5000, "USD")},
+			err:    utils.ErrNoShippingRate,
+		},
+		{
+			name:   "zones fail to load",
+			zones:  func() ([]*models.ShippingZone, error) { return nil, errZones },
+			parcel: &models.Parcel{Destination: &models.Address{Country: "NG"}, Weight: 500, Subtotal: models.NewMoney(5000, "USD")},
+			err:    errZones,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			zones := tt.zones
+			if zones == nil {
+				zones = func() ([]*models.ShippingZone, error) { return testZones(), nil }
+			}
+			quotes, err := NewLocalCarrier(zones).Rates(tt.parcel)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Rates() error = %v, want %v", err, tt.err)
+			}
+			var got []models.ShippingQuote
+			for _, quote := range quotes {
+				got = append(got, *quote)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Rates() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
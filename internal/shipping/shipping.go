@@ -0,0 +1,78 @@
+package shipping
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// name of the carrier used when checkout does not pick one
+const CarrierLocal = "local"
+
+// ShippingCarrier is implemented by anything that can price and deliver a parcel
+type ShippingCarrier interface {
+	// carrier name stored on the order
+	Name() string
+	// price of every method the carrier offers for parcel, cheapest first
+	Rates(parcel *models.Parcel) ([]*models.ShippingQuote, error)
+}
+
+var (
+	carriers   = make(map[string]ShippingCarrier)
+	carriersMu sync.RWMutex
+)
+
+// make carrier available at checkout under its name
+func Register(carrier ShippingCarrier) {
+	carriersMu.Lock()
+	defer carriersMu.Unlock()
+	carriers[carrier.Name()] = carrier
+}
+
+// get shipping carrier by name, empty name is the local carrier
+func Lookup(name string) (ShippingCarrier, error) {
+	if name == "" {
+		name = CarrierLocal
+	}
+	carriersMu.RLock()
+	defer carriersMu.RUnlock()
+	carrier, ok := carriers[name]
+	if !ok {
+		return nil, utils.ErrUnknownCarrier
+	}
+	return carrier, nil
+}
+
+// every registered carrier sorted by name
+func Carriers() []ShippingCarrier {
+	carriersMu.RLock()
+	defer carriersMu.RUnlock()
+	list := make([]ShippingCarrier, 0, len(carriers))
+	for _, carrier := range carriers {
+		list = append(list, carrier)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+	return list
+}
+
+// price of shipping parcel with one method of a carrier, empty method picks the cheapest
+func Quote(carrierName, method string, parcel *models.Parcel) (*models.ShippingQuote, error) {
+	carrier, err := Lookup(carrierName)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := carrier.Rates(parcel)
+	if err != nil {
+		return nil, err
+	}
+	for _, rate := range rates {
+		if method == "" || rate.Method == method {
+			return rate, nil
+		}
+	}
+	return nil, utils.ErrNoShippingRate
+}
@@ -0,0 +1,65 @@
+package shipping
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+func TestQuote(t *testing.T) {
+	Register(NewLocalCarrier(func() ([]*models.ShippingZone, error) { return testZones(), nil }))
+	abuja := &models.Parcel{Destination: &models.Address{Country: "NG", City: "Abuja"}, Weight: 500, Subtotal: models.NewMoney(5000, "USD")}
+
+	tests := []struct {
+		name    string
+		carrier string
+		method  string
+		parcel  *models.Parcel
+		want    string //name of the quoted rate
+		err     error
+	}{
+		{"empty carrier and method is the cheapest local rate", "", "", abuja, "Standard", nil},
+		{"method", CarrierLocal, "express", abuja, "Express", nil},
+		{"unknown carrier", "pigeon", "", abuja, "", utils.ErrUnknownCarrier},
+		{"method not offered in the zone", CarrierLocal, "same_day", abuja, "", utils.ErrNoShippingRate},
+		{"no zone for the address", CarrierLocal, "", &models.Parcel{Destination: &models.Address{Country: "GH"}, Subtotal: models.NewMoney(5000, "USD")}, "", utils.ErrNoShippingRate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote, err := Quote(tt.carrier, tt.method, tt.parcel)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Quote() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && quote.Name != tt.want {
+				t.Errorf("Quote() = %q, want %q", quote.Name, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	Register(NewLocalCarrier(func() ([]*models.ShippingZone, error) { return nil, nil }))
+	tests := []struct {
+		name    string
+		carrier string
+		err     error
+	}{
+		{"empty is local", "", nil},
+		{"local", CarrierLocal, nil},
+		{"unknown", "pigeon", utils.ErrUnknownCarrier},
+		{"names are exact", "Local", utils.ErrUnknownCarrier},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			carrier, err := Lookup(tt.carrier)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Lookup(%q) error = %v, want %v", tt.carrier, err, tt.err)
+			}
+			if err == nil && carrier.Name() != CarrierLocal {
+				t.Errorf("Lookup(%q) = %q, want %q", tt.carrier, carrier.Name(), CarrierLocal)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// LocalDisk keeps files in a directory on this machine
+type LocalDisk struct {
+	root    string
+	baseURL string
+}
+
+// files under root, served from baseURL e.g /uploads/
+func NewLocalDisk(root, baseURL string) *LocalDisk {
+	return &LocalDisk{root: root, baseURL: baseURL}
+}
+
+// where key lives on disk, keys that climb out of root are refused
+func (d *LocalDisk) path(key string) (string, error) {
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(d.root, filepath.FromSlash(key)), nil
+}
+
+// file is written next to its final name and renamed so readers never see half a file
+func (d *LocalDisk) Put(key string, r io.Reader) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (d *LocalDisk) Delete(key string) error {
+	name, err := d.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (d *LocalDisk) URL(key string) string {
+	return d.baseURL + key
+}
+
+// files of the store for http.FileServer
+func (d *LocalDisk) FileSystem() http.FileSystem {
+	return http.Dir(d.root)
+}
@@ -0,0 +1,51 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/h3th-IV/mysticMerch/internal/utils"
+)
+
+// path uploaded files are served under by this server
+const URLPrefix = "/uploads/"
+
+var ErrInvalidKey = errors.New("err: blob key must be a relative slash separated path")
+
+// BlobStore is implemented by anything that can keep uploaded files.
+// keys are slash separated paths, e.g products/prd.../1b9d.png
+type BlobStore interface {
+	// save everything read from r under key, replacing what was there
+	Put(key string, r io.Reader) error
+	// remove file under key, a missing file is not an error
+	Delete(key string) error
+	// address clients fetch the file from
+	URL(key string) string
+}
+
+// FileServer is implemented by stores whose files are handed out by this server
+// rather than from somewhere else (e.g a CDN)
+type FileServer interface {
+	FileSystem() http.FileSystem
+}
+
+var (
+	defaultStore BlobStore
+	defaultOnce  sync.Once
+)
+
+// store uploads go to, files are kept on local disk under MM_UPLOAD_DIR (uploads when unset)
+func Default() BlobStore {
+	defaultOnce.Do(func() {
+		utils.LoadEnv()
+		dir := os.Getenv("MM_UPLOAD_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		defaultStore = NewLocalDisk(dir, URLPrefix)
+	})
+	return defaultStore
+}
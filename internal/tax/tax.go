@@ -0,0 +1,95 @@
+package tax
+
+import (
+	"strings"
+
+	"github.com/h3th-IV/mysticMerch/internal/models"
+)
+
+// basis points in one whole, a rate of 10000 is 100%
+const basisPoints = 10000
+
+// rule for a tax class at an address, a rule for the address region beats one for the whole country
+func Match(rules []*models.TaxRule, addr *models.Address, taxClass string) *models.TaxRule {
+	if addr == nil {
+		return nil
+	}
+	if taxClass == "" {
+		taxClass = models.DefaultTaxClass
+	}
+	var best *models.TaxRule
+	for _, rule := range rules {
+		if !strings.EqualFold(rule.Country, addr.Country) || rule.TaxClass != taxClass {
+			continue
+		}
+		if rule.Region != "" {
+			if !strings.EqualFold(rule.Region, strings.TrimSpace(addr.Region)) {
+				continue
+			}
+			return rule
+		}
+		if best == nil {
+			best = rule
+		}
+	}
+	return best
+}
+
+// tax on top of a tax-exclusive amount, rounded half up
+func Exclusive(amount int64, rate int) int64 {
+	return (amount*int64(rate) + basisPoints/2) / basisPoints
+}
+
+// tax contained in a tax-inclusive amount, rounded half up
+func Inclusive(amount int64, rate int) int64 {
+	divisor := int64(basisPoints + rate)
+	net := (amount*basisPoints + divisor/2) / divisor
+	return amount - net
+}
+
+// work out tax of every line going to addr, discount is spread over the lines by their share of the subtotal.
+// lines get their Tax, TaxRate and TaxInclusive set, the returned amounts are the tax to add on top of
+// the prices and the tax already included in them
+func Apply(rules []*models.TaxRule, addr *models.Address, items []*models.OrderItem, discount models.Money) (models.Money, models.Money, error) {
+	var subtotal models.Money
+	for _, item := range items {
+		var err error
+		if subtotal, err = subtotal.Add(item.Price.Mul(item.Quantity)); err != nil {
+			return models.Money{}, models.Money{}, err
+		}
+	}
+	if discount.Currency != "" && discount.Currency != subtotal.Currency {
+		return models.Money{}, models.Money{}, models.ErrCurrencyMismatch
+	}
+	if discount.Amount > subtotal.Amount {
+		discount.Amount = subtotal.Amount
+	}
+
+	added := models.NewMoney(0, subtotal.Currency)
+	included := models.NewMoney(0, subtotal.Currency)
+	remaining := discount.Amount
+	for i, item := range items {
+		line := item.Price.Mul(item.Quantity).Amount
+		share := remaining
+		if i < len(items)-1 && subtotal.Amount > 0 {
+			share = discount.Amount * line / subtotal.Amount
+		}
+		remaining -= share
+
+		item.Tax = models.NewMoney(0, subtotal.Currency)
+		item.TaxRate, item.TaxInclusive = 0, false
+		rule := Match(rules, addr, item.TaxClass)
+		if rule == nil {
+			continue
+		}
+		item.TaxRate, item.TaxInclusive = rule.Rate, rule.Inclusive
+		if rule.Inclusive {
+			item.Tax.Amount = Inclusive(line-share, rule.Rate)
+			included.Amount += item.Tax.Amount
+		} else {
+			item.Tax.Amount = Exclusive(line-share, rule.Rate)
+			added.Amount += item.Tax.Amount
+		}
+	}
+	return added, included, nil
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+)
+
+// audiences of the two kinds of access tokens, a user token can't be used on admin routes and vice versa
+const (
+	UserAudience  = "mysticmerch-user"
+	AdminAudience = "mysticmerch-admin"
+)
+
+// allowed difference between our clock and the one that issued a token
+const clockSkew = 30 * time.Second
+
+var (
+	ErrMalformedHeader = errors.New("err: authorization header must be 'Bearer <token>'")
+	ErrUnknownKey      = errors.New("err: token signed with unknown key")
+	ErrSigningMethod   = errors.New("err: unexpected token signing method")
+	ErrTokenExpired    = errors.New("err: token has expired")
+	ErrTokenNotYet     = errors.New("err: token is not valid yet")
+	ErrTokenClaims     = errors.New("err: token claims are invalid")
+	ErrNoSigningKey    = errors.New("err: no signing key configured")
+)
+
+// Claims carried by every access token
+type Claims struct {
+	User  string   `json:"user"` //user uuid
+	Roles []string `json:"roles,omitempty"`
+	jwt.StandardClaims
+}
+
+// TokenService issues and checks access tokens for one audience.
+// tokens are signed with the active key and its id goes in the kid header,
+// retired keys are kept for verification only so tokens survive a secret rotation
+type TokenService struct {
+	issuer    string
+	audience  string
+	ttl       time.Duration
+	activeKID string
+	keys      map[string][]byte
+	now       func() time.Time
+}
+
+func NewTokenService(issuer, audience string, ttl time.Duration, activeKID string, keys map[string][]byte) *TokenService {
+	return &TokenService{
+		issuer:    issuer,
+		audience:  audience,
+		ttl:       ttl,
+		activeKID: activeKID,
+		keys:      keys,
+		now:       time.Now,
+	}
+}
+
+// sign a new access token for user
+func (ts *TokenService) Issue(user *models.User) (string, *Claims, error) {
+	secret, ok := ts.keys[ts.activeKID]
+	if !ok || len(secret) == 0 {
+		return "", nil, ErrNoSigningKey
+	}
+	now := ts.now()
+	claims := &Claims{
+		User:  user.UserID,
+		Roles: user.Roles,
+		StandardClaims: jwt.StandardClaims{
+			Id:        uuid.NewString(),
+			Issuer:    ts.issuer,
+			Audience:  ts.audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(ts.ttl).Unix(),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = ts.activeKID
+
+	signed, err := token.SignedString(secret)
+	if err != nil {
+		return "", nil, err
+	}
+	return signed, claims, nil
+}
+
+// verify signature, algorithm and claims of a token
+func (ts *TokenService) Parse(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		//only HS256 is issued, anything else (none, RS256 with our secret as public key...) is refused
+		if t.Method != jwt.SigningMethodHS256 {
+			return nil, ErrSigningMethod
+		}
+		kid, _ := t.Header["kid"].(string)
+		secret, ok := ts.keys[kid]
+		if !ok || len(secret) == 0 {
+			return nil, ErrUnknownKey
+		}
+		return secret, nil
+	})
+	if err != nil {
+		var validationErr *jwt.ValidationError
+		if errors.As(err, &validationErr) && validationErr.Inner != nil {
+			return nil, validationErr.Inner
+		}
+		return nil, err
+	}
+	if err := ts.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// check registered claims, exp, iat and nbf are required
+func (ts *TokenService) validate(claims *Claims) error {
+	now := ts.now()
+	if claims.User == "" || claims.Id == "" || claims.ExpiresAt == 0 || claims.IssuedAt == 0 || claims.NotBefore == 0 {
+		return ErrTokenClaims
+	}
+	if claims.Issuer != ts.issuer || claims.Audience != ts.audience {
+		return ErrTokenClaims
+	}
+	if now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return ErrTokenExpired
+	}
+	if now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) || now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)) {
+		return ErrTokenNotYet
+	}
+	return nil
+}
+
+// token from an 'Authorization: Bearer <token>' header
+func BearerToken(header string) (string, error) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", ErrMalformedHeader
+	}
+	token = strings.TrimSpace(token)
+	if token == "" || strings.ContainsAny(token, " \t") {
+		return "", ErrMalformedHeader
+	}
+	return token, nil
+}
+
+// read signing keys for an env prefix, e.g MYSTIC is the active secret, MYSTIC_KID its key id (default "1")
+// and MYSTIC_KEYS holds retired keys still accepted for verification as kid:secret,kid:secret
+func keysFromEnv(prefix string) (string, map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(os.Getenv(prefix+"_KEYS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kid, secret, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if !found || kid == "" || secret == "" {
+			return "", nil, fmt.Errorf("err: malformed %s_KEYS entry", prefix)
+		}
+		keys[kid] = []byte(secret)
+	}
+	activeKID := os.Getenv(prefix + "_KID")
+	if activeKID == "" {
+		activeKID = "1"
+	}
+	keys[activeKID] = []byte(os.Getenv(prefix))
+	return activeKID, keys, nil
+}
+
+var (
+	userTokens, adminTokens *TokenService
+	tokensOnce              sync.Once
+)
+
+func loadTokenServices() {
+	LoadEnv()
+	build := func(prefix, audience string) *TokenService {
+		kid, keys, err := keysFromEnv(prefix)
+		if err != nil {
+			ReplaceLogger.Error(err.Error())
+			keys = map[string][]byte{}
+		}
+		return NewTokenService(os.Getenv("JWTISSUER"), audience, AccessTokenTTL, kid, keys)
+	}
+	userTokens = build("MYSTIC", UserAudience)
+	adminTokens = build("MYTH", AdminAudience)
+}
+
+// token service for regular users
+func UserTokens() *TokenService {
+	tokensOnce.Do(loadTokenServices)
+	return userTokens
+}
+
+// token service for users holding an admin role
+func AdminTokens() *TokenService {
+	tokensOnce.Do(loadTokenServices)
+	return adminTokens
+}
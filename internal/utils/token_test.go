@@ -0,0 +1,335 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/h3th-IV/mysticMerch/internal/models"
+)
+
+const testIssuer = "mysticmerch-test"
+
+var testNow = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// stands for any parse error in TestTokenServiceParse
+var errAnyToken = errors.New("any error")
+
+// keys of the test token services, kid 1 is retired and kid 2 signs new tokens
+func testKeys() map[string][]byte {
+	return map[string][]byte{
+		"1": []byte("retired-secret"),
+		"2": []byte("active-secret"),
+	}
+}
+
+// token service for audience with its clock stopped at testNow
+func testTokenService(audience string) *TokenService {
+	ts := NewTokenService(testIssuer, audience, AccessTokenTTL, "2", testKeys())
+	ts.now = func() time.Time { return testNow }
+	return ts
+}
+
+// claims of a token issued at testNow that is valid for the user audience
+func testClaims() *Claims {
+	return &Claims{
+		User: "usr-1",
+		StandardClaims: jwt.StandardClaims{
+			Id:        "jti-1",
+			Issuer:    testIssuer,
+			Audience:  UserAudience,
+			IssuedAt:  testNow.Unix(),
+			NotBefore: testNow.Unix(),
+			ExpiresAt: testNow.Add(AccessTokenTTL).Unix(),
+		},
+	}
+}
+
+// HS256 token of claims signed with the test key under kid
+func signTest(t *testing.T, claims *Claims, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(testKeys()[kid])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestTokenServiceIssue(t *testing.T) {
+	ts := testTokenService(UserAudience)
+	signed, issued, err := ts.Issue(&models.User{UserID: "usr-1", Roles: []string{"support"}})
+	if err != nil {
+		t.Fatalf("Issue() error = %v", err)
+	}
+	claims, err := ts.Parse(signed)
+	if err != nil {
+		t.Fatalf("Parse() of issued token error = %v", err)
+	}
+	if claims.User != "usr-1" || claims.Id != issued.Id || len(claims.Roles) != 1 || claims.Roles[0] != "support" {
+		t.Errorf("Parse() = %+v, want claims of issued token %+v", claims, issued)
+	}
+
+	empty := NewTokenService(testIssuer, UserAudience, AccessTokenTTL, "3", testKeys())
+	if _, _, err := empty.Issue(&models.User{UserID: "usr-1"}); !errors.Is(err, ErrNoSigningKey) {
+		t.Errorf("Issue() without active key error = %v, want %v", err, ErrNoSigningKey)
+	}
+}
+
+func TestTokenServiceParse(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate rsa key: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		audience string //audience of the service parsing the token
+		token    func(t *testing.T) string
+		err      error //nil for tokens that must be accepted
+	}{
+		{"valid", UserAudience, func(t *testing.T) string {
+			return signTest(t, testClaims(), "2")
+		}, nil},
+		{"retired kid still verifies", UserAudience, func(t *testing.T) string {
+			return signTest(t, testClaims(), "1")
+		}, nil},
+		{"unknown kid", UserAudience, func(t *testing.T) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			token.Header["kid"] = "9"
+			signed, _ := token.SignedString([]byte("active-secret"))
+			return signed
+		}, ErrUnknownKey},
+		{"missing kid", UserAudience, func(t *testing.T) string {
+			signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims()).SignedString([]byte("active-secret"))
+			return signed
+		}, ErrUnknownKey},
+		{"alg none", UserAudience, func(t *testing.T) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+			token.Header["kid"] = "2"
+			signed, _ := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			return signed
+		}, ErrSigningMethod},
+		{"alg RS256", UserAudience, func(t *testing.T) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodRS256, testClaims())
+			token.Header["kid"] = "2"
+			signed, err := token.SignedString(rsaKey)
+			if err != nil {
+				t.Fatalf("failed to sign rs256 token: %v", err)
+			}
+			return signed
+		}, ErrSigningMethod},
+		{"wrong signature", UserAudience, func(t *testing.T) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			token.Header["kid"] = "2"
+			signed, _ := token.SignedString([]byte("not-our-secret"))
+			return signed
+		}, jwt.ErrSignatureInvalid},
+		{"missing exp", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.ExpiresAt = 0
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"missing nbf", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.NotBefore = 0
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"missing iat", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.IssuedAt = 0
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"missing jti", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.Id = ""
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"missing user", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.User = ""
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"expired within clock skew", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.ExpiresAt = testNow.Add(-clockSkew).Unix()
+			return signTest(t, claims, "2")
+		}, nil},
+		{"expired past clock skew", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.ExpiresAt = testNow.Add(-clockSkew - time.Second).Unix()
+			return signTest(t, claims, "2")
+		}, ErrTokenExpired},
+		{"not before within clock skew", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.NotBefore = testNow.Add(clockSkew).Unix()
+			return signTest(t, claims, "2")
+		}, nil},
+		{"not before past clock skew", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.NotBefore = testNow.Add(clockSkew + time.Second).Unix()
+			return signTest(t, claims, "2")
+		}, ErrTokenNotYet},
+		{"issued in the future", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.IssuedAt = testNow.Add(time.Hour).Unix()
+			return signTest(t, claims, "2")
+		}, ErrTokenNotYet},
+		{"wrong issuer", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.Issuer = "someone-else"
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"wrong audience", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.Audience = "someone-else"
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"user token on admin service", AdminAudience, func(t *testing.T) string {
+			return signTest(t, testClaims(), "2")
+		}, ErrTokenClaims},
+		{"admin token on user service", UserAudience, func(t *testing.T) string {
+			claims := testClaims()
+			claims.Audience = AdminAudience
+			return signTest(t, claims, "2")
+		}, ErrTokenClaims},
+		{"not a token", UserAudience, func(t *testing.T) string {
+			return "not.a.token"
+		}, errAnyToken},
+		{"empty", UserAudience, func(t *testing.T) string {
+			return ""
+		}, errAnyToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := testTokenService(tt.audience).Parse(tt.token(t))
+			switch {
+			case tt.err == nil:
+				if err != nil {
+					t.Fatalf("Parse() error = %v, want token accepted", err)
+				}
+				if claims.User != "usr-1" {
+					t.Errorf("Parse() user = %q, want %q", claims.User, "usr-1")
+				}
+			case tt.err == errAnyToken:
+				if err == nil {
+					t.Fatalf("Parse() accepted %q", tt.name)
+				}
+			default:
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Parse() error = %v, want %v", err, tt.err)
+				}
+			}
+		})
+	}
+}
+
+func TestBearerToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+		err    error
+	}{
+		{"valid", "Bearer abc.def.ghi", "abc.def.ghi", nil},
+		{"lowercase scheme", "bearer abc.def.ghi", "abc.def.ghi", nil},
+		{"trailing space", "Bearer abc.def.ghi  ", "abc.def.ghi", nil},
+		{"extra spaces before token", "Bearer   abc.def.ghi", "abc.def.ghi", nil},
+		{"empty header", "", "", ErrMalformedHeader},
+		{"no scheme", "abc.def.ghi", "", ErrMalformedHeader},
+		{"other scheme", "Basic dXNlcjpwYXNz", "", ErrMalformedHeader},
+		{"scheme only", "Bearer", "", ErrMalformedHeader},
+		{"empty token", "Bearer ", "", ErrMalformedHeader},
+		{"blank token", "Bearer  \t ", "", ErrMalformedHeader},
+		{"tab separator", "Bearer\tabc.def.ghi", "", ErrMalformedHeader},
+		{"two tokens", "Bearer abc.def.ghi jkl", "", ErrMalformedHeader},
+		{"tab inside token", "Bearer abc\tdef", "", ErrMalformedHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := BearerToken(tt.header)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("BearerToken(%q) error = %v, want %v", tt.header, err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("BearerToken(%q) = %q, want %q", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTAuthRoutes(t *testing.T) {
+	ts := testTokenService(UserAudience)
+	valid := signTest(t, testClaims(), "2")
+	expired := testClaims()
+	expired.ExpiresAt = testNow.Add(-time.Hour).Unix()
+	none := jwt.NewWithClaims(jwt.SigningMethodNone, testClaims())
+	none.Header["kid"] = "2"
+	noneSigned, _ := none.SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name   string
+		header []string //Authorization header values, none when empty
+		status int
+	}{
+		{"valid token", []string{"Bearer " + valid}, http.StatusOK},
+		{"no header", nil, http.StatusUnauthorized},
+		{"empty header", []string{""}, http.StatusUnauthorized},
+		{"no scheme", []string{valid}, http.StatusUnauthorized},
+		{"empty token", []string{"Bearer "}, http.StatusUnauthorized},
+		{"garbage token", []string{"Bearer garbage"}, http.StatusUnauthorized},
+		{"alg none", []string{"Bearer " + noneSigned}, http.StatusUnauthorized},
+		{"expired token", []string{"Bearer " + signTest(t, expired, "2")}, http.StatusUnauthorized},
+		{"only first header is read", []string{"Basic abc", "Bearer " + valid}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var user interface{}
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				user = r.Context().Value(UserIDkey)
+				w.WriteHeader(http.StatusOK)
+			})
+			r := httptest.NewRequest(http.MethodGet, "/user/me", nil)
+			for _, value := range tt.header {
+				r.Header.Add("Authorization", value)
+			}
+			w := httptest.NewRecorder()
+
+			func() {
+				defer func() {
+					if p := recover(); p != nil {
+						t.Fatalf("JWTAuthRoutes panicked: %v", p)
+					}
+				}()
+				JWTAuthRoutes(next, ts).ServeHTTP(w, r)
+			}()
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if user != "usr-1" {
+					t.Errorf("user in context = %v, want usr-1", user)
+				}
+				return
+			}
+			if contentType := w.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("Content-Type = %q, want application/json", contentType)
+			}
+			var body map[string]interface{}
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatalf("401 body is not JSON: %v", err)
+			}
+			if message, _ := body["message"].(string); message == "" {
+				t.Errorf("401 body %s has no message", w.Body.String())
+			}
+		})
+	}
+}
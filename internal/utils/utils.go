@@ -7,6 +7,7 @@ import (
 	"crypto/rand"
 	"crypto/subtle"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -18,7 +19,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/go-sql-driver/mysql"
 	"github.com/google/uuid"
 	"github.com/h3th-IV/mysticMerch/internal/models"
@@ -72,7 +72,7 @@ func RequestLogger(next http.Handler) http.Handler {
 func HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
-		return "", nil
+		return "", err
 	}
 	return string(hash), nil
 }
@@ -85,6 +85,57 @@ var (
 	ErrExsistingCrednetials       = errors.New("err: duplicate credentials")
 	MySQLErr                      *mysql.MySQLError
 	ErrMismatchedCryptAndPassword = errors.New("err: password does not match registered password")
+
+	ErrEmptyCart       = errors.New("err: user cart is empty")
+	ErrInvalidQuantity = errors.New("err: quantity must be at least one")
+	ErrOutOfStock      = errors.New("err: not enough units in stock")
+	ErrInvalidVariant  = errors.New("err: product does not come in that color/size")
+	ErrExistingSKU     = errors.New("err: sku or color/size already exists")
+
+	ErrInvalidOrderStatus     = errors.New("err: unknown order status")
+	ErrInvalidOrderTransition = errors.New("err: order cannot move to requested status")
+	ErrOpenOrders             = errors.New("err: account has orders that are not yet delivered or cancelled")
+
+	ErrInvalidCoupon       = errors.New("err: coupon is invalid or expired")
+	ErrCouponLimitReached  = errors.New("err: coupon usage limit reached")
+	ErrCouponMinSpend      = errors.New("err: cart does not meet coupon minimum spend")
+	ErrCouponNotApplicable = errors.New("err: coupon does not apply to items in cart")
+	ErrExistingCoupon      = errors.New("err: coupon code already exists")
+	ErrInvalidCouponRule   = errors.New("err: coupon rules are invalid")
+
+	ErrInvalidCategory  = errors.New("err: category needs a name and slug, and cannot be its own ancestor")
+	ErrExistingCategory = errors.New("err: category slug already exists")
+
+	ErrInvalidSearch = errors.New("err: unknown sort or invalid price/rating filter")
+
+	ErrInvalidReview  = errors.New("err: rating must be 1 to 5 and review text at most 2000 characters")
+	ErrNotPurchased   = errors.New("err: only buyers with a delivered order can review a product")
+	ErrExistingReview = errors.New("err: product already reviewed, edit the existing review")
+
+	ErrInvalidImage      = errors.New("err: image must be a jpeg, png, gif or webp file of at most 5MB")
+	ErrTooManyImages     = errors.New("err: product has reached its image limit")
+	ErrInvalidImageOrder = errors.New("err: image order must list every image of the product once")
+
+	ErrInvalidCursor = errors.New("err: cursor is invalid or was made for another sort")
+	ErrInvalidSort   = errors.New("err: unknown sort")
+
+	ErrInvalidToken = errors.New("err: token is invalid or expired")
+	ErrTokenReused  = errors.New("err: refresh token was already used")
+
+	ErrInvalidAddress  = errors.New("err: address is incomplete or postal code does not match country")
+	ErrAddressRequired = errors.New("err: a saved shipping address is required")
+	ErrUnknownAddress  = errors.New("err: address not found in user address book")
+
+	ErrUnknownRole = errors.New("err: unknown role")
+	ErrForbidden   = errors.New("err: user lacks required permission")
+
+	ErrUnknownPaymentMethod = errors.New("err: unknown payment method")
+	ErrPaymentDeclined      = errors.New("err: payment declined")
+	ErrOrderChanged         = errors.New("err: order total changed while it was being placed")
+	ErrPaymentMismatch      = errors.New("err: payment amount or currency does not match order total")
+
+	ErrUnknownCarrier = errors.New("err: unknown shipping carrier")
+	ErrNoShippingRate = errors.New("err: no shipping method available for this address")
 )
 
 // Middleware to recover panic ##
@@ -106,87 +157,106 @@ type mapKey string
 
 const (
 	UserIDkey mapKey = "user_id"
+	ClaimsKey mapKey = "claims"
 )
 
-func GenerateToken(user *models.User, expiry time.Duration, issuer, secret string) (string, error) {
-	//set expiry date
-	bestBefore := time.Now().Add(expiry)
+// lifetime of access tokens, they are renewed with a refresh token
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
 
-	//ceate jwt tkeo with claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": user.UserID,
-		"epx":  bestBefore.Unix(),
-		"iss":  issuer,
-	})
+// reports whether an access token id was revoked, set by whoever keeps the revocation list
+var TokenRevoked func(jti string) (bool, error)
 
-	//generate token str and sign with seceret key
-	JWToken, err := token.SignedString([]byte(secret))
-	if err != nil {
+// random url safe token of n bytes, for refresh tokens and emailed links
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, buf); err != nil {
 		return "", err
 	}
-	return JWToken, nil
+	return base64.RawURLEncoding.EncodeToString(buf), nil
 }
 
-func AdminToken(user *models.User, expiry time.Duration, issuer, secret string) (string, error) {
-	bestBefore := time.Now().Add(time.Hour * 10)
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user": user.UserID,
-		"exp":  bestBefore,
-		"iss":  issuer,
+// write 401 with a JSON body
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="mysticMerch"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": message,
 	})
-
-	ADMINToken, err := token.SignedString([]byte(secret))
-	if err != nil {
-		return "", err
-	}
-
-	return ADMINToken, nil
 }
 
 // Middleware to Auth specific routes
-func JWTAuthRoutes(next http.Handler, secret string) http.Handler {
+func JWTAuthRoutes(next http.Handler, tokens *TokenService) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
 		//get AuthToken from request
-		AuthToken := r.Header.Get("Authorization")
-		jwtoken := strings.Split(AuthToken, " ")[1]
-
-		token, err := jwt.Parse(jwtoken, func(t *jwt.Token) (interface{}, error) {
-			return []byte(secret), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Unauthorized Operation", http.StatusUnauthorized)
+		jwtoken, err := BearerToken(r.Header.Get("Authorization"))
+		if err != nil {
+			unauthorized(w, err.Error())
 			return
 		}
-		tokenClaims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid Token claims", http.StatusBadRequest)
+
+		claims, err := tokens.Parse(jwtoken)
+		if err != nil {
+			unauthorized(w, "token is invalid or expired")
 			return
 		}
 
-		userID, ok := tokenClaims["user"]
-		if !ok {
-			http.Error(w, "User is not Authorized", http.StatusBadRequest)
-			return
+		//token can be revoked before it expires, e.g at logout
+		if TokenRevoked != nil {
+			revoked, err := TokenRevoked(claims.Id)
+			if err != nil {
+				ServerError(w, "failed to check token", err)
+				return
+			}
+			if revoked {
+				unauthorized(w, "token has been revoked")
+				return
+			}
 		}
 
-		//store user_id in context
-		ctx := context.WithValue(r.Context(), UserIDkey, userID)
+		//store user_id and claims in context
+		ctx := context.WithValue(r.Context(), UserIDkey, claims.User)
+		ctx = context.WithValue(ctx, ClaimsKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// reports whether any of roles grants permission
+type PermissionChecker func(roles []string, permission string) (bool, error)
+
+// Middleware to let through only requests whose token roles grant permission, must run after JWTAuthRoutes
+func RequirePermission(permission string, check PermissionChecker) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ClaimsKey).(*Claims)
+			if !ok || len(claims.Roles) == 0 {
+				http.Error(w, "user not authorized", http.StatusForbidden)
+				return
+			}
+			allowed, err := check(claims.Roles, permission)
+			if err != nil {
+				ServerError(w, "failed to check user permissions", err)
+				return
+			}
+			if !allowed {
+				http.Error(w, "user not authorized", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func AuthRoute(next http.Handler) http.Handler {
-	LoadEnv()
-	return JWTAuthRoutes(next, os.Getenv("MYSTIC"))
+	return JWTAuthRoutes(next, UserTokens())
 }
 
 // auth route for admin
 func AdminRoute(next http.Handler) http.Handler {
-	LoadEnv()
-	return JWTAuthRoutes(next, os.Getenv("MYTH"))
+	return JWTAuthRoutes(next, AdminTokens())
 }
 
 // used for all internal server Error
@@ -253,6 +323,53 @@ func ValidatePassword(password string) bool {
 	return passworder.MatchString(password)
 }
 
+// postal code formats of countries we ship to most, other countries only get a loose check
+var postalCodes = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Za-z]\d[A-Za-z] ?\d[A-Za-z]\d$`),
+	"GB": regexp.MustCompile(`^[A-Za-z]{1,2}\d[A-Za-z\d]? ?\d[A-Za-z]{2}$`),
+	"NG": regexp.MustCompile(`^\d{6}$`),
+	"GH": regexp.MustCompile(`^[A-Za-z]{2}-?\d{3,4}-?\d{4}$`),
+	"KE": regexp.MustCompile(`^\d{5}$`),
+	"ZA": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+	"NL": regexp.MustCompile(`^\d{4} ?[A-Za-z]{2}$`),
+	"IN": regexp.MustCompile(`^\d{6}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+}
+
+var (
+	countryCode     = regexp.MustCompile(`^[A-Z]{2}$`)
+	loosePostalCode = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 -]{1,18}[A-Za-z0-9]$`)
+)
+
+// check country is an ISO 3166-1 alpha-2 code and postal code fits it
+func ValidatePostalCode(country, postalCode string) bool {
+	if !countryCode.MatchString(country) {
+		return false
+	}
+	if format, ok := postalCodes[country]; ok {
+		return format.MatchString(postalCode)
+	}
+	return loosePostalCode.MatchString(postalCode)
+}
+
+var (
+	slugChars = regexp.MustCompile(`[^a-z0-9]+`)
+	slugger   = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+// url friendly form of a name, e.g "Men's T-Shirts" becomes "men-s-t-shirts"
+func Slugify(name string) string {
+	return strings.Trim(slugChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func ValidateSlug(slug string) bool {
+	return len(slug) <= 100 && slugger.MatchString(slug)
+}
+
 func GenerateUUID(elemenType string) (string, error) {
 	//generate new uuuid
 	id, err := uuid.NewRandom()
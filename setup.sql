@@ -6,6 +6,7 @@
         email VARCHAR(255) NOT NULL,
         phone_number VARCHAR(20) NOT NULL,
         password_hash VARCHAR(255),
+        email_verified_at TIMESTAMP NULL,
         created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
         updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
     );
@@ -13,14 +14,178 @@
     --add unique email constraints
     ALTER TABLE users ADD CONSTRAINT users_uc_email UNIQUE (email);
 
+    --one-time tokens sent by email, stored as sha256 hex and spent by setting used_at
+    CREATE TABLE user_tokens (
+        token_id INT AUTO_INCREMENT PRIMARY KEY,
+        user_id INT NOT NULL,
+        purpose ENUM('verify_email', 'password_reset') NOT NULL,
+        token_hash CHAR(64) NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        used_at TIMESTAMP NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CONSTRAINT user_tokens_uc_token_hash UNIQUE (token_hash),
+        INDEX (user_id, purpose, created_at),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+
+    --admin roles, what each role may do is in role_permissions
+    CREATE TABLE roles (
+        role_id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(50) NOT NULL,
+        CONSTRAINT roles_uc_name UNIQUE (name)
+    );
+
+    CREATE TABLE permissions (
+        permission_id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(50) NOT NULL,
+        CONSTRAINT permissions_uc_name UNIQUE (name)
+    );
+
+    CREATE TABLE role_permissions (
+        role_id INT NOT NULL,
+        permission_id INT NOT NULL,
+        PRIMARY KEY (role_id, permission_id),
+        FOREIGN KEY (role_id) REFERENCES roles(role_id) ON DELETE CASCADE,
+        FOREIGN KEY (permission_id) REFERENCES permissions(permission_id) ON DELETE CASCADE
+    );
+
+    CREATE TABLE user_roles (
+        user_id INT NOT NULL,
+        role_id INT NOT NULL,
+        PRIMARY KEY (user_id, role_id),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (role_id) REFERENCES roles(role_id) ON DELETE CASCADE
+    );
+
+    INSERT INTO roles(name) VALUES ('superadmin'), ('catalog-manager'), ('support'), ('marketing');
+    INSERT INTO permissions(name) VALUES ('catalog:write'), ('orders:manage'), ('coupons:manage'), ('email:broadcast'), ('email:transactional'), ('roles:manage'), ('reviews:moderate');
+
+    INSERT INTO role_permissions(role_id, permission_id)
+        SELECT r.role_id, p.permission_id FROM roles r JOIN permissions p WHERE r.name = 'superadmin'
+        UNION ALL SELECT r.role_id, p.permission_id FROM roles r JOIN permissions p ON p.name = 'catalog:write' WHERE r.name = 'catalog-manager'
+        UNION ALL SELECT r.role_id, p.permission_id FROM roles r JOIN permissions p ON p.name IN ('orders:manage', 'email:transactional', 'reviews:moderate') WHERE r.name = 'support'
+        UNION ALL SELECT r.role_id, p.permission_id FROM roles r JOIN permissions p ON p.name IN ('email:broadcast', 'coupons:manage') WHERE r.name = 'marketing';
+
+    --first superadmin has to be granted by hand once their account exists, e.g
+    --INSERT INTO user_roles(user_id, role_id) SELECT u.id, r.role_id FROM users u JOIN roles r ON r.name = 'superadmin' WHERE u.email = 'admin@example.com';
+
+    --refresh tokens are stored as sha256 hex, rotating a token revokes it and issues the next one in the same family
+    CREATE TABLE refresh_tokens (
+        token_id INT AUTO_INCREMENT PRIMARY KEY,
+        user_id INT NOT NULL,
+        token_hash CHAR(64) NOT NULL,
+        family_id VARCHAR(36) NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        revoked_at TIMESTAMP NULL,
+        created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        CONSTRAINT refresh_tokens_uc_token_hash UNIQUE (token_hash),
+        INDEX (family_id),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+
+    --access tokens revoked before they expire, rows can go once expires_at has passed
+    CREATE TABLE revoked_tokens (
+        jti VARCHAR(64) PRIMARY KEY,
+        expires_at TIMESTAMP NOT NULL,
+        INDEX (expires_at)
+    );
+
     CREATE TABLE products (
         id INT AUTO_INCREMENT PRIMARY KEY,
         product_id VARCHAR(255) NOT NULL,
         product_name VARCHAR(255),
         description LONGTEXT,  
-        image VARCHAR(255),
-        price INT,
-        rating INT
+        image VARCHAR(255), --url of the first image in product_images
+        price BIGINT NOT NULL,
+        currency CHAR(3) NOT NULL DEFAULT 'USD',
+        rating INT, --rounded average of visible reviews
+        review_count INT NOT NULL DEFAULT 0,
+        weight INT NOT NULL DEFAULT 0, --grams per unit, used for shipping rates
+        tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+        FULLTEXT INDEX products_ft_search (product_name, description) --catalog search
+    );
+
+    --all prices are integer minor units (e.g cents) of the row's currency
+
+    ALTER TABLE products ADD CONSTRAINT products_uc_product_id UNIQUE (product_id);
+
+    --color/size options of a product, products without options have one variant with color = '' and size = ''
+    --price overrides the product price when set
+    CREATE TABLE product_variants (
+        variant_id INT AUTO_INCREMENT PRIMARY KEY,
+        product_id VARCHAR(255) NOT NULL,
+        sku VARCHAR(64),
+        color VARCHAR(50) NOT NULL DEFAULT '',
+        size VARCHAR(50) NOT NULL DEFAULT '',
+        price BIGINT,
+        stock INT NOT NULL DEFAULT 0,
+        CONSTRAINT product_variants_uc_sku UNIQUE (sku),
+        CONSTRAINT product_variants_uc_option UNIQUE (product_id, color, size),
+        FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+    );
+
+    --uploaded images of a product, position 0 is the main image. blob_key is where the file is kept in the blob store
+    CREATE TABLE product_images (
+        image_id INT AUTO_INCREMENT PRIMARY KEY,
+        product_id VARCHAR(255) NOT NULL,
+        blob_key VARCHAR(255) NOT NULL,
+        url VARCHAR(255) NOT NULL,
+        content_type VARCHAR(50) NOT NULL,
+        size INT NOT NULL, --bytes
+        position INT NOT NULL,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        CONSTRAINT product_images_uc_key UNIQUE (blob_key),
+        INDEX product_images_order (product_id, position),
+        FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+    );
+
+    --category tree, top level categories have no parent. deleting a category moves its children up to its parent
+    CREATE TABLE categories (
+        category_id INT AUTO_INCREMENT PRIMARY KEY,
+        parent_id INT,
+        name VARCHAR(100) NOT NULL,
+        slug VARCHAR(100) NOT NULL,
+        featured BOOLEAN NOT NULL DEFAULT FALSE, --shown on the home page
+        CONSTRAINT categories_uc_slug UNIQUE (slug),
+        FOREIGN KEY (parent_id) REFERENCES categories(category_id)
+    );
+
+    CREATE TABLE product_categories (
+        product_id VARCHAR(255) NOT NULL,
+        category_id INT NOT NULL,
+        PRIMARY KEY (product_id, category_id),
+        INDEX product_categories_category (category_id),
+        FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE,
+        FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+    );
+
+    --one review per buyer and product, only buyers with a delivered order may post. hidden reviews don't count towards the product rating
+    CREATE TABLE reviews (
+        review_id INT AUTO_INCREMENT PRIMARY KEY,
+        product_id VARCHAR(255) NOT NULL,
+        user_id INT NOT NULL,
+        rating TINYINT NOT NULL, --1 to 5
+        body TEXT,
+        hidden BOOLEAN NOT NULL DEFAULT FALSE,
+        created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+        updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+        CONSTRAINT reviews_uc_author UNIQUE (product_id, user_id),
+        INDEX reviews_product (product_id, hidden),
+        FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    );
+
+    --units held by items in a user's cart until expires_at
+    CREATE TABLE stock_reservations (
+        reservation_id INT AUTO_INCREMENT PRIMARY KEY,
+        user_id INT NOT NULL,
+        variant_id INT NOT NULL,
+        quantity INT NOT NULL,
+        expires_at TIMESTAMP NOT NULL,
+        CONSTRAINT stock_reservations_uc_hold UNIQUE (user_id, variant_id),
+        INDEX stock_reservations_expiry (variant_id, expires_at),
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (variant_id) REFERENCES product_variants(variant_id) ON DELETE CASCADE
     );
 
     CREATE TABLE carts (
@@ -29,7 +194,8 @@
         product_id VARCHAR(255),
         product_name VARCHAR(255),
         description LONGTEXT,
-        price INT,
+        price BIGINT NOT NULL,
+        currency CHAR(3) NOT NULL DEFAULT 'USD',
         rating INT,
         image VARCHAR(255),
         quantity INT,
@@ -39,24 +205,216 @@
     );
 
 
+    --percent is for percentage coupons, amount for fixed ones, both min_spend and amount are minor units of currency
+    CREATE TABLE coupons (
+        coupon_id INT AUTO_INCREMENT PRIMARY KEY,
+        code VARCHAR(50) NOT NULL,
+        kind ENUM('percentage', 'fixed', 'free_shipping') NOT NULL,
+        percent INT NOT NULL DEFAULT 0,
+        amount BIGINT NOT NULL DEFAULT 0,
+        min_spend BIGINT NOT NULL DEFAULT 0,
+        currency CHAR(3) NOT NULL DEFAULT 'USD',
+        per_user_limit INT NOT NULL DEFAULT 0,
+        starts_at TIMESTAMP NULL,
+        ends_at TIMESTAMP NULL,
+        active BOOLEAN NOT NULL DEFAULT TRUE,
+        CONSTRAINT coupons_uc_code UNIQUE (code)
+    );
+
+    --products a coupon is limited to, no rows here and in coupon_categories means every product
+    CREATE TABLE coupon_products (
+        coupon_id INT NOT NULL,
+        product_id VARCHAR(255) NOT NULL,
+        PRIMARY KEY (coupon_id, product_id),
+        FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE CASCADE,
+        FOREIGN KEY (product_id) REFERENCES products(product_id) ON DELETE CASCADE
+    );
+
+    --categories a coupon is limited to, products in their subcategories count too
+    CREATE TABLE coupon_categories (
+        coupon_id INT NOT NULL,
+        category_id INT NOT NULL,
+        PRIMARY KEY (coupon_id, category_id),
+        FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE CASCADE,
+        FOREIGN KEY (category_id) REFERENCES categories(category_id) ON DELETE CASCADE
+    );
+
+    --coupon waiting in a user's cart for checkout
+    CREATE TABLE cart_coupons (
+        user_id INT PRIMARY KEY,
+        coupon_id INT NOT NULL,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE CASCADE
+    );
+
     CREATE TABLE orders (
         order_id INT AUTO_INCREMENT PRIMARY KEY,
         user_id INT,
         ordered_at TIMESTAMP,
-        price INT,
-        discount INT,
+        price BIGINT NOT NULL,
+        discount BIGINT NOT NULL DEFAULT 0,
+        currency CHAR(3) NOT NULL DEFAULT 'USD',
         payment_type ENUM('Electronic', 'Cash'),
-        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+        payment_provider VARCHAR(20),
+        payment_ref VARCHAR(255),
+        payment_status ENUM('pending', 'authorized', 'captured', 'failed', 'refunded'),
+        status ENUM('pending', 'paid', 'packed', 'shipped', 'delivered', 'cancelled', 'refunded') NOT NULL DEFAULT 'pending',
+        coupon_id INT,
+        shipping_carrier VARCHAR(50),
+        shipping_method VARCHAR(50),
+        shipping_cost BIGINT NOT NULL DEFAULT 0,
+        tax BIGINT NOT NULL DEFAULT 0, --added on top of price
+        included_tax BIGINT NOT NULL DEFAULT 0, --already part of price
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE SET NULL
+    );
+
+    --one row per order a coupon was used on, counts towards per_user_limit
+    CREATE TABLE coupon_redemptions (
+        redemption_id INT AUTO_INCREMENT PRIMARY KEY,
+        coupon_id INT NOT NULL,
+        user_id INT NOT NULL,
+        order_id INT NOT NULL,
+        redeemed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (coupon_id) REFERENCES coupons(coupon_id) ON DELETE CASCADE,
+        FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+        FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+    );
+
+    --audit trail of order status transitions, changed_by is null for system changes
+    CREATE TABLE order_status_history (
+        history_id INT AUTO_INCREMENT PRIMARY KEY,
+        order_id INT NOT NULL,
+        from_status VARCHAR(20) NOT NULL,
+        to_status VARCHAR(20) NOT NULL,
+        changed_by INT,
+        changed_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE,
+        FOREIGN KEY (changed_by) REFERENCES users(id) ON DELETE SET NULL
+    );
+
+    CREATE TABLE order_items (
+        item_id INT AUTO_INCREMENT PRIMARY KEY,
+        order_id INT NOT NULL,
+        product_id VARCHAR(255) NOT NULL,
+        product_name VARCHAR(255),
+        price BIGINT NOT NULL,
+        quantity INT NOT NULL,
+        color VARCHAR(50),
+        size VARCHAR(50),
+        tax BIGINT NOT NULL DEFAULT 0, --tax of the whole line after its share of the discount
+        tax_rate INT NOT NULL DEFAULT 0, --basis points, 750 is 7.5%
+        tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+        FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE CASCADE
+    );
+
+    --webhook events already applied, event_id keeps retries from being applied twice
+    CREATE TABLE payment_events (
+        event_id VARCHAR(255) PRIMARY KEY,
+        provider VARCHAR(20) NOT NULL,
+        event_type VARCHAR(50) NOT NULL,
+        order_id INT,
+        received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE SET NULL
     );
 
+    --country is ISO 3166-1 alpha-2, region is the state/province/county
+    --a user has at most one default shipping and one default billing address
     CREATE TABLE address (
         address_id INT AUTO_INCREMENT PRIMARY KEY,
         user_id INT,
         house_no VARCHAR(50),
         street VARCHAR(255),
         city VARCHAR(100),
+        region VARCHAR(100) NOT NULL DEFAULT '',
         postal_code VARCHAR(20),
+        country CHAR(2) NOT NULL,
+        default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+        default_billing BOOLEAN NOT NULL DEFAULT FALSE,
         FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
     );
 
+    --orders keep a copy of the addresses used, the saved address may be edited or removed later
+    ALTER TABLE orders ADD COLUMN shipping_address_id INT NULL, ADD COLUMN billing_address_id INT NULL,
+        ADD COLUMN shipping_address JSON NULL, ADD COLUMN billing_address JSON NULL,
+        ADD FOREIGN KEY (shipping_address_id) REFERENCES address(address_id) ON DELETE SET NULL,
+        ADD FOREIGN KEY (billing_address_id) REFERENCES address(address_id) ON DELETE SET NULL;
+
+    --zones of the local carrier, empty city/postal_prefix match any address in country and empty country matches anywhere
+    CREATE TABLE shipping_zones (
+        zone_id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        country CHAR(2) NOT NULL DEFAULT '',
+        city VARCHAR(100) NOT NULL DEFAULT '',
+        postal_prefix VARCHAR(20) NOT NULL DEFAULT ''
+    );
+
+    --flat rates ignore weight, weight rates cover min_weight up to (not including) max_weight grams, null max_weight has no upper bound
+    CREATE TABLE shipping_rates (
+        rate_id INT AUTO_INCREMENT PRIMARY KEY,
+        zone_id INT NOT NULL,
+        method VARCHAR(50) NOT NULL,
+        name VARCHAR(100) NOT NULL,
+        kind ENUM('flat', 'weight') NOT NULL,
+        min_weight INT NOT NULL DEFAULT 0,
+        max_weight INT,
+        price BIGINT NOT NULL,
+        currency CHAR(3) NOT NULL DEFAULT 'USD',
+        delivery_days INT NOT NULL DEFAULT 0,
+        FOREIGN KEY (zone_id) REFERENCES shipping_zones(zone_id) ON DELETE CASCADE
+    );
+
+    INSERT INTO shipping_zones (zone_id, name, country) VALUES (1, 'Domestic', 'US'), (2, 'International', '');
+    INSERT INTO shipping_rates (zone_id, method, name, kind, min_weight, max_weight, price, delivery_days) VALUES
+        (1, 'standard', 'Standard', 'weight', 0, 1000, 599, 5),
+        (1, 'standard', 'Standard', 'weight', 1000, 5000, 999, 5),
+        (1, 'standard', 'Standard', 'weight', 5000, NULL, 1999, 7),
+        (1, 'express', 'Express', 'flat', 0, NULL, 2499, 2),
+        (2, 'standard', 'International Standard', 'weight', 0, 2000, 2499, 14),
+        (2, 'standard', 'International Standard', 'weight', 2000, NULL, 4999, 21);
+
+    --one invoice per order, number runs from 1 within each year
+    --invoices are kept when the order or account is gone so numbers stay gapless, the buyer is copied in when issued
+    CREATE TABLE invoices (
+        invoice_id INT AUTO_INCREMENT PRIMARY KEY,
+        order_id INT,
+        year INT NOT NULL,
+        number INT NOT NULL,
+        issued_at TIMESTAMP NOT NULL,
+        buyer_first_name VARCHAR(50) NOT NULL,
+        buyer_last_name VARCHAR(50) NOT NULL,
+        buyer_email VARCHAR(255) NOT NULL,
+        buyer_phone VARCHAR(20) NOT NULL,
+        CONSTRAINT invoices_uc_order UNIQUE (order_id),
+        CONSTRAINT invoices_uc_number UNIQUE (year, number),
+        FOREIGN KEY (order_id) REFERENCES orders(order_id) ON DELETE SET NULL
+    );
+
+    --last invoice number handed out in each year, the row lock keeps numbers gapless under concurrent issues
+    CREATE TABLE invoice_counters (
+        year INT PRIMARY KEY,
+        last_number INT NOT NULL
+    );
+
+    --tax on a product tax class by destination, a rule with a region beats the country-wide one
+    --inclusive rules are for destinations where catalog prices already contain the tax
+    CREATE TABLE tax_rules (
+        rule_id INT AUTO_INCREMENT PRIMARY KEY,
+        name VARCHAR(100) NOT NULL,
+        country CHAR(2) NOT NULL,
+        region VARCHAR(100) NOT NULL DEFAULT '',
+        tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+        rate INT NOT NULL, --basis points, 750 is 7.5%
+        inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+        CONSTRAINT tax_rules_uc_rule UNIQUE (country, region, tax_class)
+    );
+
+    INSERT INTO tax_rules (name, country, region, tax_class, rate, inclusive) VALUES
+        ('VAT', 'NG', '', 'standard', 750, TRUE),
+        ('VAT', 'GB', '', 'standard', 2000, TRUE),
+        ('VAT', 'GB', '', 'reduced', 500, TRUE),
+        ('Sales Tax', 'US', 'CA', 'standard', 725, FALSE),
+        ('Sales Tax', 'US', 'NY', 'standard', 400, FALSE),
+        ('Sales Tax', 'US', 'TX', 'standard', 625, FALSE);
+
     --added delete cascade so when clumns can be removed along side userfir
\ No newline at end of file